@@ -0,0 +1,266 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/jx"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"go.uber.org/multierr"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/prog"
+)
+
+type AdminLogOptions struct {
+	Chat   string
+	Output string
+	Events []string // event types, empty means all
+	Admins []string // admins who performed actions, empty means all
+	Query  string   // search query of events
+	Raw    bool
+}
+
+// AdminLogEvent is the event of recent actions of channels and supergroups
+type AdminLogEvent struct {
+	ID      int64                              `json:"id"`
+	Date    int                                `json:"date"`
+	User    *Sender                            `json:"user"`   // who performed the action
+	Action  string                             `json:"action"` // e.g. participant_join, participant_toggle_ban
+	Target  *Sender                            `json:"target,omitempty"`
+	Message int                                `json:"message,omitempty"` // id of sent, edited, deleted or pinned message
+	Raw     tg.ChannelAdminLogEventActionClass `json:"raw,omitempty"`
+}
+
+// AdminLogEventNames returns a list of possible event types of admin log filter
+func AdminLogEventNames() []string {
+	return []string{
+		"join", "leave", "invite", "ban", "unban", "kick", "unkick", "promote", "demote",
+		"info", "settings", "pinned", "edit", "delete", "group_call", "invites", "send", "forums", "sub_extend",
+	}
+}
+
+func adminLogFilter(events []string) (*tg.ChannelAdminLogEventsFilter, error) {
+	f := &tg.ChannelAdminLogEventsFilter{}
+	fields := map[string]*bool{
+		"join":       &f.Join,
+		"leave":      &f.Leave,
+		"invite":     &f.Invite,
+		"ban":        &f.Ban,
+		"unban":      &f.Unban,
+		"kick":       &f.Kick,
+		"unkick":     &f.Unkick,
+		"promote":    &f.Promote,
+		"demote":     &f.Demote,
+		"info":       &f.Info,
+		"settings":   &f.Settings,
+		"pinned":     &f.Pinned,
+		"edit":       &f.Edit,
+		"delete":     &f.Delete,
+		"group_call": &f.GroupCall,
+		"invites":    &f.Invites,
+		"send":       &f.Send,
+		"forums":     &f.Forums,
+		"sub_extend": &f.SubExtend,
+	}
+
+	for _, event := range events {
+		field, ok := fields[strings.ToLower(event)]
+		if !ok {
+			return nil, fmt.Errorf("unknown event type %q, try [%s]", event, strings.Join(AdminLogEventNames(), ", "))
+		}
+		*field = true
+	}
+
+	return f, nil
+}
+
+func AdminLog(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts AdminLogOptions) (rerr error) {
+	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(c.API())
+	if opts.Chat == "" {
+		return fmt.Errorf("missing domain id")
+	}
+
+	p, err := tutil.GetInputPeer(ctx, manager, opts.Chat)
+	if err != nil {
+		return fmt.Errorf("failed to get peer: %w", err)
+	}
+
+	ch, ok := p.(peers.Channel)
+	if !ok {
+		return fmt.Errorf("invalid type of chat. channels/groups are supported only")
+	}
+
+	req := &tg.ChannelsGetAdminLogRequest{
+		Channel: ch.InputChannel(),
+		Q:       opts.Query,
+		Limit:   100,
+	}
+	if len(opts.Events) > 0 {
+		filter, err := adminLogFilter(opts.Events)
+		if err != nil {
+			return err
+		}
+		req.SetEventsFilter(*filter)
+	}
+	for _, admin := range opts.Admins {
+		a, err := tutil.GetInputPeer(ctx, manager, admin)
+		if err != nil {
+			return fmt.Errorf("failed to get admin %q: %w", admin, err)
+		}
+		u, ok := a.(peers.User)
+		if !ok {
+			return fmt.Errorf("admin %q is not a user", admin)
+		}
+		req.Admins = append(req.Admins, u.InputUser())
+	}
+
+	color.Yellow("WARN: Admin log only keeps events of the last 48 hours, and chat administrator permission is required.")
+	color.Cyan("Occasional suspensions are due to Telegram rate limitations, please wait a moment.")
+	fmt.Println()
+
+	f, err := os.Create(opts.Output)
+	if err != nil {
+		return err
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
+
+	pw := prog.New(progress.FormatNumber)
+	pw.SetUpdateFrequency(200 * time.Millisecond)
+	pw.Style().Visibility.TrackerOverall = false
+	pw.Style().Visibility.ETA = false
+	pw.Style().Visibility.Percentage = false
+
+	tracker := prog.AppendTracker(pw, progress.FormatNumber, fmt.Sprintf("%s-%d", ch.VisibleName(), ch.ID()), 0)
+
+	go pw.Render()
+
+	if err = writeAdminLog(ctx, f, c.API(), newSenders(manager, ch), ch.ID(), req, tracker, opts.Raw); err != nil {
+		return err
+	}
+
+	tracker.MarkAsDone()
+	prog.Wait(ctx, pw)
+	return nil
+}
+
+// writeAdminLog writes all events of the request to w as JSON
+func writeAdminLog(ctx context.Context, w io.Writer, client *tg.Client, snd *senders, id int64,
+	req *tg.ChannelsGetAdminLogRequest, tracker *progress.Tracker, raw bool,
+) (rerr error) {
+	enc := jx.NewStreamingEncoder(w, 512)
+	defer multierr.AppendInvoke(&rerr, multierr.Close(enc))
+
+	enc.ObjStart()
+	defer enc.ObjEnd()
+	enc.Field("id", func(e *jx.Encoder) { e.Int64(id) })
+
+	enc.FieldStart("events")
+	enc.ArrStart()
+	defer enc.ArrEnd()
+
+	count := int64(0)
+
+	// events are from newest to oldest, so page by the last event id
+	for {
+		res, err := client.ChannelsGetAdminLog(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to get admin log: %w", err)
+		}
+		// ids must decrease, otherwise the same page is returned forever
+		if len(res.Events) == 0 || (req.MaxID != 0 && res.Events[0].ID >= req.MaxID) {
+			break
+		}
+
+		entities := peer.EntitiesFromResult(res)
+		for _, e := range res.Events {
+			event := adminLogEvent(ctx, snd, e, entities)
+			if raw {
+				event.Raw = e.Action
+			}
+
+			b, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("failed to marshal event: %w", err)
+			}
+			enc.Raw(b)
+
+			count++
+			tracker.SetValue(count)
+		}
+
+		// the last page is shorter than limit
+		if len(res.Events) < req.Limit {
+			break
+		}
+		req.MaxID = res.Events[len(res.Events)-1].ID
+	}
+
+	return nil
+}
+
+func adminLogEvent(ctx context.Context, snd *senders, e tg.ChannelAdminLogEvent, entities peer.Entities) *AdminLogEvent {
+	event := &AdminLogEvent{
+		ID:     e.ID,
+		Date:   e.Date,
+		User:   snd.resolve(ctx, &tg.PeerUser{UserID: e.UserID}, entities),
+		Action: snakeCase(strings.TrimPrefix(e.Action.TypeName(), "channelAdminLogEventAction")),
+	}
+
+	var target tg.ChannelParticipantClass
+	switch a := e.Action.(type) {
+	case *tg.ChannelAdminLogEventActionParticipantInvite:
+		target = a.Participant
+	case *tg.ChannelAdminLogEventActionParticipantToggleBan:
+		target = a.NewParticipant
+	case *tg.ChannelAdminLogEventActionParticipantToggleAdmin:
+		target = a.NewParticipant
+	case *tg.ChannelAdminLogEventActionParticipantSubExtend:
+		target = a.NewParticipant
+	case *tg.ChannelAdminLogEventActionSendMessage:
+		event.Message = a.Message.GetID()
+	case *tg.ChannelAdminLogEventActionEditMessage:
+		event.Message = a.NewMessage.GetID()
+	case *tg.ChannelAdminLogEventActionDeleteMessage:
+		event.Message = a.Message.GetID()
+	case *tg.ChannelAdminLogEventActionUpdatePinned:
+		event.Message = a.Message.GetID()
+	}
+
+	if from := participantPeer(target); from != nil {
+		event.Target = snd.resolve(ctx, from, entities)
+	}
+
+	return event
+}
+
+// participantPeer returns peer of the participant, or nil if participant is nil
+func participantPeer(p tg.ChannelParticipantClass) tg.PeerClass {
+	switch p := p.(type) {
+	case *tg.ChannelParticipant:
+		return &tg.PeerUser{UserID: p.UserID}
+	case *tg.ChannelParticipantSelf:
+		return &tg.PeerUser{UserID: p.UserID}
+	case *tg.ChannelParticipantCreator:
+		return &tg.PeerUser{UserID: p.UserID}
+	case *tg.ChannelParticipantAdmin:
+		return &tg.PeerUser{UserID: p.UserID}
+	case *tg.ChannelParticipantBanned:
+		return p.Peer
+	case *tg.ChannelParticipantLeft:
+		return p.Peer
+	}
+
+	return nil
+}
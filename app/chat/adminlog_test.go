@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminLogFilter(t *testing.T) {
+	f, err := adminLogFilter([]string{"join", "BAN", "group_call"})
+	require.NoError(t, err)
+	assert.Equal(t, &tg.ChannelAdminLogEventsFilter{Join: true, Ban: true, GroupCall: true}, f)
+
+	f, err = adminLogFilter(nil)
+	require.NoError(t, err)
+	assert.Equal(t, &tg.ChannelAdminLogEventsFilter{}, f)
+
+	// every listed name is accepted
+	_, err = adminLogFilter(AdminLogEventNames())
+	require.NoError(t, err)
+
+	_, err = adminLogFilter([]string{"join", "unknown"})
+	assert.ErrorContains(t, err, `unknown event type "unknown"`)
+}
+
+func TestParticipantPeer(t *testing.T) {
+	tests := []struct {
+		name        string
+		participant tg.ChannelParticipantClass
+		want        tg.PeerClass
+	}{
+		{name: "nil", participant: nil, want: nil},
+		{name: "participant", participant: &tg.ChannelParticipant{UserID: 1}, want: &tg.PeerUser{UserID: 1}},
+		{name: "self", participant: &tg.ChannelParticipantSelf{UserID: 2}, want: &tg.PeerUser{UserID: 2}},
+		{name: "creator", participant: &tg.ChannelParticipantCreator{UserID: 3}, want: &tg.PeerUser{UserID: 3}},
+		{name: "admin", participant: &tg.ChannelParticipantAdmin{UserID: 4}, want: &tg.PeerUser{UserID: 4}},
+		{name: "banned channel", participant: &tg.ChannelParticipantBanned{Peer: &tg.PeerChannel{ChannelID: 5}}, want: &tg.PeerChannel{ChannelID: 5}},
+		{name: "left", participant: &tg.ChannelParticipantLeft{Peer: &tg.PeerUser{UserID: 6}}, want: &tg.PeerUser{UserID: 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, participantPeer(tt.participant))
+		})
+	}
+}
+
+func TestAdminLogEvent(t *testing.T) {
+	manager := peers.Options{}.Build(tg.NewClient(nil))
+	snd := newSenders(manager, manager.Channel(&tg.Channel{ID: 100, Title: "tdl"}))
+
+	admin := &tg.User{ID: 1, FirstName: "Admin"}
+	member := &tg.User{ID: 2, FirstName: "Member"}
+	entities := peer.NewEntities(map[int64]*tg.User{admin.ID: admin, member.ID: member}, map[int64]*tg.Chat{}, map[int64]*tg.Channel{})
+
+	adminSender := &Sender{ID: 1, Type: "user", Name: "Admin"}
+	memberSender := &Sender{ID: 2, Type: "user", Name: "Member"}
+
+	tests := []struct {
+		name    string
+		action  tg.ChannelAdminLogEventActionClass
+		want    string
+		target  *Sender
+		message int
+	}{
+		{
+			name: "join", action: &tg.ChannelAdminLogEventActionParticipantJoin{},
+			want: "participant_join",
+		},
+		{
+			name: "invite", action: &tg.ChannelAdminLogEventActionParticipantInvite{Participant: &tg.ChannelParticipant{UserID: 2}},
+			want: "participant_invite", target: memberSender,
+		},
+		{
+			name: "ban", action: &tg.ChannelAdminLogEventActionParticipantToggleBan{
+				PrevParticipant: &tg.ChannelParticipant{UserID: 1},
+				NewParticipant:  &tg.ChannelParticipantBanned{Peer: &tg.PeerUser{UserID: 2}},
+			},
+			want: "participant_toggle_ban", target: memberSender,
+		},
+		{
+			name: "promote", action: &tg.ChannelAdminLogEventActionParticipantToggleAdmin{
+				PrevParticipant: &tg.ChannelParticipant{UserID: 1},
+				NewParticipant:  &tg.ChannelParticipantAdmin{UserID: 2},
+			},
+			want: "participant_toggle_admin", target: memberSender,
+		},
+		{
+			name: "send", action: &tg.ChannelAdminLogEventActionSendMessage{Message: &tg.Message{ID: 10}},
+			want: "send_message", message: 10,
+		},
+		{
+			name: "edit", action: &tg.ChannelAdminLogEventActionEditMessage{
+				PrevMessage: &tg.Message{ID: 11}, NewMessage: &tg.Message{ID: 11, Message: "new"},
+			},
+			want: "edit_message", message: 11,
+		},
+		{
+			name: "delete", action: &tg.ChannelAdminLogEventActionDeleteMessage{Message: &tg.Message{ID: 12}},
+			want: "delete_message", message: 12,
+		},
+		{
+			name: "pin", action: &tg.ChannelAdminLogEventActionUpdatePinned{Message: &tg.Message{ID: 13}},
+			want: "update_pinned", message: 13,
+		},
+		{
+			name: "unpin", action: &tg.ChannelAdminLogEventActionUpdatePinned{Message: &tg.MessageEmpty{ID: 14}},
+			want: "update_pinned", message: 14,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := adminLogEvent(context.Background(), snd, tg.ChannelAdminLogEvent{
+				ID: 7, Date: 8, UserID: admin.ID, Action: tt.action,
+			}, entities)
+
+			assert.Equal(t, &AdminLogEvent{
+				ID:      7,
+				Date:    8,
+				User:    adminSender,
+				Action:  tt.want,
+				Target:  tt.target,
+				Message: tt.message,
+			}, event)
+		})
+	}
+}
+
+func TestWriteAdminLog(t *testing.T) {
+	events := func(ids ...int64) []tg.ChannelAdminLogEvent {
+		e := make([]tg.ChannelAdminLogEvent, 0, len(ids))
+		for _, id := range ids {
+			e = append(e, tg.ChannelAdminLogEvent{ID: id, UserID: 1, Action: &tg.ChannelAdminLogEventActionParticipantJoin{}})
+		}
+		return e
+	}
+
+	tests := []struct {
+		name   string
+		pages  map[int64][]tg.ChannelAdminLogEvent // max id -> events
+		maxIDs []int64                             // max id of each request
+		want   []int64
+	}{
+		{
+			name:   "empty",
+			pages:  map[int64][]tg.ChannelAdminLogEvent{0: nil},
+			maxIDs: []int64{0},
+			want:   []int64{},
+		},
+		{
+			name:   "last page is shorter than limit",
+			pages:  map[int64][]tg.ChannelAdminLogEvent{0: events(50, 40), 40: events(30, 20), 20: events(10)},
+			maxIDs: []int64{0, 40, 20},
+			want:   []int64{50, 40, 30, 20, 10},
+		},
+		{
+			name:   "last page is empty",
+			pages:  map[int64][]tg.ChannelAdminLogEvent{0: events(50, 40), 40: nil},
+			maxIDs: []int64{0, 40},
+			want:   []int64{50, 40},
+		},
+		{
+			name:   "max id is ignored",
+			pages:  map[int64][]tg.ChannelAdminLogEvent{0: events(50, 40), 40: events(50, 40)},
+			maxIDs: []int64{0, 40},
+			want:   []int64{50, 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxIDs := make([]int64, 0)
+			client := tg.NewClient(invokerFunc(func(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+				req, ok := input.(*tg.ChannelsGetAdminLogRequest)
+				if !ok {
+					return errors.New("unexpected request")
+				}
+				maxIDs = append(maxIDs, req.MaxID)
+				if len(maxIDs) > 10 {
+					return errors.New("too many requests")
+				}
+
+				return reply(output, &tg.ChannelsAdminLogResults{
+					Events: tt.pages[req.MaxID],
+					Users:  []tg.UserClass{&tg.User{ID: 1, FirstName: "Admin"}},
+				})
+			}))
+
+			manager := peers.Options{}.Build(client)
+			snd := newSenders(manager, manager.Channel(&tg.Channel{ID: 100}))
+			req := &tg.ChannelsGetAdminLogRequest{Channel: &tg.InputChannel{ChannelID: 100}, Limit: 2}
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, writeAdminLog(context.Background(), buf, client, snd, 100, req, &progress.Tracker{}, false))
+			assert.Equal(t, tt.maxIDs, maxIDs)
+
+			var out struct {
+				ID     int64           `json:"id"`
+				Events []AdminLogEvent `json:"events"`
+			}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+			assert.Equal(t, int64(100), out.ID)
+
+			ids := make([]int64, 0, len(out.Events))
+			for _, e := range out.Events {
+				ids = append(ids, e.ID)
+				assert.Equal(t, &Sender{ID: 1, Type: "user", Name: "Admin"}, e.User)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr/vm"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/jedib0t/go-pretty/v6/progress"
+
+	"github.com/iyear/tdl/pkg/texpr"
+)
+
+// analyticsRow is a snapshot of message statistics. Rows of each run are appended
+// to the same output, so the output is a time series of messages.
+type analyticsRow struct {
+	Time      int64          `json:"time"` // snapshot time
+	Chat      int64          `json:"chat"`
+	ID        int            `json:"id"`
+	Date      int            `json:"date"`
+	EditDate  int            `json:"edit_date,omitempty"`
+	Views     int            `json:"views"`
+	Forwards  int            `json:"forwards"`
+	Replies   int            `json:"replies"`
+	Reactions map[string]int `json:"reactions,omitempty"` // count of each reaction, e.g. 👍, custom_emoji:ID, paid
+}
+
+var analyticsHeader = []string{"time", "chat", "id", "date", "edit_date", "views", "forwards", "replies", "reactions", "reaction_counts"}
+
+func newAnalyticsRow(now time.Time, chat int64, m *tg.Message) *analyticsRow {
+	row := &analyticsRow{
+		Time:     now.Unix(),
+		Chat:     chat,
+		ID:       m.ID,
+		Date:     m.Date,
+		EditDate: m.EditDate,
+		Views:    m.Views,
+		Forwards: m.Forwards,
+		Replies:  m.Replies.Replies,
+	}
+
+	for _, r := range m.Reactions.Results {
+		if row.Reactions == nil {
+			row.Reactions = make(map[string]int)
+		}
+		row.Reactions[reactionKey(r.Reaction)] += r.Count
+	}
+
+	return row
+}
+
+// reactionKey returns emoji of the reaction, or type of the reaction if it's not an emoji
+func reactionKey(r tg.ReactionClass) string {
+	switch rr := r.(type) {
+	case *tg.ReactionEmoji:
+		return rr.Emoticon
+	case *tg.ReactionCustomEmoji:
+		return "custom_emoji:" + strconv.FormatInt(rr.DocumentID, 10)
+	case *tg.ReactionPaid:
+		return "paid"
+	}
+	return "unknown"
+}
+
+// csvRecord returns record of the row in the order of analyticsHeader.
+// reaction_counts is like '👍=3 ❤=1', sorted by count in descending order.
+func (r *analyticsRow) csvRecord() []string {
+	keys := make([]string, 0, len(r.Reactions))
+	total := 0
+	for k, n := range r.Reactions {
+		keys = append(keys, k)
+		total += n
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if r.Reactions[keys[i]] != r.Reactions[keys[j]] {
+			return r.Reactions[keys[i]] > r.Reactions[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	counts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		counts = append(counts, fmt.Sprintf("%s=%d", k, r.Reactions[k]))
+	}
+
+	return []string{
+		strconv.FormatInt(r.Time, 10),
+		strconv.FormatInt(r.Chat, 10),
+		strconv.Itoa(r.ID),
+		strconv.Itoa(r.Date),
+		strconv.Itoa(r.EditDate),
+		strconv.Itoa(r.Views),
+		strconv.Itoa(r.Forwards),
+		strconv.Itoa(r.Replies),
+		strconv.Itoa(total),
+		strings.Join(counts, " "),
+	}
+}
+
+// exportAnalytics appends a snapshot of statistics of messages to w in csv or jsonl.
+// header indicates whether the csv header should be written, e.g. the output is empty.
+func exportAnalytics(ctx context.Context, w io.Writer, header bool, iter *messages.Iterator, id int64,
+	filter *vm.Program, inc *incremental, tracker *progress.Tracker, opts ExportOptions,
+) error {
+	var (
+		write func(row *analyticsRow) error
+		flush = func() error { return nil }
+	)
+
+	switch opts.Format {
+	case ExportFormatCsv:
+		cw := csv.NewWriter(w)
+		flush = func() error { cw.Flush(); return cw.Error() }
+
+		if header {
+			if err := cw.Write(analyticsHeader); err != nil {
+				return err
+			}
+		}
+		write = func(row *analyticsRow) error { return cw.Write(row.csvRecord()) }
+	case ExportFormatJsonl:
+		enc := json.NewEncoder(w)
+		write = func(row *analyticsRow) error { return enc.Encode(row) }
+	default:
+		return fmt.Errorf("unknown analytics format: %s", opts.Format)
+	}
+
+	now, count := time.Now(), int64(0)
+	for iter.Next(ctx) {
+		msg := iter.Value()
+		if inc.stop(msg.Msg, opts.outOfRange(msg.Msg, count)) {
+			break
+		}
+
+		// service messages have no statistics
+		m, ok := msg.Msg.(*tg.Message)
+		if !ok {
+			continue
+		}
+
+		b, err := texpr.Run(filter, texpr.ConvertEnvMessage(m))
+		if err != nil {
+			return fmt.Errorf("failed to run filter: %w", err)
+		}
+		if !b.(bool) { // filtered
+			continue
+		}
+
+		if err = write(newAnalyticsRow(now, id, m)); err != nil {
+			return fmt.Errorf("failed to write message %d: %w", m.ID, err)
+		}
+
+		count++
+		tracker.SetValue(count)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/gotd/td/tg"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReactionKey(t *testing.T) {
+	tests := []struct {
+		reaction tg.ReactionClass
+		want     string
+	}{
+		{reaction: &tg.ReactionEmoji{Emoticon: "👍"}, want: "👍"},
+		{reaction: &tg.ReactionCustomEmoji{DocumentID: 42}, want: "custom_emoji:42"},
+		{reaction: &tg.ReactionPaid{}, want: "paid"},
+		{reaction: &tg.ReactionEmpty{}, want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, reactionKey(tt.reaction))
+		})
+	}
+}
+
+func TestNewAnalyticsRow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name string
+		msg  *tg.Message
+		want *analyticsRow
+	}{
+		{
+			name: "no statistics",
+			msg:  &tg.Message{ID: 1, Date: 10},
+			want: &analyticsRow{Time: now.Unix(), Chat: 100, ID: 1, Date: 10},
+		},
+		{
+			name: "statistics and reactions",
+			msg: &tg.Message{
+				ID: 2, Date: 10, EditDate: 20, Views: 300, Forwards: 4,
+				Replies: tg.MessageReplies{Replies: 5},
+				Reactions: tg.MessageReactions{Results: []tg.ReactionCount{
+					{Reaction: &tg.ReactionEmoji{Emoticon: "👍"}, Count: 3},
+					{Reaction: &tg.ReactionCustomEmoji{DocumentID: 42}, Count: 2},
+					{Reaction: &tg.ReactionPaid{}, Count: 7},
+					{Reaction: &tg.ReactionEmoji{Emoticon: "👍"}, Count: 1}, // counted together
+				}},
+			},
+			want: &analyticsRow{
+				Time: now.Unix(), Chat: 100, ID: 2, Date: 10, EditDate: 20,
+				Views: 300, Forwards: 4, Replies: 5,
+				Reactions: map[string]int{"👍": 4, "custom_emoji:42": 2, "paid": 7},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newAnalyticsRow(now, 100, tt.msg))
+		})
+	}
+}
+
+func TestAnalyticsRowCSVRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		row  *analyticsRow
+		want []string
+	}{
+		{
+			name: "no reactions",
+			row:  &analyticsRow{Time: 1, Chat: 100, ID: 2, Date: 3, Views: 4},
+			want: []string{"1", "100", "2", "3", "0", "4", "0", "0", "0", ""},
+		},
+		{
+			name: "sorted by count then key",
+			row: &analyticsRow{
+				Time: 1, Chat: 100, ID: 2, Date: 3, EditDate: 5, Views: 4, Forwards: 6, Replies: 7,
+				Reactions: map[string]int{"❤": 1, "paid": 3, "👍": 3, "custom_emoji:42": 1},
+			},
+			want: []string{"1", "100", "2", "3", "5", "4", "6", "7", "8", "paid=3 👍=3 custom_emoji:42=1 ❤=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.row.csvRecord()
+			assert.Len(t, record, len(analyticsHeader))
+			assert.Equal(t, tt.want, record)
+		})
+	}
+}
+
+func TestExportAnalytics(t *testing.T) {
+	msgs := []tg.MessageClass{
+		&tg.MessageService{ID: 3, Action: &tg.MessageActionPinMessage{}},
+		&tg.Message{ID: 2, Views: 20},
+		&tg.Message{ID: 1, Views: 10},
+	}
+
+	filter, err := expr.Compile("true", expr.AsBool())
+	require.NoError(t, err)
+
+	export := func(format ExportFormat, header bool) string {
+		buf := &bytes.Buffer{}
+		require.NoError(t, exportAnalytics(context.Background(), buf, header, history(msgs), 100,
+			filter, nil, &progress.Tracker{}, ExportOptions{Type: ExportTypeLast, Format: format, Input: []int{100}}))
+		return buf.String()
+	}
+
+	// header is only written to the empty output
+	lines := strings.Split(strings.TrimSpace(export(ExportFormatCsv, true)), "\n")
+	require.Len(t, lines, 3) // service messages have no statistics
+	assert.Equal(t, strings.Join(analyticsHeader, ","), lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], ",100,2,0,0,20,0,0,0,"), lines[1])
+
+	lines = strings.Split(strings.TrimSpace(export(ExportFormatCsv, false)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], ",100,2,0,0,20,0,0,0,"), lines[0])
+
+	lines = strings.Split(strings.TrimSpace(export(ExportFormatJsonl, true)), "\n")
+	require.Len(t, lines, 2)
+	var row analyticsRow
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+	assert.Equal(t, 1, row.ID)
+	assert.Equal(t, 10, row.Views)
+}
@@ -0,0 +1,513 @@
+package chat
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/expr-lang/expr/vm"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/tmedia"
+	"github.com/iyear/tdl/pkg/texpr"
+)
+
+// ArchiveMessage is the message of archive export, which is compatible with result.json of Telegram Desktop
+type ArchiveMessage struct {
+	ID             int    `json:"id"`
+	Type           string `json:"type"` // message or service
+	Date           string `json:"date"`
+	DateUnixtime   string `json:"date_unixtime"`
+	Edited         string `json:"edited,omitempty"`
+	EditedUnixtime string `json:"edited_unixtime,omitempty"`
+
+	// sender of message
+	From   string  `json:"from,omitempty"`
+	FromID string  `json:"from_id,omitempty"`
+	Author string  `json:"author,omitempty"` // signature of channel post
+	Sender *Sender `json:"sender,omitempty"` // sender details, only exported with sender
+
+	// sender and action of service message
+	Actor     string   `json:"actor,omitempty"`
+	ActorID   string   `json:"actor_id,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Members   []string `json:"members,omitempty"`
+	MessageID int      `json:"message_id,omitempty"`
+
+	ForwardedFrom    string `json:"forwarded_from,omitempty"`
+	ReplyToMessageID int    `json:"reply_to_message_id,omitempty"`
+	ReplyToPeerID    string `json:"reply_to_peer_id,omitempty"`
+	ViaBot           string `json:"via_bot,omitempty"`
+
+	// media references, files are not downloaded, so they are names of media
+	Photo               string              `json:"photo,omitempty"`
+	PhotoFileSize       int64               `json:"photo_file_size,omitempty"`
+	File                string              `json:"file,omitempty"`
+	FileName            string              `json:"file_name,omitempty"`
+	FileSize            int64               `json:"file_size,omitempty"`
+	MediaType           string              `json:"media_type,omitempty"`
+	MimeType            string              `json:"mime_type,omitempty"`
+	StickerEmoji        string              `json:"sticker_emoji,omitempty"`
+	DurationSeconds     int                 `json:"duration_seconds,omitempty"`
+	Width               int                 `json:"width,omitempty"`
+	Height              int                 `json:"height,omitempty"`
+	Poll                *ArchivePoll        `json:"poll,omitempty"`
+	ContactInformation  *ArchiveContact     `json:"contact_information,omitempty"`
+	LocationInformation *ArchiveLocation    `json:"location_information,omitempty"`
+	PlaceName           string              `json:"place_name,omitempty"`
+	Address             string              `json:"address,omitempty"`
+	LiveLocationPeriod  int                 `json:"live_location_period_seconds,omitempty"`
+	Reactions           []ArchiveReaction   `json:"reactions,omitempty"`
+	Text                interface{}         `json:"text"` // string, or array of string and TextEntity
+	TextEntities        []ArchiveTextEntity `json:"text_entities"`
+}
+
+type ArchiveTextEntity struct {
+	Type       string `json:"type"`
+	Text       string `json:"text"`
+	Href       string `json:"href,omitempty"`
+	UserID     int64  `json:"user_id,omitempty"`
+	Language   string `json:"language,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+}
+
+type ArchivePoll struct {
+	Question    string              `json:"question"`
+	Closed      bool                `json:"closed"`
+	TotalVoters int                 `json:"total_voters"`
+	Answers     []ArchivePollAnswer `json:"answers"`
+}
+
+type ArchivePollAnswer struct {
+	Text   string `json:"text"`
+	Voters int    `json:"voters"`
+	Chosen bool   `json:"chosen"`
+}
+
+type ArchiveContact struct {
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+type ArchiveLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type ArchiveReaction struct {
+	Type       string `json:"type"` // emoji, custom_emoji or paid
+	Count      int    `json:"count"`
+	Emoji      string `json:"emoji,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+}
+
+// filterArchive runs filter on all messages. Service messages only have ID, Date and FromID fields.
+func filterArchive(filter *vm.Program, msg tg.NotEmptyMessage) (bool, error) {
+	m, ok := msg.(*tg.Message)
+	if !ok {
+		s, ok := msg.(*tg.MessageService)
+		if !ok {
+			return false, nil
+		}
+		m = &tg.Message{ID: s.ID, Date: s.Date, FromID: s.FromID, PeerID: s.PeerID}
+	}
+
+	b, err := texpr.Run(filter, texpr.ConvertEnvMessage(m))
+	if err != nil {
+		return false, err
+	}
+	return b.(bool), nil
+}
+
+// archiveChatType returns chat type in the same format as Telegram Desktop
+func archiveChatType(p peers.Peer) string {
+	switch p := p.(type) {
+	case peers.User:
+		switch {
+		case p.Raw().Self:
+			return "saved_messages"
+		case p.Raw().Bot:
+			return "bot_chat"
+		}
+		return "personal_chat"
+	case peers.Chat:
+		return "private_group"
+	case peers.Channel:
+		visibility := "private"
+		if _, ok := p.Username(); ok {
+			visibility = "public"
+		}
+		if p.IsBroadcast() {
+			return visibility + "_channel"
+		}
+		return visibility + "_supergroup"
+	}
+
+	return "unknown"
+}
+
+// archiver converts messages to archive format. chat is the peer of messages,
+// which is the sender of channel posts.
+type archiver struct {
+	chat peers.Peer
+}
+
+func (a *archiver) message(msg tg.NotEmptyMessage, entities peer.Entities) *ArchiveMessage {
+	switch m := msg.(type) {
+	case *tg.Message:
+		return a.regular(m, entities)
+	case *tg.MessageService:
+		return a.service(m, entities)
+	}
+
+	return nil
+}
+
+func (a *archiver) regular(m *tg.Message, entities peer.Entities) *ArchiveMessage {
+	t := &ArchiveMessage{ID: m.ID, Type: "message"}
+	setDate(&t.Date, &t.DateUnixtime, m.Date)
+	if d, ok := m.GetEditDate(); ok && !m.EditHide {
+		setDate(&t.Edited, &t.EditedUnixtime, d)
+	}
+
+	t.From, t.FromID = a.sender(m.FromID, entities)
+	t.Author = m.PostAuthor
+
+	if fwd, ok := m.GetFwdFrom(); ok {
+		t.ForwardedFrom = fwd.FromName
+		if from, ok := fwd.GetFromID(); ok && t.ForwardedFrom == "" {
+			t.ForwardedFrom, _ = peerName(from, entities)
+		}
+	}
+
+	if r, ok := m.ReplyTo.(*tg.MessageReplyHeader); ok {
+		t.ReplyToMessageID = r.ReplyToMsgID
+		if p, ok := r.GetReplyToPeerID(); ok {
+			_, t.ReplyToPeerID = peerName(p, entities)
+		}
+	}
+
+	if id, ok := m.GetViaBotID(); ok {
+		if u, ok := entities.User(id); ok {
+			t.ViaBot = "@" + u.Username
+		}
+	}
+
+	setMedia(t, m.Media)
+	t.Text, t.TextEntities = archiveText(m.Message, m.Entities)
+
+	for _, r := range m.Reactions.Results {
+		reaction := ArchiveReaction{Count: r.Count}
+		switch rr := r.Reaction.(type) {
+		case *tg.ReactionEmoji:
+			reaction.Type, reaction.Emoji = "emoji", rr.Emoticon
+		case *tg.ReactionCustomEmoji:
+			reaction.Type, reaction.DocumentID = "custom_emoji", strconv.FormatInt(rr.DocumentID, 10)
+		case *tg.ReactionPaid:
+			reaction.Type = "paid"
+		default:
+			continue
+		}
+		t.Reactions = append(t.Reactions, reaction)
+	}
+
+	return t
+}
+
+func (a *archiver) service(m *tg.MessageService, entities peer.Entities) *ArchiveMessage {
+	t := &ArchiveMessage{ID: m.ID, Type: "service"}
+	setDate(&t.Date, &t.DateUnixtime, m.Date)
+
+	t.Actor, t.ActorID = a.sender(m.FromID, entities)
+	t.Text, t.TextEntities = archiveText("", nil)
+
+	members := func(ids []int64) []string {
+		names := make([]string, 0, len(ids))
+		for _, id := range ids {
+			name, _ := peerName(&tg.PeerUser{UserID: id}, entities)
+			names = append(names, name)
+		}
+		return names
+	}
+
+	switch act := m.Action.(type) {
+	case *tg.MessageActionChatCreate:
+		t.Action, t.Title, t.Members = "create_group", act.Title, members(act.Users)
+	case *tg.MessageActionChannelCreate:
+		t.Action, t.Title = "create_channel", act.Title
+	case *tg.MessageActionChatEditTitle:
+		t.Action, t.Title = "edit_group_title", act.Title
+	case *tg.MessageActionChatEditPhoto:
+		t.Action = "edit_group_photo"
+	case *tg.MessageActionChatDeletePhoto:
+		t.Action = "delete_group_photo"
+	case *tg.MessageActionChatAddUser:
+		t.Action, t.Members = "invite_members", members(act.Users)
+	case *tg.MessageActionChatDeleteUser:
+		t.Action, t.Members = "remove_members", members([]int64{act.UserID})
+	case *tg.MessageActionChatJoinedByLink:
+		t.Action = "join_group_by_link"
+	case *tg.MessageActionChatJoinedByRequest:
+		t.Action = "join_group_by_request"
+	case *tg.MessageActionChatMigrateTo:
+		t.Action = "migrate_to_supergroup"
+	case *tg.MessageActionChannelMigrateFrom:
+		t.Action, t.Title = "migrate_from_group", act.Title
+	case *tg.MessageActionPinMessage:
+		t.Action = "pin_message"
+		if r, ok := m.ReplyTo.(*tg.MessageReplyHeader); ok {
+			t.MessageID = r.ReplyToMsgID
+		}
+	case *tg.MessageActionHistoryClear:
+		t.Action = "clear_history"
+	case *tg.MessageActionPhoneCall:
+		t.Action, t.DurationSeconds = "phone_call", act.Duration
+	case *tg.MessageActionGroupCall:
+		t.Action, t.DurationSeconds = "group_call", act.Duration
+	case *tg.MessageActionScreenshotTaken:
+		t.Action = "take_screenshot"
+	case *tg.MessageActionTopicCreate:
+		t.Action, t.Title = "topic_created", act.Title
+	case *tg.MessageActionTopicEdit:
+		t.Action, t.Title = "topic_edit", act.Title
+	default:
+		t.Action = snakeCase(strings.TrimPrefix(m.Action.TypeName(), "messageAction"))
+	}
+
+	return t
+}
+
+// sender returns name and id of sender. Sender of channel posts is the channel itself.
+func (a *archiver) sender(from tg.PeerClass, entities peer.Entities) (string, string) {
+	if from == nil {
+		return a.chat.VisibleName(), archivePeerID(a.chat)
+	}
+	return peerName(from, entities)
+}
+
+func archivePeerID(p peers.Peer) string {
+	switch p.(type) {
+	case peers.User:
+		return "user" + strconv.FormatInt(p.ID(), 10)
+	case peers.Chat:
+		return "chat" + strconv.FormatInt(p.ID(), 10)
+	default:
+		return "channel" + strconv.FormatInt(p.ID(), 10)
+	}
+}
+
+// peerName returns name and id of peer in the same format as Telegram Desktop, e.g. user123
+func peerName(p tg.PeerClass, entities peer.Entities) (string, string) {
+	switch p := p.(type) {
+	case *tg.PeerUser:
+		name := ""
+		if u, ok := entities.User(p.UserID); ok {
+			name = visibleName(u.FirstName, u.LastName)
+		}
+		return name, "user" + strconv.FormatInt(p.UserID, 10)
+	case *tg.PeerChat:
+		name := ""
+		if c, ok := entities.Chat(p.ChatID); ok {
+			name = c.Title
+		}
+		return name, "chat" + strconv.FormatInt(p.ChatID, 10)
+	case *tg.PeerChannel:
+		name := ""
+		if c, ok := entities.Channel(p.ChannelID); ok {
+			name = c.Title
+		}
+		return name, "channel" + strconv.FormatInt(p.ChannelID, 10)
+	}
+
+	return "", ""
+}
+
+func setDate(date, unix *string, t int) {
+	*date = time.Unix(int64(t), 0).Format("2006-01-02T15:04:05")
+	*unix = strconv.Itoa(t)
+}
+
+func setMedia(t *ArchiveMessage, media tg.MessageMediaClass) {
+	switch m := media.(type) {
+	case *tg.MessageMediaPhoto:
+		info, ok := tmedia.GetPhotoInfo(m)
+		if !ok {
+			return
+		}
+		t.Photo, t.PhotoFileSize = info.Name, info.Size
+		if p, ok := m.Photo.(*tg.Photo); ok && len(p.Sizes) > 0 {
+			switch s := p.Sizes[len(p.Sizes)-1].(type) {
+			case *tg.PhotoSize:
+				t.Width, t.Height = s.W, s.H
+			case *tg.PhotoSizeProgressive:
+				t.Width, t.Height = s.W, s.H
+			}
+		}
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return
+		}
+		t.File = tmedia.GetDocumentName(doc)
+		t.FileSize, t.MimeType = doc.Size, doc.MimeType
+
+		for _, attr := range doc.Attributes {
+			switch a := attr.(type) {
+			case *tg.DocumentAttributeFilename:
+				t.FileName = a.FileName
+			case *tg.DocumentAttributeSticker:
+				t.MediaType, t.StickerEmoji = "sticker", a.Alt
+			case *tg.DocumentAttributeAnimated:
+				t.MediaType = "animation"
+			case *tg.DocumentAttributeVideo:
+				if t.MediaType == "" {
+					t.MediaType = "video_file"
+					if a.RoundMessage {
+						t.MediaType = "video_message"
+					}
+				}
+				t.DurationSeconds, t.Width, t.Height = int(a.Duration), a.W, a.H
+			case *tg.DocumentAttributeAudio:
+				t.MediaType = "audio_file"
+				if a.Voice {
+					t.MediaType = "voice_message"
+				}
+				t.DurationSeconds = a.Duration
+			case *tg.DocumentAttributeImageSize:
+				t.Width, t.Height = a.W, a.H
+			}
+		}
+	case *tg.MessageMediaPoll:
+		poll := &ArchivePoll{
+			Question:    m.Poll.Question.Text,
+			Closed:      m.Poll.Closed,
+			TotalVoters: m.Results.TotalVoters,
+		}
+		for _, answer := range m.Poll.Answers {
+			pa := ArchivePollAnswer{Text: answer.Text.Text}
+			for _, r := range m.Results.Results {
+				if string(r.Option) == string(answer.Option) {
+					pa.Voters, pa.Chosen = r.Voters, r.Chosen
+				}
+			}
+			poll.Answers = append(poll.Answers, pa)
+		}
+		t.Poll = poll
+	case *tg.MessageMediaContact:
+		t.ContactInformation = &ArchiveContact{
+			FirstName:   m.FirstName,
+			LastName:    m.LastName,
+			PhoneNumber: m.PhoneNumber,
+		}
+	case *tg.MessageMediaGeo:
+		t.LocationInformation = archiveLocation(m.Geo)
+	case *tg.MessageMediaGeoLive:
+		t.LocationInformation = archiveLocation(m.Geo)
+		t.LiveLocationPeriod = m.Period
+	case *tg.MessageMediaVenue:
+		t.LocationInformation = archiveLocation(m.Geo)
+		t.PlaceName, t.Address = m.Title, m.Address
+	}
+}
+
+func archiveLocation(geo tg.GeoPointClass) *ArchiveLocation {
+	g, ok := geo.AsNotEmpty()
+	if !ok {
+		return nil
+	}
+	return &ArchiveLocation{Latitude: g.Lat, Longitude: g.Long}
+}
+
+// archiveText renders text with entities to text array of Telegram Desktop. Text is
+// a plain string if there are no entities. Nested entities are flattened by the outer one.
+func archiveText(text string, entities []tg.MessageEntityClass) (interface{}, []ArchiveTextEntity) {
+	u := utf16.Encode([]rune(text))
+	sub := func(start, end int) string {
+		return string(utf16.Decode(u[start:end]))
+	}
+
+	sorted := make([]tg.MessageEntityClass, len(entities))
+	copy(sorted, entities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetOffset() < sorted[j].GetOffset()
+	})
+
+	result := make([]ArchiveTextEntity, 0, len(sorted)*2+1)
+	pos := 0
+	for _, ent := range sorted {
+		start, end := ent.GetOffset(), ent.GetOffset()+ent.GetLength()
+		if start < pos || end > len(u) {
+			continue // nested or invalid
+		}
+		if start > pos {
+			result = append(result, ArchiveTextEntity{Type: "plain", Text: sub(pos, start)})
+		}
+
+		e := ArchiveTextEntity{Text: sub(start, end)}
+		setEntityType(&e, ent)
+		result = append(result, e)
+		pos = end
+	}
+	if pos < len(u) {
+		result = append(result, ArchiveTextEntity{Type: "plain", Text: sub(pos, len(u))})
+	}
+
+	if len(result) == 0 {
+		return "", result
+	}
+	if len(result) == 1 && result[0].Type == "plain" {
+		return result[0].Text, result
+	}
+
+	arr := make([]interface{}, 0, len(result))
+	for _, e := range result {
+		if e.Type == "plain" {
+			arr = append(arr, e.Text)
+			continue
+		}
+		arr = append(arr, e)
+	}
+	return arr, result
+}
+
+func setEntityType(e *ArchiveTextEntity, ent tg.MessageEntityClass) {
+	switch ent := ent.(type) {
+	case *tg.MessageEntityURL:
+		e.Type = "link"
+	case *tg.MessageEntityTextURL:
+		e.Type, e.Href = "text_link", ent.URL
+	case *tg.MessageEntityMentionName:
+		e.Type, e.UserID = "mention_name", ent.UserID
+	case *tg.MessageEntityPre:
+		e.Type, e.Language = "pre", ent.Language
+	case *tg.MessageEntityCustomEmoji:
+		e.Type, e.DocumentID = "custom_emoji", strconv.FormatInt(ent.DocumentID, 10)
+	case *tg.MessageEntityStrike:
+		e.Type = "strikethrough"
+	default:
+		// e.g. messageEntityBotCommand -> bot_command
+		e.Type = snakeCase(strings.TrimPrefix(ent.TypeName(), "messageEntity"))
+	}
+}
+
+// snakeCase converts CamelCase to snake_case
+func snakeCase(s string) string {
+	b := &strings.Builder{}
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,322 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestArchiveText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tg.MessageEntityClass
+		want     interface{}
+		wantEnts []ArchiveTextEntity
+	}{
+		{
+			name: "empty", text: "",
+			want: "", wantEnts: []ArchiveTextEntity{},
+		},
+		{
+			name: "plain", text: "hello",
+			want: "hello", wantEnts: []ArchiveTextEntity{{Type: "plain", Text: "hello"}},
+		},
+		{
+			name: "whole text entity", text: "hello",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 5}},
+			want:     []interface{}{ArchiveTextEntity{Type: "bold", Text: "hello"}},
+			wantEnts: []ArchiveTextEntity{{Type: "bold", Text: "hello"}},
+		},
+		{
+			// 😀 takes two UTF-16 code units, offsets after it are shifted
+			name: "surrogate pairs", text: "😀 hi 👋 there",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 3, Length: 2},
+				&tg.MessageEntityItalic{Offset: 6, Length: 2},
+			},
+			want: []interface{}{
+				"😀 ",
+				ArchiveTextEntity{Type: "bold", Text: "hi"},
+				" ",
+				ArchiveTextEntity{Type: "italic", Text: "👋"},
+				" there",
+			},
+			wantEnts: []ArchiveTextEntity{
+				{Type: "plain", Text: "😀 "},
+				{Type: "bold", Text: "hi"},
+				{Type: "plain", Text: " "},
+				{Type: "italic", Text: "👋"},
+				{Type: "plain", Text: " there"},
+			},
+		},
+		{
+			name: "nested entities are flattened by the outer one", text: "a bold italic b",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityItalic{Offset: 7, Length: 6},
+				&tg.MessageEntityBold{Offset: 2, Length: 11},
+			},
+			want: []interface{}{
+				"a ",
+				ArchiveTextEntity{Type: "bold", Text: "bold italic"},
+				" b",
+			},
+			wantEnts: []ArchiveTextEntity{
+				{Type: "plain", Text: "a "},
+				{Type: "bold", Text: "bold italic"},
+				{Type: "plain", Text: " b"},
+			},
+		},
+		{
+			name: "invalid entity is skipped", text: "abc",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityCode{Offset: 2, Length: 5}},
+			want:     "abc", wantEnts: []ArchiveTextEntity{{Type: "plain", Text: "abc"}},
+		},
+		{
+			name: "entity types", text: "link text @bob code /start x",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityTextURL{Offset: 0, Length: 4, URL: "https://t.me"},
+				&tg.MessageEntityStrike{Offset: 5, Length: 4},
+				&tg.MessageEntityMentionName{Offset: 10, Length: 4, UserID: 42},
+				&tg.MessageEntityPre{Offset: 15, Length: 4, Language: "go"},
+				&tg.MessageEntityBotCommand{Offset: 20, Length: 6},
+				&tg.MessageEntityCustomEmoji{Offset: 27, Length: 1, DocumentID: 7},
+			},
+			want: []interface{}{
+				ArchiveTextEntity{Type: "text_link", Text: "link", Href: "https://t.me"},
+				" ",
+				ArchiveTextEntity{Type: "strikethrough", Text: "text"},
+				" ",
+				ArchiveTextEntity{Type: "mention_name", Text: "@bob", UserID: 42},
+				" ",
+				ArchiveTextEntity{Type: "pre", Text: "code", Language: "go"},
+				" ",
+				ArchiveTextEntity{Type: "bot_command", Text: "/start"},
+				" ",
+				ArchiveTextEntity{Type: "custom_emoji", Text: "x", DocumentID: "7"},
+			},
+			wantEnts: []ArchiveTextEntity{
+				{Type: "text_link", Text: "link", Href: "https://t.me"},
+				{Type: "plain", Text: " "},
+				{Type: "strikethrough", Text: "text"},
+				{Type: "plain", Text: " "},
+				{Type: "mention_name", Text: "@bob", UserID: 42},
+				{Type: "plain", Text: " "},
+				{Type: "pre", Text: "code", Language: "go"},
+				{Type: "plain", Text: " "},
+				{Type: "bot_command", Text: "/start"},
+				{Type: "plain", Text: " "},
+				{Type: "custom_emoji", Text: "x", DocumentID: "7"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := archiveText(tt.text, tt.entities)
+			assert.Equal(t, tt.want, text)
+			assert.Equal(t, tt.wantEnts, entities)
+		})
+	}
+}
+
+// history returns the iterator of chat history which has only one page
+func history(msgs []tg.MessageClass, users ...tg.UserClass) *messages.Iterator {
+	return messages.NewIterator(messages.QueryFunc(func(ctx context.Context, req messages.Request) (tg.MessagesMessagesClass, error) {
+		return &tg.MessagesMessages{Messages: msgs, Users: users}, nil
+	}), 100)
+}
+
+// exportArchive runs the writer of export with messages as chat history
+func exportArchive(t *testing.T, manager *peers.Manager, chat peers.Peer, msgs []tg.MessageClass, users []tg.UserClass, opts ExportOptions) []byte {
+	filter, err := expr.Compile(opts.Filter, expr.AsBool())
+	require.NoError(t, err)
+
+	var snd *senders
+	if opts.WithSender {
+		snd = newSenders(manager, chat)
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeArchive(context.Background(), buf, history(msgs, users...),
+		chat, chat.ID(), filter, snd, nil, &progress.Tracker{}, opts))
+	return buf.Bytes()
+}
+
+// archiveHistory returns messages of all kinds sent to the group
+func archiveHistory() (*peers.Manager, peers.Peer, []tg.MessageClass, []tg.UserClass) {
+	manager := peers.Options{}.Build(tg.NewClient(nil))
+	chat := manager.Channel(&tg.Channel{ID: 100, Title: "tdl 测试", Megagroup: true})
+
+	alice := &tg.User{ID: 1, FirstName: "Alice", LastName: "Liddell", Username: "alice"}
+	alice.SetFlags()
+
+	date := int(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Unix())
+	msgs := []tg.MessageClass{
+		&tg.MessageService{
+			ID: 1, Date: date, FromID: &tg.PeerUser{UserID: alice.ID},
+			Action: &tg.MessageActionChatAddUser{Users: []int64{alice.ID}},
+		},
+		&tg.Message{
+			ID: 2, Date: date, FromID: &tg.PeerUser{UserID: alice.ID},
+			Message: "👋 hello, bold italic",
+			Entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 10, Length: 11},
+				&tg.MessageEntityItalic{Offset: 15, Length: 6},
+			},
+		},
+		&tg.Message{
+			ID: 3, Date: date, Message: "photo from the group",
+			Media: &tg.MessageMediaPhoto{Photo: &tg.Photo{
+				ID:    10,
+				Sizes: []tg.PhotoSizeClass{&tg.PhotoSize{Type: "y", W: 1280, H: 720, Size: 2048}},
+			}},
+		},
+		&tg.Message{
+			ID: 4, Date: date, EditDate: date + 60, FromID: &tg.PeerUser{UserID: alice.ID},
+			ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 3},
+			Media: &tg.MessageMediaDocument{Document: &tg.Document{
+				ID: 11, Size: 4096, MimeType: "application/pdf",
+				Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: "报告.pdf"}},
+			}},
+		},
+		&tg.Message{
+			ID: 5, Date: date, FromID: &tg.PeerUser{UserID: alice.ID},
+			Media: &tg.MessageMediaPoll{
+				Poll: tg.Poll{
+					Question: tg.TextWithEntities{Text: "Go?"},
+					Answers: []tg.PollAnswer{
+						{Text: tg.TextWithEntities{Text: "yes"}, Option: []byte{0}},
+						{Text: tg.TextWithEntities{Text: "no"}, Option: []byte{1}},
+					},
+				},
+				Results: tg.PollResults{TotalVoters: 3, Results: []tg.PollAnswerVoters{
+					{Option: []byte{0}, Voters: 3, Chosen: true},
+				}},
+			},
+		},
+	}
+	for _, m := range msgs {
+		m.(interface{ SetFlags() }).SetFlags()
+	}
+
+	return manager, chat, msgs, []tg.UserClass{alice}
+}
+
+func TestArchiveExport(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC // dates are formatted in local time
+	t.Cleanup(func() { time.Local = local })
+
+	manager, chat, msgs, users := archiveHistory()
+	b := exportArchive(t, manager, chat, msgs, users, ExportOptions{
+		Type:       ExportTypeLast,
+		Format:     ExportFormatArchive,
+		Input:      []int{100},
+		Filter:     "true",
+		WithSender: true,
+	})
+
+	out := &bytes.Buffer{}
+	require.NoError(t, json.Indent(out, b, "", "  "))
+	got := append(out.Bytes(), '\n')
+
+	golden := filepath.Join("testdata", "archive.json")
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+		require.NoError(t, os.WriteFile(golden, got, 0o644))
+	}
+
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestWriteArchive(t *testing.T) {
+	manager, chat, msgs, users := archiveHistory()
+
+	type result struct {
+		Name     string `json:"name"`
+		ID       int64  `json:"id"`
+		Messages []struct {
+			ID     int     `json:"id"`
+			File   string  `json:"file"`
+			Text   any     `json:"text"`
+			Sender *Sender `json:"sender"`
+		} `json:"messages"`
+	}
+
+	tests := []struct {
+		name    string
+		opts    ExportOptions
+		ids     []int
+		name0   string
+		sender0 *Sender // sender of the first exported message
+	}{
+		{
+			name:  "minimal media",
+			opts:  ExportOptions{Type: ExportTypeLast, Format: ExportFormatMinimal, Input: []int{100}, Filter: "true"},
+			ids:   []int{4, 3},
+			name0: "",
+		},
+		{
+			name: "minimal with filter and sender",
+			opts: ExportOptions{
+				Type: ExportTypeLast, Format: ExportFormatMinimal, Input: []int{100},
+				Filter: "FromID == 1", All: true, WithSender: true,
+			},
+			ids:     []int{5, 4, 2},
+			sender0: &Sender{ID: 1, Type: "user", Username: "alice", Name: "Alice Liddell"},
+		},
+		{
+			// upper bound is the offset of history iterator
+			name:  "archive with range",
+			opts:  ExportOptions{Type: ExportTypeId, Format: ExportFormatArchive, Input: []int{3, 10}, Filter: "true"},
+			ids:   []int{5, 4, 3},
+			name0: "tdl 测试",
+		},
+		{
+			name: "archive with filter and sender",
+			opts: ExportOptions{
+				Type: ExportTypeLast, Format: ExportFormatArchive, Input: []int{2},
+				Filter: "FromID == 1", WithSender: true,
+			},
+			ids:     []int{5, 4},
+			name0:   "tdl 测试",
+			sender0: &Sender{ID: 1, Type: "user", Username: "alice", Name: "Alice Liddell"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r result
+			require.NoError(t, json.Unmarshal(exportArchive(t, manager, chat, msgs, users, tt.opts), &r))
+
+			assert.Equal(t, tt.name0, r.Name)
+			assert.Equal(t, int64(100), r.ID)
+
+			ids := make([]int, 0, len(r.Messages))
+			for _, m := range r.Messages {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.ids, ids)
+			require.NotEmpty(t, r.Messages)
+			assert.Equal(t, tt.sender0, r.Messages[0].Sender)
+		})
+	}
+}
@@ -4,15 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
 	"github.com/fatih/color"
 	"github.com/go-faster/jx"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/peers"
-	"github.com/gotd/td/telegram/query"
 	"github.com/gotd/td/telegram/query/messages"
 	"github.com/gotd/td/tg"
 	"github.com/jedib0t/go-pretty/v6/progress"
@@ -23,12 +24,14 @@ import (
 	"github.com/iyear/tdl/core/util/tutil"
 	"github.com/iyear/tdl/pkg/prog"
 	"github.com/iyear/tdl/pkg/texpr"
+	"github.com/iyear/tdl/pkg/tmessage"
 )
 
 //go:generate go-enum --names --values --flag --nocase
 
 type ExportOptions struct {
 	Type        ExportType
+	Format      ExportFormat
 	Chat        string
 	Thread      int // topic id in forum, message id in group
 	Input       []int
@@ -38,21 +41,32 @@ type ExportOptions struct {
 	WithContent bool
 	Raw         bool
 	All         bool
+	Incremental bool // only export messages newer than the last run
+	WithSender  bool // embed sender details of messages
+
+	// options of html and markdown transcript
+	Template string // file name template of download
+	MediaDir string // directory of downloaded media files, relative to transcript
 }
 
 type Message struct {
-	ID   int         `json:"id"`
-	Type string      `json:"type"`
-	File string      `json:"file"`
-	Date int         `json:"date,omitempty"`
-	Text string      `json:"text,omitempty"`
-	Raw  *tg.Message `json:"raw,omitempty"`
+	ID     int         `json:"id"`
+	Type   string      `json:"type"`
+	File   string      `json:"file"`
+	Date   int         `json:"date,omitempty"`
+	Text   string      `json:"text,omitempty"`
+	Sender *Sender     `json:"sender,omitempty"`
+	Raw    *tg.Message `json:"raw,omitempty"`
 }
 
 // ExportType
 // ENUM(time, id, last)
 type ExportType int
 
+// ExportFormat
+// ENUM(minimal, archive, html, markdown, csv, jsonl)
+type ExportFormat int
+
 func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts ExportOptions) (rerr error) {
 	// only output available fields
 	if opts.Filter == "-" {
@@ -84,7 +98,9 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 		return fmt.Errorf("failed to get peer: %w", err)
 	}
 
-	color.Yellow("WARN: Export only generates minimal JSON for tdl download, not for backup.")
+	if opts.Format == ExportFormatMinimal {
+		color.Yellow("WARN: Export only generates minimal JSON for tdl download, not for backup. Use '--format archive' for backup.")
+	}
 	color.Cyan("Occasional suspensions are due to Telegram rate limitations, please wait a moment.")
 	fmt.Println()
 
@@ -100,14 +116,13 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 
 	go pw.Render()
 
-	var q messages.Query
-	switch {
-	case opts.Thread != 0: // topic messages, reply messages
-		q = query.NewQuery(c.API()).Messages().GetReplies(peer.InputPeer()).MsgID(opts.Thread)
-	default: // history
-		q = query.NewQuery(c.API()).Messages().GetHistory(peer.InputPeer())
+	// process thread is reply type and peer is broadcast channel,
+	// so we need to set discussion group id instead of broadcast id
+	iter, chat, err := tmessage.History(ctx, c.API(), manager, peer, opts.Thread)
+	if err != nil {
+		return err
 	}
-	iter := messages.NewIterator(q, 100)
+	id := chat.ID()
 
 	switch opts.Type {
 	case ExportTypeTime:
@@ -117,32 +132,92 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 	case ExportTypeLast:
 	}
 
-	f, err := os.Create(opts.Output)
+	// analytics is appended to the output as time series, others overwrite it
+	analytics := opts.Format == ExportFormatCsv || opts.Format == ExportFormatJsonl
+	if opts.Incremental {
+		if err = rotate(opts.Output); err != nil {
+			return err
+		}
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if analytics {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(opts.Output, flag, 0o644)
 	if err != nil {
 		return err
 	}
 	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
 
-	enc := jx.NewStreamingEncoder(f, 512)
-	defer multierr.AppendInvoke(&rerr, multierr.Close(enc))
+	var inc *incremental
+	if opts.Incremental {
+		if inc, err = newIncremental(ctx, kvd, id, opts.Thread); err != nil {
+			return fmt.Errorf("failed to get last export: %w", err)
+		}
+		color.Blue("Incremental: export messages newer than %d", inc.last)
+	}
 
-	// process thread is reply type and peer is broadcast channel,
-	// so we need to set discussion group id instead of broadcast id
-	id := peer.ID()
-	if p, ok := peer.(peers.Channel); opts.Thread != 0 && ok && p.IsBroadcast() {
-		bc, _ := p.ToBroadcast()
-		raw, err := bc.FullRaw(ctx)
+	if analytics {
+		stat, err := f.Stat()
 		if err != nil {
-			return fmt.Errorf("failed to get broadcast full raw: %w", err)
+			return err
+		}
+		if err = exportAnalytics(ctx, f, stat.Size() == 0, iter, id, filter, inc, tracker, opts); err != nil {
+			return err
+		}
+		if err = inc.save(ctx); err != nil {
+			return fmt.Errorf("failed to save last export: %w", err)
 		}
 
-		if id, ok = raw.GetLinkedChatID(); !ok {
-			return fmt.Errorf("no linked group")
+		tracker.MarkAsDone()
+		prog.Wait(ctx, pw)
+		return nil
+	}
+
+	if opts.Format == ExportFormatHtml || opts.Format == ExportFormatMarkdown {
+		if err = exportTranscript(ctx, f, iter, peer, id, filter, inc, tracker, opts); err != nil {
+			return err
 		}
+		if err = inc.save(ctx); err != nil {
+			return fmt.Errorf("failed to save last export: %w", err)
+		}
+
+		tracker.MarkAsDone()
+		prog.Wait(ctx, pw)
+		return nil
+	}
+
+	var snd *senders
+	if opts.WithSender {
+		snd = newSenders(manager, peer)
+	}
+
+	if err = writeArchive(ctx, f, iter, peer, id, filter, snd, inc, tracker, opts); err != nil {
+		return err
+	}
+	if err = inc.save(ctx); err != nil {
+		return fmt.Errorf("failed to save last export: %w", err)
 	}
 
+	tracker.MarkAsDone()
+	prog.Wait(ctx, pw)
+	return nil
+}
+
+// writeArchive writes messages in minimal or archive JSON format. snd is nil if senders are not exported.
+func writeArchive(ctx context.Context, w io.Writer, iter *messages.Iterator, peer peers.Peer, id int64,
+	filter *vm.Program, snd *senders, inc *incremental, tracker *progress.Tracker, opts ExportOptions,
+) (rerr error) {
+	enc := jx.NewStreamingEncoder(w, 512)
+	defer multierr.AppendInvoke(&rerr, multierr.Close(enc))
+
 	enc.ObjStart()
 	defer enc.ObjEnd()
+	if opts.Format == ExportFormatArchive {
+		enc.Field("name", func(e *jx.Encoder) { e.Str(peer.VisibleName()) })
+		enc.Field("type", func(e *jx.Encoder) { e.Str(archiveChatType(peer)) })
+	}
 	enc.Field("id", func(e *jx.Encoder) { e.Int64(id) })
 
 	enc.FieldStart("messages")
@@ -150,23 +225,38 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 	defer enc.ArrEnd()
 
 	count := int64(0)
+	ar := &archiver{chat: peer}
 
-loop:
 	for iter.Next(ctx) {
 		msg := iter.Value()
-		switch opts.Type {
-		case ExportTypeTime:
-			if msg.Msg.GetDate() < opts.Input[0] {
-				break loop
+		if inc.stop(msg.Msg, opts.outOfRange(msg.Msg, count)) {
+			break
+		}
+
+		if opts.Format == ExportFormatArchive {
+			ok, err := filterArchive(filter, msg.Msg)
+			if err != nil {
+				return fmt.Errorf("failed to run filter: %w", err)
+			}
+			if !ok {
+				continue
 			}
-		case ExportTypeId:
-			if msg.Msg.GetID() < opts.Input[0] {
-				break loop
+
+			am := ar.message(msg.Msg, msg.Entities)
+			if am != nil && snd != nil {
+				from, _ := msg.Msg.GetFromID()
+				am.Sender = snd.resolve(ctx, from, msg.Entities)
 			}
-		case ExportTypeLast:
-			if count >= int64(opts.Input[0]) {
-				break loop
+
+			mb, err := json.Marshal(am)
+			if err != nil {
+				return fmt.Errorf("failed to marshal message: %w", err)
 			}
+			enc.Raw(mb)
+
+			count++
+			tracker.SetValue(count)
+			continue
 		}
 
 		m, ok := msg.Msg.(*tg.Message)
@@ -200,6 +290,9 @@ loop:
 			t.Date = m.Date
 			t.Text = m.Message
 		}
+		if snd != nil {
+			t.Sender = snd.resolve(ctx, m.FromID, msg.Entities)
+		}
 		if opts.Raw {
 			t.Raw = m
 		}
@@ -214,11 +307,20 @@ loop:
 		tracker.SetValue(count)
 	}
 
-	if err = iter.Err(); err != nil {
-		return err
+	return iter.Err()
+}
+
+// outOfRange reports whether the message and following ones are out of export range.
+// count is the number of exported messages.
+func (opts ExportOptions) outOfRange(msg tg.NotEmptyMessage, count int64) bool {
+	switch opts.Type {
+	case ExportTypeTime:
+		return msg.GetDate() < opts.Input[0]
+	case ExportTypeId:
+		return msg.GetID() < opts.Input[0]
+	case ExportTypeLast:
+		return count >= int64(opts.Input[0])
 	}
 
-	tracker.MarkAsDone()
-	prog.Wait(ctx, pw)
-	return nil
+	return false
 }
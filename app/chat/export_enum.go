@@ -104,3 +104,118 @@ func (x *ExportType) Get() interface{} {
 func (x *ExportType) Type() string {
 	return "ExportType"
 }
+
+const (
+	// ExportFormatMinimal is a ExportFormat of type Minimal.
+	ExportFormatMinimal ExportFormat = iota
+	// ExportFormatArchive is a ExportFormat of type Archive.
+	ExportFormatArchive
+	// ExportFormatHtml is a ExportFormat of type Html.
+	ExportFormatHtml
+	// ExportFormatMarkdown is a ExportFormat of type Markdown.
+	ExportFormatMarkdown
+	// ExportFormatCsv is a ExportFormat of type Csv.
+	ExportFormatCsv
+	// ExportFormatJsonl is a ExportFormat of type Jsonl.
+	ExportFormatJsonl
+)
+
+var ErrInvalidExportFormat = fmt.Errorf("not a valid ExportFormat, try [%s]", strings.Join(_ExportFormatNames, ", "))
+
+const _ExportFormatName = "minimalarchivehtmlmarkdowncsvjsonl"
+
+var _ExportFormatNames = []string{
+	_ExportFormatName[0:7],
+	_ExportFormatName[7:14],
+	_ExportFormatName[14:18],
+	_ExportFormatName[18:26],
+	_ExportFormatName[26:29],
+	_ExportFormatName[29:34],
+}
+
+// ExportFormatNames returns a list of possible string values of ExportFormat.
+func ExportFormatNames() []string {
+	tmp := make([]string, len(_ExportFormatNames))
+	copy(tmp, _ExportFormatNames)
+	return tmp
+}
+
+// ExportFormatValues returns a list of the values for ExportFormat
+func ExportFormatValues() []ExportFormat {
+	return []ExportFormat{
+		ExportFormatMinimal,
+		ExportFormatArchive,
+		ExportFormatHtml,
+		ExportFormatMarkdown,
+		ExportFormatCsv,
+		ExportFormatJsonl,
+	}
+}
+
+var _ExportFormatMap = map[ExportFormat]string{
+	ExportFormatMinimal:  _ExportFormatName[0:7],
+	ExportFormatArchive:  _ExportFormatName[7:14],
+	ExportFormatHtml:     _ExportFormatName[14:18],
+	ExportFormatMarkdown: _ExportFormatName[18:26],
+	ExportFormatCsv:      _ExportFormatName[26:29],
+	ExportFormatJsonl:    _ExportFormatName[29:34],
+}
+
+// String implements the Stringer interface.
+func (x ExportFormat) String() string {
+	if str, ok := _ExportFormatMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("ExportFormat(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x ExportFormat) IsValid() bool {
+	_, ok := _ExportFormatMap[x]
+	return ok
+}
+
+var _ExportFormatValue = map[string]ExportFormat{
+	_ExportFormatName[0:7]:                    ExportFormatMinimal,
+	strings.ToLower(_ExportFormatName[0:7]):   ExportFormatMinimal,
+	_ExportFormatName[7:14]:                   ExportFormatArchive,
+	strings.ToLower(_ExportFormatName[7:14]):  ExportFormatArchive,
+	_ExportFormatName[14:18]:                  ExportFormatHtml,
+	strings.ToLower(_ExportFormatName[14:18]): ExportFormatHtml,
+	_ExportFormatName[18:26]:                  ExportFormatMarkdown,
+	strings.ToLower(_ExportFormatName[18:26]): ExportFormatMarkdown,
+	_ExportFormatName[26:29]:                  ExportFormatCsv,
+	strings.ToLower(_ExportFormatName[26:29]): ExportFormatCsv,
+	_ExportFormatName[29:34]:                  ExportFormatJsonl,
+	strings.ToLower(_ExportFormatName[29:34]): ExportFormatJsonl,
+}
+
+// ParseExportFormat attempts to convert a string to a ExportFormat.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	if x, ok := _ExportFormatValue[name]; ok {
+		return x, nil
+	}
+	// Case insensitive parse, do a separate lookup to prevent unnecessary cost of lowercasing a string if we don't need to.
+	if x, ok := _ExportFormatValue[strings.ToLower(name)]; ok {
+		return x, nil
+	}
+	return ExportFormat(0), fmt.Errorf("%s is %w", name, ErrInvalidExportFormat)
+}
+
+// Set implements the Golang flag.Value interface func.
+func (x *ExportFormat) Set(val string) error {
+	v, err := ParseExportFormat(val)
+	*x = v
+	return err
+}
+
+// Get implements the Golang flag.Getter interface func.
+func (x *ExportFormat) Get() interface{} {
+	return *x
+}
+
+// Type implements the github.com/spf13/pFlag Value interface.
+func (x *ExportFormat) Type() string {
+	return "ExportFormat"
+}
@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/key"
+)
+
+// incremental tracks the newest message exported by the last run of the chat
+type incremental struct {
+	kvd    storage.Storage
+	key    string
+	last   int  // newest message id of the last run, zero if never exported
+	newest int  // newest message id in export range of this run
+	cut    bool // whether the scan is stopped by export range before reaching the last run
+}
+
+func newIncremental(ctx context.Context, kvd storage.Storage, peer int64, thread int) (*incremental, error) {
+	inc := &incremental{kvd: kvd, key: key.Export(peer, thread)}
+
+	b, err := kvd.Get(ctx, inc.key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if len(b) == 0 { // first run
+		return inc, nil
+	}
+
+	if inc.last, err = strconv.Atoi(string(b)); err != nil {
+		return nil, fmt.Errorf("invalid last exported message id %q: %w", b, err)
+	}
+	return inc, nil
+}
+
+// stop reports whether the scan should stop at the message, because it's out of export range
+// or the message and following ones have been exported by the last run.
+// History is from newest to oldest, so following messages are older.
+func (inc *incremental) stop(msg tg.NotEmptyMessage, outOfRange bool) bool {
+	if inc == nil {
+		return outOfRange
+	}
+
+	switch {
+	case msg.GetID() <= inc.last:
+		return true
+	case outOfRange:
+		inc.cut = true
+		return true
+	}
+
+	inc.newest = max(inc.newest, msg.GetID())
+	return false
+}
+
+// save records the newest message in export range, it should be called after the export succeeds.
+// Messages between the last run and export range are not exported if the scan is cut,
+// so the record is kept to export them in the next run.
+func (inc *incremental) save(ctx context.Context) error {
+	if inc == nil || inc.newest <= inc.last {
+		return nil
+	}
+	if inc.cut && inc.last > 0 {
+		color.Yellow("WARN: Messages between %d and the export range are not exported, "+
+			"the last export is kept. Widen the range to export them.", inc.last)
+		return nil
+	}
+
+	return inc.kvd.Set(ctx, inc.key, []byte(strconv.Itoa(inc.newest)))
+}
+
+// rotate renames the existing output file with its modification time,
+// e.g. tdl-export.json -> tdl-export.20240101150405.json. If the rotated file
+// exists, a counter is appended, e.g. tdl-export.20240101150405.1.json
+func rotate(path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	ext := filepath.Ext(path)
+	base := fmt.Sprintf("%s.%s", strings.TrimSuffix(path, ext), stat.ModTime().Format("20060102150405"))
+	rotated := base + ext
+	for i := 1; ; i++ {
+		if _, err = os.Stat(rotated); errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to stat rotated file: %w", err)
+		}
+		rotated = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+
+	if err = os.Rename(path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate output file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/kv"
+)
+
+func newTestStorage(t *testing.T) storage.Storage {
+	engine, err := kv.New(kv.DriverFile, map[string]any{"path": filepath.Join(t.TempDir(), "kv.json")})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = engine.Close() })
+
+	kvd, err := engine.Open("test")
+	require.NoError(t, err)
+	return kvd
+}
+
+func TestIncremental(t *testing.T) {
+	// ids of chat history from newest to oldest
+	history := func(from, to int) []tg.NotEmptyMessage {
+		msgs := make([]tg.NotEmptyMessage, 0, from-to+1)
+		for _, id := range idRange(from, to) {
+			msgs = append(msgs, &tg.Message{ID: id})
+		}
+		return msgs
+	}
+
+	tests := []struct {
+		name    string
+		last    int // recorded by the last run, zero means first run
+		history []tg.NotEmptyMessage
+		inRange func(id int) bool
+		scanned []int // messages in range and not exported
+		want    int   // recorded after this run
+	}{
+		{
+			name: "first run", last: 0, history: history(5, 1),
+			inRange: func(int) bool { return true },
+			scanned: []int{5, 4, 3, 2, 1}, want: 5,
+		},
+		{
+			name: "first run with range", last: 0, history: history(500, 1),
+			inRange: func(id int) bool { return id > 400 },
+			scanned: idRange(500, 401), want: 500,
+		},
+		{
+			name: "new messages", last: 3, history: history(5, 1),
+			inRange: func(int) bool { return true },
+			scanned: []int{5, 4}, want: 5,
+		},
+		{
+			name: "no new messages", last: 5, history: history(5, 1),
+			inRange: func(int) bool { return true },
+			scanned: []int{}, want: 5,
+		},
+		{
+			name: "range reaches the last run", last: 400, history: history(500, 1),
+			inRange: func(id int) bool { return id > 300 },
+			scanned: idRange(500, 401), want: 500,
+		},
+		{
+			// e.g. -T last -i 100 with 500 new messages
+			name: "range is cut before the last run", last: 100, history: history(600, 1),
+			inRange: func(id int) bool { return id > 500 },
+			scanned: idRange(600, 501), want: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			kvd := newTestStorage(t)
+
+			inc, err := newIncremental(ctx, kvd, 100, 0)
+			require.NoError(t, err)
+			if tt.last > 0 {
+				inc.newest = tt.last
+				require.NoError(t, inc.save(ctx))
+				inc, err = newIncremental(ctx, kvd, 100, 0)
+				require.NoError(t, err)
+				require.Equal(t, tt.last, inc.last)
+			}
+
+			scanned := make([]int, 0)
+			for _, msg := range tt.history {
+				if inc.stop(msg, !tt.inRange(msg.GetID())) {
+					break
+				}
+				scanned = append(scanned, msg.GetID())
+			}
+			assert.Equal(t, tt.scanned, scanned)
+			require.NoError(t, inc.save(ctx))
+
+			inc, err = newIncremental(ctx, kvd, 100, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, inc.last)
+		})
+	}
+
+	// disabled incremental only checks the range
+	var inc *incremental
+	assert.False(t, inc.stop(&tg.Message{ID: 1}, false))
+	assert.True(t, inc.stop(&tg.Message{ID: 1}, true))
+	assert.NoError(t, inc.save(context.Background()))
+}
+
+// idRange returns ids from newest to oldest
+func idRange(from, to int) []int {
+	ids := make([]int, 0, from-to+1)
+	for id := from; id >= to; id-- {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tdl-export.json")
+	mtime := time.Date(2024, 1, 1, 15, 4, 5, 0, time.Local)
+
+	// files modified in the same second are rotated to different names
+	for _, content := range []string{"a", "b", "c"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+		require.NoError(t, rotate(path))
+		assert.NoFileExists(t, path)
+	}
+
+	for name, content := range map[string]string{
+		"tdl-export.20240101150405.json":   "a",
+		"tdl-export.20240101150405.1.json": "b",
+		"tdl-export.20240101150405.2.json": "c",
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b))
+	}
+
+	// nothing to rotate
+	require.NoError(t, rotate(path))
+}
@@ -0,0 +1,123 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// Sender is the user, chat or channel who sends the message or performs the action
+type Sender struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"` // user, chat or channel
+	Username string `json:"username,omitempty"`
+	Name     string `json:"name"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+// senders resolves and caches senders. Entities of the response are used first,
+// and the peers manager is used if the sender is not in entities.
+type senders struct {
+	manager *peers.Manager
+	chat    peers.Peer // sender of channel posts
+	cache   map[senderKey]*Sender
+}
+
+type senderKey struct {
+	typ string
+	id  int64
+}
+
+func newSenderKey(p tg.PeerClass) senderKey {
+	switch p := p.(type) {
+	case *tg.PeerUser:
+		return senderKey{typ: "user", id: p.UserID}
+	case *tg.PeerChat:
+		return senderKey{typ: "chat", id: p.ChatID}
+	case *tg.PeerChannel:
+		return senderKey{typ: "channel", id: p.ChannelID}
+	}
+	return senderKey{}
+}
+
+func newSenders(manager *peers.Manager, chat peers.Peer) *senders {
+	return &senders{
+		manager: manager,
+		chat:    chat,
+		cache:   make(map[senderKey]*Sender),
+	}
+}
+
+func (s *senders) resolve(ctx context.Context, from tg.PeerClass, entities peer.Entities) *Sender {
+	if from == nil {
+		return peerSender(s.chat)
+	}
+
+	key := newSenderKey(from)
+	if sender, ok := s.cache[key]; ok {
+		return sender
+	}
+
+	sender, ok := entitySender(from, entities)
+	if !ok {
+		p, err := s.manager.ResolvePeer(ctx, from)
+		if err != nil {
+			// deleted accounts or inaccessible chats, keep id only
+			logctx.From(ctx).Warn("Failed to resolve sender",
+				zap.String("peer", from.String()),
+				zap.Error(err))
+			sender = &Sender{ID: key.id, Type: key.typ}
+		} else {
+			sender = peerSender(p)
+		}
+	}
+
+	s.cache[key] = sender
+	return sender
+}
+
+func entitySender(from tg.PeerClass, entities peer.Entities) (*Sender, bool) {
+	switch p := from.(type) {
+	case *tg.PeerUser:
+		if u, ok := entities.User(p.UserID); ok {
+			return &Sender{
+				ID:       u.ID,
+				Type:     "user",
+				Username: u.Username,
+				Name:     visibleName(u.FirstName, u.LastName),
+				Bot:      u.Bot,
+			}, true
+		}
+	case *tg.PeerChat:
+		if c, ok := entities.Chat(p.ChatID); ok {
+			return &Sender{ID: c.ID, Type: "chat", Name: c.Title}, true
+		}
+	case *tg.PeerChannel:
+		if c, ok := entities.Channel(p.ChannelID); ok {
+			return &Sender{ID: c.ID, Type: "channel", Username: c.Username, Name: c.Title}, true
+		}
+	}
+
+	return nil, false
+}
+
+func peerSender(p peers.Peer) *Sender {
+	sender := &Sender{ID: p.ID(), Name: p.VisibleName()}
+	sender.Username, _ = p.Username()
+
+	switch p := p.(type) {
+	case peers.User:
+		sender.Type, sender.Bot = "user", p.Raw().Bot
+	case peers.Chat:
+		sender.Type = "chat"
+	default:
+		sender.Type = "channel"
+	}
+
+	return sender
+}
@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+// invokerFunc answers requests of tg.Client
+type invokerFunc func(ctx context.Context, input bin.Encoder, output bin.Decoder) error
+
+func (f invokerFunc) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	return f(ctx, input, output)
+}
+
+// reply encodes the result to output as the response of request
+func reply(output bin.Decoder, result bin.Encoder) error {
+	buf := &bin.Buffer{}
+	if err := result.Encode(buf); err != nil {
+		return err
+	}
+	return output.Decode(buf)
+}
+
+func TestSendersResolve(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	manager := peers.Options{}.Build(tg.NewClient(invokerFunc(func(context.Context, bin.Encoder, bin.Decoder) error {
+		calls++
+		return errors.New("inaccessible")
+	})))
+	ch := &tg.Channel{ID: 100, Title: "tdl", Username: "tdl_chat", Broadcast: true}
+	ch.SetFlags() // username is read by flags
+	chat := manager.Channel(ch)
+
+	alice := &tg.User{ID: 1, FirstName: "Alice", LastName: "Liddell", Username: "alice"}
+	bot := &tg.User{ID: 2, FirstName: "Bot", Bot: true}
+	entities := peer.NewEntities(
+		map[int64]*tg.User{alice.ID: alice, bot.ID: bot},
+		map[int64]*tg.Chat{3: {ID: 3, Title: "group"}},
+		map[int64]*tg.Channel{4: {ID: 4, Title: "channel", Username: "ch"}},
+	)
+	empty := peer.NewEntities(map[int64]*tg.User{}, map[int64]*tg.Chat{}, map[int64]*tg.Channel{})
+
+	snd := newSenders(manager, chat)
+
+	tests := []struct {
+		name     string
+		from     tg.PeerClass
+		entities peer.Entities
+		want     *Sender
+	}{
+		{
+			name: "channel post", from: nil, entities: entities,
+			want: &Sender{ID: 100, Type: "channel", Username: "tdl_chat", Name: "tdl"},
+		},
+		{
+			name: "user in entities", from: &tg.PeerUser{UserID: 1}, entities: entities,
+			want: &Sender{ID: 1, Type: "user", Username: "alice", Name: "Alice Liddell"},
+		},
+		{
+			name: "bot in entities", from: &tg.PeerUser{UserID: 2}, entities: entities,
+			want: &Sender{ID: 2, Type: "user", Name: "Bot", Bot: true},
+		},
+		{
+			name: "chat in entities", from: &tg.PeerChat{ChatID: 3}, entities: entities,
+			want: &Sender{ID: 3, Type: "chat", Name: "group"},
+		},
+		{
+			name: "channel in entities", from: &tg.PeerChannel{ChannelID: 4}, entities: entities,
+			want: &Sender{ID: 4, Type: "channel", Username: "ch", Name: "channel"},
+		},
+		{
+			name: "cached", from: &tg.PeerUser{UserID: 1}, entities: empty,
+			want: &Sender{ID: 1, Type: "user", Username: "alice", Name: "Alice Liddell"},
+		},
+		{
+			name: "unresolved user keeps id", from: &tg.PeerUser{UserID: 5}, entities: empty,
+			want: &Sender{ID: 5, Type: "user"},
+		},
+		{
+			name: "unresolved channel keeps id", from: &tg.PeerChannel{ChannelID: 6}, entities: empty,
+			want: &Sender{ID: 6, Type: "channel"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, snd.resolve(ctx, tt.from, tt.entities))
+		})
+	}
+
+	// failed senders are cached too, so they are not requested again
+	before := calls
+	assert.Equal(t, &Sender{ID: 5, Type: "user"}, snd.resolve(ctx, &tg.PeerUser{UserID: 5}, empty))
+	assert.Equal(t, before, calls)
+	assert.Positive(t, calls)
+}
@@ -0,0 +1,306 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html"
+	htmltpl "html/template"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/expr-lang/expr/vm"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/jedib0t/go-pretty/v6/progress"
+
+	"github.com/iyear/tdl/core/tmedia"
+	"github.com/iyear/tdl/pkg/tmessage"
+	"github.com/iyear/tdl/pkg/tplfunc"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+//go:embed transcript_html.go.tmpl
+var transcriptHTML string
+
+//go:embed transcript_md.go.tmpl
+var transcriptMarkdown string
+
+type transcriptChat struct {
+	Name     string
+	ID       int64
+	Type     string
+	Date     string // export date
+	Messages []*transcriptMessage
+}
+
+type transcriptMessage struct {
+	*ArchiveMessage
+	Media string // link of downloaded media file, empty if there is no file
+}
+
+// mediaLinker returns links of media files which are downloaded with the template to dir
+type mediaLinker struct {
+	dir  string
+	tpl  *template.Template
+	date time.Time // used as download date, which is unknown for export
+}
+
+func newMediaLinker(dir, tpl string, date time.Time) (*mediaLinker, error) {
+	t, err := template.New("dl").
+		Funcs(tplfunc.FuncMap(tplfunc.All...)).
+		Parse(tpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	return &mediaLinker{dir: dir, tpl: t, date: date}, nil
+}
+
+func (l *mediaLinker) link(dialog int64, m *tg.Message) (string, error) {
+	media, ok := tmedia.GetMedia(m)
+	if !ok {
+		return "", nil
+	}
+
+	name := bytes.Buffer{}
+	if err := l.tpl.Execute(&name, tmessage.NewFileTemplate(dialog, m, media.Name, media.Size, l.date)); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return (&url.URL{Path: path.Join(l.dir, name.String())}).String(), nil
+}
+
+// renderTranscript writes chat as readable transcript in html or markdown
+func renderTranscript(w io.Writer, format ExportFormat, chat *transcriptChat) error {
+	switch format {
+	case ExportFormatHtml:
+		t, err := htmltpl.New("transcript").Funcs(htmltpl.FuncMap{
+			"text":   htmlText,
+			"action": actionText,
+			"size":   utils.Byte.FormatBinaryBytes,
+		}).Parse(transcriptHTML)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, chat)
+	case ExportFormatMarkdown:
+		t, err := template.New("transcript").Funcs(template.FuncMap{
+			"text":   markdownText,
+			"escape": markdownEscape,
+			"action": actionText,
+			"size":   utils.Byte.FormatBinaryBytes,
+		}).Parse(transcriptMarkdown)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, chat)
+	}
+
+	return fmt.Errorf("unknown transcript format: %s", format)
+}
+
+// actionText returns readable text of service message action, e.g. pin_message -> pin message
+func actionText(action string) string {
+	return strings.ReplaceAll(action, "_", " ")
+}
+
+func htmlText(entities []ArchiveTextEntity) htmltpl.HTML {
+	b := &strings.Builder{}
+
+	for _, e := range entities {
+		text := html.EscapeString(e.Text)
+
+		switch e.Type {
+		case "plain", "hashtag", "cashtag", "bot_command", "phone", "bank_card", "custom_emoji", "unknown":
+			b.WriteString(text)
+		case "bold":
+			b.WriteString("<b>" + text + "</b>")
+		case "italic":
+			b.WriteString("<i>" + text + "</i>")
+		case "underline":
+			b.WriteString("<u>" + text + "</u>")
+		case "strikethrough":
+			b.WriteString("<s>" + text + "</s>")
+		case "code":
+			b.WriteString("<code>" + text + "</code>")
+		case "pre":
+			b.WriteString("<pre>" + text + "</pre>")
+		case "spoiler":
+			b.WriteString(`<span class="spoiler">` + text + "</span>")
+		case "blockquote":
+			b.WriteString("<blockquote>" + text + "</blockquote>")
+		case "link":
+			// links can be written without scheme, e.g. example.com
+			href := e.Text
+			if !strings.Contains(href, "://") {
+				href = "https://" + href
+			}
+			b.WriteString(htmlLink(href, text))
+		case "text_link":
+			b.WriteString(htmlLink(e.Href, text))
+		case "email":
+			b.WriteString(htmlLink("mailto:"+e.Text, text))
+		case "mention":
+			b.WriteString(htmlLink("https://t.me/"+strings.TrimPrefix(e.Text, "@"), text))
+		default:
+			b.WriteString(text)
+		}
+	}
+
+	return htmltpl.HTML(b.String())
+}
+
+func htmlLink(href, text string) string {
+	if !safeURL(href) {
+		return text
+	}
+
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), text)
+}
+
+// safeURL reports whether the link can be opened in transcript, e.g. javascript links are not
+func safeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "", "http", "https", "mailto", "tg":
+		return true
+	}
+	return false
+}
+
+func markdownText(entities []ArchiveTextEntity) string {
+	b := &strings.Builder{}
+
+	for _, e := range entities {
+		if e.Type == "pre" {
+			// fence must be longer than backticks in the code, and language is a single word
+			fence := strings.Repeat("`", max(3, longestRun(e.Text, '`')+1))
+			lang := strings.ReplaceAll(strings.Join(strings.Fields(e.Language), ""), "`", "")
+			b.WriteString("\n" + fence + lang + "\n" + e.Text + "\n" + fence + "\n")
+			continue
+		}
+		if e.Type == "code" {
+			b.WriteString("`" + strings.ReplaceAll(e.Text, "`", "") + "`")
+			continue
+		}
+
+		text := markdownEscape(e.Text)
+		switch e.Type {
+		case "bold":
+			text = "**" + text + "**"
+		case "italic":
+			text = "_" + text + "_"
+		case "strikethrough":
+			text = "~~" + text + "~~"
+		case "text_link":
+			if safeURL(e.Href) {
+				text = "[" + text + "](<" + markdownURLReplacer.Replace(e.Href) + ">)"
+			}
+		case "mention":
+			text = "[" + text + "](https://t.me/" + strings.TrimPrefix(e.Text, "@") + ")"
+		case "blockquote":
+			text = "\n> " + strings.ReplaceAll(text, "\n", "\n> ") + "\n"
+		}
+		// keep line breaks of message
+		b.WriteString(strings.ReplaceAll(text, "\n", "  \n"))
+	}
+
+	return b.String()
+}
+
+var markdownReplacer = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+)
+
+func markdownEscape(s string) string {
+	return markdownReplacer.Replace(s)
+}
+
+// markdownURLReplacer percent-encodes characters which end the link destination in angle brackets
+var markdownURLReplacer = strings.NewReplacer(
+	"<", "%3C", ">", "%3E", " ", "%20", "\n", "%0A", "\r", "%0D", "\t", "%09", `\`, "%5C",
+)
+
+// longestRun returns the length of the longest run of c in s
+func longestRun(s string, c byte) int {
+	longest, n := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != c {
+			n = 0
+			continue
+		}
+		n++
+		longest = max(longest, n)
+	}
+	return longest
+}
+
+// exportTranscript collects messages and renders them from oldest to newest
+func exportTranscript(ctx context.Context, w io.Writer, iter *messages.Iterator, peer peers.Peer, id int64,
+	filter *vm.Program, inc *incremental, tracker *progress.Tracker, opts ExportOptions,
+) error {
+	now := time.Now()
+	linker, err := newMediaLinker(opts.MediaDir, opts.Template, now)
+	if err != nil {
+		return err
+	}
+
+	chat := &transcriptChat{
+		Name: peer.VisibleName(),
+		ID:   id,
+		Type: archiveChatType(peer),
+		Date: now.Format(time.DateTime),
+	}
+	ar := &archiver{chat: peer}
+
+	for iter.Next(ctx) {
+		msg := iter.Value()
+		if inc.stop(msg.Msg, opts.outOfRange(msg.Msg, int64(len(chat.Messages)))) {
+			break
+		}
+
+		ok, err := filterArchive(filter, msg.Msg)
+		if err != nil {
+			return fmt.Errorf("failed to run filter: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		am := ar.message(msg.Msg, msg.Entities)
+		if am == nil {
+			continue
+		}
+
+		t := &transcriptMessage{ArchiveMessage: am}
+		if m, ok := msg.Msg.(*tg.Message); ok {
+			if t.Media, err = linker.link(id, m); err != nil {
+				return err
+			}
+		}
+
+		chat.Messages = append(chat.Messages, t)
+		tracker.SetValue(int64(len(chat.Messages)))
+	}
+	if err = iter.Err(); err != nil {
+		return err
+	}
+
+	// history is from newest to oldest
+	slices.Reverse(chat.Messages)
+
+	return renderTranscript(w, opts.Format, chat)
+}
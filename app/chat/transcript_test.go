@@ -0,0 +1,116 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLText(t *testing.T) {
+	tests := []struct {
+		name     string
+		entities []ArchiveTextEntity
+		want     string
+	}{
+		{
+			name:     "escape",
+			entities: []ArchiveTextEntity{{Type: "plain", Text: "<b>"}},
+			want:     "&lt;b&gt;",
+		},
+		{
+			name:     "link without scheme",
+			entities: []ArchiveTextEntity{{Type: "link", Text: "example.com/a?b=c&d"}},
+			want:     `<a href="https://example.com/a?b=c&amp;d">example.com/a?b=c&amp;d</a>`,
+		},
+		{
+			name:     "link with scheme",
+			entities: []ArchiveTextEntity{{Type: "link", Text: "http://example.com"}},
+			want:     `<a href="http://example.com">http://example.com</a>`,
+		},
+		{
+			name:     "unsafe text link",
+			entities: []ArchiveTextEntity{{Type: "text_link", Text: "x", Href: "javascript:alert(1)"}},
+			want:     "x",
+		},
+		{
+			name: "email and mention",
+			entities: []ArchiveTextEntity{
+				{Type: "email", Text: "a@b.c"},
+				{Type: "plain", Text: " "},
+				{Type: "mention", Text: "@tdl"},
+			},
+			want: `<a href="mailto:a@b.c">a@b.c</a> <a href="https://t.me/tdl">@tdl</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(htmlText(tt.entities)))
+		})
+	}
+}
+
+func TestMarkdownText(t *testing.T) {
+	tests := []struct {
+		name     string
+		entities []ArchiveTextEntity
+		want     string
+	}{
+		{
+			name:     "escape",
+			entities: []ArchiveTextEntity{{Type: "plain", Text: "*a* [b] #c"}},
+			want:     `\*a\* \[b\] \#c`,
+		},
+		{
+			name:     "line breaks",
+			entities: []ArchiveTextEntity{{Type: "bold", Text: "a\nb"}},
+			want:     "**a  \nb**",
+		},
+		{
+			name:     "text link",
+			entities: []ArchiveTextEntity{{Type: "text_link", Text: "x", Href: "https://example.com/a(b)"}},
+			want:     "[x](<https://example.com/a(b)>)",
+		},
+		{
+			name:     "text link breaking out of brackets",
+			entities: []ArchiveTextEntity{{Type: "text_link", Text: "x", Href: "https://example.com/a b>[c](d)\\"}},
+			want:     "[x](<https://example.com/a%20b%3E[c](d)%5C>)",
+		},
+		{
+			name:     "unsafe text link",
+			entities: []ArchiveTextEntity{{Type: "text_link", Text: "x", Href: "javascript:alert(1)"}},
+			want:     "x",
+		},
+		{
+			name:     "mention",
+			entities: []ArchiveTextEntity{{Type: "mention", Text: "@tdl_bot"}},
+			want:     `[@tdl\_bot](https://t.me/tdl_bot)`,
+		},
+		{
+			name:     "code",
+			entities: []ArchiveTextEntity{{Type: "code", Text: "a`b"}},
+			want:     "`ab`",
+		},
+		{
+			name:     "pre",
+			entities: []ArchiveTextEntity{{Type: "pre", Text: "fmt.Println()", Language: "go"}},
+			want:     "\n```go\nfmt.Println()\n```\n",
+		},
+		{
+			name:     "pre containing fence",
+			entities: []ArchiveTextEntity{{Type: "pre", Text: "```\nx\n`````", Language: "md\n```"}},
+			want:     "\n``````md\n```\nx\n`````\n``````\n",
+		},
+		{
+			name:     "blockquote",
+			entities: []ArchiveTextEntity{{Type: "blockquote", Text: "a\nb"}},
+			want:     "  \n> a  \n> b  \n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, markdownText(tt.entities))
+		})
+	}
+}
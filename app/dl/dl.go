@@ -20,6 +20,7 @@ import (
 	"github.com/iyear/tdl/core/storage"
 	"github.com/iyear/tdl/core/tclient"
 	"github.com/iyear/tdl/pkg/consts"
+	"github.com/iyear/tdl/pkg/crypt"
 	"github.com/iyear/tdl/pkg/key"
 	"github.com/iyear/tdl/pkg/prog"
 	"github.com/iyear/tdl/pkg/tmessage"
@@ -42,6 +43,11 @@ type Options struct {
 	// resume opts
 	Continue, Restart bool
 
+	// decryption opts
+	Decrypt    bool
+	KeyFile    string
+	Passphrase string
+
 	// serve
 	Serve bool
 	Port  int
@@ -97,6 +103,13 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		}
 	}()
 
+	var secret []byte
+	if opts.Decrypt {
+		if secret, err = crypt.Secret(opts.KeyFile, opts.Passphrase); err != nil {
+			return errors.Wrap(err, "load decryption secret")
+		}
+	}
+
 	dlProgress := prog.New(utils.Byte.FormatBinaryBytes)
 	dlProgress.SetNumTrackersExpected(it.Total())
 	prog.EnablePS(ctx, dlProgress)
@@ -105,7 +118,7 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		Pool:     pool,
 		Threads:  viper.GetInt(consts.FlagThreads),
 		Iter:     it,
-		Progress: newProgress(dlProgress, it, opts),
+		Progress: newProgress(ctx, kvd, dlProgress, it, opts, secret),
 	}
 	limit := viper.GetInt(consts.FlagLimit)
 
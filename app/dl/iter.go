@@ -28,21 +28,10 @@ import (
 	"github.com/iyear/tdl/pkg/filterMap"
 	"github.com/iyear/tdl/pkg/tmessage"
 	"github.com/iyear/tdl/pkg/tplfunc"
-	"github.com/iyear/tdl/pkg/utils"
 )
 
 const tempExt = ".tmp"
 
-type fileTemplate struct {
-	DialogID     int64
-	MessageID    int
-	MessageDate  int64
-	FileName     string
-	FileCaption  string
-	FileSize     string
-	DownloadDate int64
-}
-
 type iter struct {
 	pool    dcpool.Pool
 	manager *peers.Manager
@@ -211,15 +200,7 @@ func (i *iter) processSingle(ctx context.Context, message *tg.Message, from peer
 	}
 
 	toName := bytes.Buffer{}
-	err := i.tpl.Execute(&toName, &fileTemplate{
-		DialogID:     from.ID(),
-		MessageID:    message.ID,
-		MessageDate:  int64(message.Date),
-		FileName:     item.Name,
-		FileCaption:  message.Message,
-		FileSize:     utils.Byte.FormatBinaryBytes(item.Size),
-		DownloadDate: time.Now().Unix(),
-	})
+	err := i.tpl.Execute(&toName, tmessage.NewFileTemplate(from.ID(), message, item.Name, item.Size, time.Now()))
 	if err != nil {
 		i.err = errors.Wrap(err, "execute template")
 		return false, false
@@ -3,6 +3,7 @@ package dl
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,10 +14,14 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/go-faster/errors"
 	pw "github.com/jedib0t/go-pretty/v6/progress"
+	"go.uber.org/multierr"
 
 	"github.com/iyear/tdl/core/downloader"
+	"github.com/iyear/tdl/core/storage"
 	"github.com/iyear/tdl/core/util/fsutil"
+	"github.com/iyear/tdl/pkg/crypt"
 	"github.com/iyear/tdl/pkg/prog"
+	"github.com/iyear/tdl/pkg/split"
 	"github.com/iyear/tdl/pkg/utils"
 )
 
@@ -25,15 +30,19 @@ type progress struct {
 	trackers *sync.Map // map[ID]*pw.Tracker
 	opts     Options
 
-	it *iter
+	it          *iter
+	reassembler *reassembler
+	secret      []byte // decryption secret, nil means no decryption
 }
 
-func newProgress(p pw.Writer, it *iter, opts Options) *progress {
+func newProgress(ctx context.Context, kvd storage.Storage, p pw.Writer, it *iter, opts Options, secret []byte) *progress {
 	return &progress{
-		pw:       p,
-		trackers: &sync.Map{},
-		opts:     opts,
-		it:       it,
+		pw:          p,
+		trackers:    &sync.Map{},
+		opts:        opts,
+		it:          it,
+		reassembler: newReassembler(ctx, kvd),
+		secret:      secret,
 	}
 }
 
@@ -102,6 +111,15 @@ func (p *progress) donePost(elem *iterElem) error {
 		return errors.Wrap(err, "rename file")
 	}
 
+	// encrypted by 'tdl upload --encrypt'
+	if p.secret != nil {
+		decrypted, err := decryptFile(newpath, p.secret)
+		if err != nil {
+			return errors.Wrap(err, "decrypt file")
+		}
+		newpath = decrypted
+	}
+
 	// Set file modification time to message date if available
 	if elem.file.Date > 0 {
 		fileTime := time.Unix(elem.file.Date, 0)
@@ -110,9 +128,84 @@ func (p *progress) donePost(elem *iterElem) error {
 		}
 	}
 
+	// part of split file uploaded by 'tdl upload --split-size'
+	if m, ok := split.Parse(elem.fromMsg.Message); ok {
+		// redacted parts can only be joined after decryption
+		if m.Name == "" && p.secret == nil {
+			p.pw.Log(color.YellowString("Skip reassembling encrypted part '%s', download with --decrypt to reassemble it", newpath))
+			return nil
+		}
+
+		joined, err := p.reassembler.add(m, newpath)
+		if err != nil {
+			return errors.Wrap(err, "reassemble parts")
+		}
+		if joined != "" {
+			p.pw.Log(color.GreenString("Reassembled %d parts into '%s'", m.Total, joined))
+		}
+	}
+
 	return nil
 }
 
+// decryptFile restores the original file next to the encrypted one and removes it.
+// Files that are not encrypted are left untouched.
+func decryptFile(path string, secret []byte) (_ string, rerr error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	defer func() { multierr.AppendInto(&rerr, src.Close()) }()
+
+	if !crypt.IsEncrypted(src) {
+		return path, nil
+	}
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "seek file")
+	}
+
+	temp := path + tempExt
+	dst, err := os.Create(temp)
+	if err != nil {
+		return "", errors.Wrap(err, "create file")
+	}
+
+	name, err := crypt.Decrypt(dst, src, secret)
+	multierr.AppendInto(&err, dst.Close())
+	if err != nil {
+		_ = os.Remove(temp)
+		return "", err
+	}
+
+	// never overwrite existing files, which may be another file with the same original name
+	newpath := filepath.Join(filepath.Dir(path), filepath.Base(name))
+	if newpath != path {
+		newpath = uniquePath(newpath)
+	}
+	if err = os.Rename(temp, newpath); err != nil {
+		return "", errors.Wrap(err, "rename file")
+	}
+	if newpath != path {
+		if err = os.Remove(path); err != nil {
+			return "", errors.Wrap(err, "remove encrypted file")
+		}
+	}
+
+	return newpath, nil
+}
+
+// uniquePath returns path if it doesn't exist, otherwise appends a counter
+// to the name, e.g. backup.tar -> backup (1).tar
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	for i := 1; fsutil.PathExists(path); i++ {
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	return path
+}
+
 func (p *progress) fail(t *pw.Tracker, elem downloader.Elem, err error) {
 	p.pw.Log(color.RedString("%s error: %s", p.elemString(elem), err.Error()))
 	t.MarkAsErrored()
@@ -0,0 +1,110 @@
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/key"
+	"github.com/iyear/tdl/pkg/split"
+)
+
+// reassembler collects downloaded parts of split files and joins them
+// once all parts of a file are downloaded. Downloaded parts are persisted,
+// so parts downloaded by different runs can be joined as well.
+type reassembler struct {
+	ctx context.Context
+	mu  *sync.Mutex
+	kvd storage.Storage
+}
+
+func newReassembler(ctx context.Context, kvd storage.Storage) *reassembler {
+	return &reassembler{
+		ctx: ctx,
+		mu:  &sync.Mutex{},
+		kvd: kvd,
+	}
+}
+
+// add records a downloaded part and returns the path of the joined file
+// if it's the last missing part. Empty path means the file is not complete yet.
+func (r *reassembler) add(m *split.Manifest, path string) (string, error) {
+	paths, err := r.record(m, path)
+	if err != nil {
+		return "", errors.Wrap(err, "record part")
+	}
+	if paths == nil {
+		return "", nil
+	}
+
+	// don't overwrite user's file which has the same name as the original
+	name := m.OriginalName(filepath.Base(path))
+	dst := uniquePath(filepath.Join(filepath.Dir(path), name))
+	if err = split.Join(dst, m, paths); err != nil {
+		return "", errors.Wrapf(err, "join %s", name)
+	}
+
+	for _, p := range paths {
+		multierr.AppendInto(&err, os.Remove(p))
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "remove parts")
+	}
+
+	if err = r.kvd.Delete(r.ctx, key.Parts(m.ID())); err != nil {
+		return "", errors.Wrap(err, "delete parts")
+	}
+
+	return dst, nil
+}
+
+// record persists the part, and returns paths of all parts (ordered by part index) if the file is complete
+func (r *reassembler) record(m *split.Manifest, path string) ([]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parts := make(map[int]string) // part index -> path
+	b, err := r.kvd.Get(r.ctx, key.Parts(m.ID()))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &parts); err != nil {
+			return nil, err
+		}
+	}
+	parts[m.Part] = abs
+
+	if b, err = json.Marshal(parts); err != nil {
+		return nil, err
+	}
+	if err = r.kvd.Set(r.ctx, key.Parts(m.ID()), b); err != nil {
+		return nil, err
+	}
+
+	if len(parts) < m.Total {
+		return nil, nil
+	}
+
+	paths := make([]string, 0, m.Total)
+	for i := 1; i <= m.Total; i++ {
+		p, ok := parts[i]
+		if !ok {
+			return nil, errors.Errorf("missing part %d of %s", i, m.ID())
+		}
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/gotd/td/tg"
 
 	"github.com/iyear/tdl/core/forwarder"
+	"github.com/iyear/tdl/core/uploader"
 )
 
 type iterElem struct {
@@ -13,6 +14,7 @@ type iterElem struct {
 	to           peers.Peer
 	thread       int
 	modeOverride forwarder.Mode
+	media        *replacement // nil means keeping original media
 	opts         iterOptions
 }
 
@@ -36,3 +38,10 @@ func (i *iterElem) AsSilent() bool { return i.opts.silent }
 func (i *iterElem) AsDryRun() bool { return i.opts.dryRun }
 
 func (i *iterElem) AsGrouped() bool { return i.opts.grouped }
+
+func (i *iterElem) Media() (uploader.File, error) {
+	if i.media == nil {
+		return nil, nil
+	}
+	return i.media.open(i.opts.dryRun)
+}
@@ -0,0 +1,441 @@
+package forward
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/spf13/viper"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/iyear/tdl/app/internal/tctx"
+	"github.com/iyear/tdl/core/dcpool"
+	"github.com/iyear/tdl/core/forwarder"
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/tclient"
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/consts"
+)
+
+const (
+	// followWait is the time to wait for messages arriving together, e.g. albums
+	followWait = time.Second
+	// followBatch is the max number of messages forwarded in one batch
+	followBatch = 100
+)
+
+// Updates handles updates of the client with gap recovery, which is required by follow mode.
+// It should be passed to the client as update handler.
+type Updates struct {
+	dispatcher tg.UpdateDispatcher
+	gaps       *updates.Manager
+}
+
+func NewUpdates(ctx context.Context, kvd storage.Storage) *Updates {
+	d := tg.NewUpdateDispatcher()
+
+	return &Updates{
+		dispatcher: d,
+		gaps: updates.New(updates.Config{
+			Handler: d,
+			Storage: storage.NewState(kvd),
+			Logger:  logctx.From(ctx).Named("updates"),
+		}),
+	}
+}
+
+func (u *Updates) Handle(ctx context.Context, updates tg.UpdatesClass) error {
+	return u.gaps.Handle(ctx, updates)
+}
+
+type follower struct {
+	client  *tg.Client
+	kvd     storage.Storage
+	opts    iterOptions
+	sources map[int64]peers.Peer
+	delete  bool
+	threads int
+
+	it    *followIter
+	queue chan *tg.Message
+}
+
+// Follow mirrors new messages of source chats as they arrive, and propagates edits
+// and optionally deletions to mirrored copies, until interrupted.
+func Follow(ctx context.Context, c *telegram.Client, kvd storage.Storage, u *Updates, opts Options) (rerr error) {
+	ctx = tctx.WithKV(ctx, kvd)
+
+	pool := dcpool.NewPool(c,
+		int64(viper.GetInt(consts.FlagPoolSize)),
+		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	defer multierr.AppendInvoke(&rerr, multierr.Close(pool))
+
+	ctx = tctx.WithPool(ctx, pool)
+
+	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(pool.Default(ctx))
+
+	sources := make(map[int64]peers.Peer, len(opts.From))
+	for _, from := range opts.From {
+		p, err := tutil.GetInputPeer(ctx, manager, from)
+		if err != nil {
+			return errors.Wrapf(err, "resolve source %s", from)
+		}
+		sources[p.ID()] = p
+	}
+
+	to, err := resolveDest(ctx, manager, opts.To)
+	if err != nil {
+		return errors.Wrap(err, "resolve dest peer")
+	}
+
+	edit, err := resolveEdit(opts.Edit)
+	if err != nil {
+		return errors.Wrap(err, "resolve edit")
+	}
+
+	self, err := c.Self(ctx)
+	if err != nil {
+		return errors.Wrap(err, "get self")
+	}
+
+	f := &follower{
+		client: pool.Default(ctx),
+		kvd:    kvd,
+		opts: iterOptions{
+			manager:   manager,
+			toManager: manager,
+			pool:      pool,
+			to:        to,
+			edit:      edit,
+			mode:      opts.Mode,
+			silent:    opts.Silent,
+			dryRun:    opts.DryRun,
+			grouped:   !opts.Single,
+		},
+		sources: sources,
+		delete:  opts.MirrorDelete,
+		threads: viper.GetInt(consts.FlagThreads),
+		it:      &followIter{},
+		queue:   make(chan *tg.Message, 1024),
+	}
+
+	if f.directOnly() {
+		color.Yellow("Edits of source messages can't be mirrored in direct mode, use '--mode clone' if needed")
+	}
+
+	d := u.dispatcher
+	d.OnNewMessage(func(ctx context.Context, _ tg.Entities, u *tg.UpdateNewMessage) error {
+		return f.onNew(ctx, u.Message)
+	})
+	d.OnNewChannelMessage(func(ctx context.Context, _ tg.Entities, u *tg.UpdateNewChannelMessage) error {
+		return f.onNew(ctx, u.Message)
+	})
+	d.OnEditMessage(func(ctx context.Context, _ tg.Entities, u *tg.UpdateEditMessage) error {
+		return f.onEdit(ctx, u.Message)
+	})
+	d.OnEditChannelMessage(func(ctx context.Context, _ tg.Entities, u *tg.UpdateEditChannelMessage) error {
+		return f.onEdit(ctx, u.Message)
+	})
+	d.OnDeleteMessages(func(ctx context.Context, _ tg.Entities, u *tg.UpdateDeleteMessages) error {
+		// ids of users and basic groups are unique for the account, but the peer is unknown
+		for id, p := range f.sources {
+			if _, ok := p.(peers.Channel); !ok {
+				f.onDelete(ctx, id, u.Messages)
+			}
+		}
+		return nil
+	})
+	d.OnDeleteChannelMessages(func(ctx context.Context, _ tg.Entities, u *tg.UpdateDeleteChannelMessages) error {
+		f.onDelete(ctx, u.ChannelID, u.Messages)
+		return nil
+	})
+
+	wg, wgctx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		return f.run(wgctx)
+	})
+	wg.Go(func() error {
+		return u.gaps.Run(wgctx, c.API(), self.ID, updates.AuthOptions{
+			IsBot: self.Bot,
+			OnStart: func(ctx context.Context) {
+				color.Green("Following %d chat(s), press Ctrl+C to stop", len(sources))
+			},
+		})
+	})
+
+	return wg.Wait()
+}
+
+func (f *follower) onNew(ctx context.Context, m tg.MessageClass) error {
+	msg, ok := m.(*tg.Message) // skip service messages
+	if !ok {
+		return nil
+	}
+
+	from := tutil.GetPeerID(msg.PeerID)
+	if _, ok = f.sources[from]; !ok {
+		return nil
+	}
+
+	// already mirrored, e.g. updates are received again after restart
+	if mirrors, err := getMirrors(ctx, f.kvd, from, msg.ID); err == nil && len(mirrors) > 0 {
+		return nil
+	}
+
+	select {
+	case f.queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run forwards queued messages in batches
+func (f *follower) run(ctx context.Context) error {
+	for {
+		var msgs []*tg.Message
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-f.queue:
+			msgs = append(msgs, msg)
+		}
+
+		timer := time.NewTimer(followWait)
+	collect:
+		for len(msgs) < followBatch {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case msg := <-f.queue:
+				msgs = append(msgs, msg)
+			case <-timer.C:
+				break collect
+			}
+		}
+
+		timer.Stop()
+
+		elems := make([]forwarder.Elem, 0, len(msgs))
+		for _, msg := range msgs {
+			from := tutil.GetPeerID(msg.PeerID)
+			// mirrored as a part of album in previous batch
+			if mirrors, err := getMirrors(ctx, f.kvd, from, msg.ID); err == nil && len(mirrors) > 0 {
+				continue
+			}
+
+			elem, err := newElem(ctx, f.opts, f.sources[from], msg)
+			if err != nil {
+				logctx.From(ctx).Warn("Build forward element",
+					zap.Int("message", msg.ID),
+					zap.Error(err))
+				continue
+			}
+			// message is skipped by edit expression
+			if elem == nil {
+				continue
+			}
+
+			// mirrored messages will be received again if destination is a source
+			if _, ok := f.sources[elem.To().ID()]; ok {
+				logctx.From(ctx).Warn("Skip forwarding to a followed chat",
+					zap.Int64("to", elem.To().ID()),
+					zap.Int("message", msg.ID))
+				continue
+			}
+
+			elems = append(elems, elem)
+		}
+
+		f.it.reset(elems)
+		// forwarder is created for each batch, so sent messages are not kept for the whole run.
+		// Albums sent in previous batches are filtered by recorded mirrors above.
+		fw := forwarder.New(forwarder.Options{
+			Pool:     f.opts.pool,
+			Iter:     f.it,
+			Progress: newFollowProgress(),
+			Threads:  f.threads,
+			// mirrors are always recorded to propagate edits and deletions
+			Mapping: kvMapping{kvd: f.kvd},
+		})
+		if err := fw.Forward(ctx); err != nil {
+			return errors.Wrap(err, "forward")
+		}
+	}
+}
+
+// directOnly reports whether all messages are forwarded directly, whose copies can't be edited.
+// Edit expression forces clone mode.
+func (f *follower) directOnly() bool {
+	return f.opts.mode == forwarder.ModeDirect && f.opts.edit == nil
+}
+
+// onEdit propagates the edited text or caption to mirrored copies
+func (f *follower) onEdit(ctx context.Context, m tg.MessageClass) error {
+	msg, ok := m.(*tg.Message)
+	if !ok {
+		return nil
+	}
+
+	from, ok := f.sources[tutil.GetPeerID(msg.PeerID)]
+	if !ok || f.directOnly() {
+		return nil
+	}
+
+	log := logctx.From(ctx).With(
+		zap.Int64("from", from.ID()),
+		zap.Int("message", msg.ID))
+
+	mirrors, err := getMirrors(ctx, f.kvd, from.ID(), msg.ID)
+	if err != nil {
+		log.Warn("Get mirrors", zap.Error(err))
+		return nil
+	}
+	if len(mirrors) == 0 {
+		return nil
+	}
+
+	// apply edit expression to the new content
+	elem, err := newElem(ctx, f.opts, from, msg)
+	if err != nil {
+		log.Warn("Build forward element", zap.Error(err))
+		return nil
+	}
+	if elem == nil {
+		return nil
+	}
+
+	for _, mr := range mirrors {
+		to, err := tutil.GetInputPeer(ctx, f.opts.toManager, strconv.FormatInt(mr.Peer, 10))
+		if err != nil {
+			log.Warn("Resolve mirror peer", zap.Int64("peer", mr.Peer), zap.Error(err))
+			continue
+		}
+
+		req := &tg.MessagesEditMessageRequest{
+			Peer:     to.InputPeer(),
+			ID:       mr.Msg,
+			Message:  elem.msg.Message,
+			Entities: elem.msg.Entities,
+		}
+		req.SetFlags()
+
+		// directly forwarded copies can't be edited, only cloned ones
+		if _, err = f.client.MessagesEditMessage(ctx, req); err != nil && !tgerr.Is(err, "MESSAGE_NOT_MODIFIED") {
+			log.Warn("Edit mirrored message",
+				zap.Int64("peer", mr.Peer),
+				zap.Int("mirror", mr.Msg),
+				zap.Error(err))
+			continue
+		}
+
+		color.Blue("Edited %d:%d -> %d:%d", from.ID(), msg.ID, mr.Peer, mr.Msg)
+	}
+
+	return nil
+}
+
+// onDelete deletes mirrored copies of deleted source messages if enabled
+func (f *follower) onDelete(ctx context.Context, from int64, ids []int) {
+	if !f.delete {
+		return
+	}
+	if _, ok := f.sources[from]; !ok {
+		return
+	}
+
+	log := logctx.From(ctx).With(zap.Int64("from", from))
+
+	// destination peer -> mirrored message ids
+	targets := make(map[int64][]int)
+	for _, id := range ids {
+		mirrors, err := getMirrors(ctx, f.kvd, from, id)
+		if err != nil {
+			log.Warn("Get mirrors", zap.Int("message", id), zap.Error(err))
+			continue
+		}
+		if len(mirrors) == 0 {
+			continue
+		}
+
+		for _, mr := range mirrors {
+			targets[mr.Peer] = append(targets[mr.Peer], mr.Msg)
+		}
+		if err = deleteMirrors(ctx, f.kvd, from, id); err != nil {
+			log.Warn("Delete mirrors", zap.Int("message", id), zap.Error(err))
+		}
+	}
+
+	for peer, msgs := range targets {
+		to, err := tutil.GetInputPeer(ctx, f.opts.toManager, strconv.FormatInt(peer, 10))
+		if err != nil {
+			log.Warn("Resolve mirror peer", zap.Int64("peer", peer), zap.Error(err))
+			continue
+		}
+
+		if _, err = message.NewSender(f.client).To(to.InputPeer()).Revoke().Messages(ctx, msgs...); err != nil {
+			log.Warn("Delete mirrored messages", zap.Int64("peer", peer), zap.Error(err))
+			continue
+		}
+
+		color.Yellow("Deleted %d mirrored message(s) in %d", len(msgs), peer)
+	}
+}
+
+// followIter iterates over queued elements, it's reset for each batch of new messages
+type followIter struct {
+	elems []forwarder.Elem
+	cur   forwarder.Elem
+}
+
+func (i *followIter) reset(elems []forwarder.Elem) {
+	i.elems, i.cur = elems, nil
+}
+
+func (i *followIter) Next(ctx context.Context) bool {
+	if ctx.Err() != nil || len(i.elems) == 0 {
+		return false
+	}
+
+	i.cur, i.elems = i.elems[0], i.elems[1:]
+	return true
+}
+
+func (i *followIter) Value() forwarder.Elem { return i.cur }
+
+func (i *followIter) Err() error { return nil }
+
+// followProgress prints results instead of progress bars
+type followProgress struct {
+	names *progress // only used to format elements
+}
+
+func newFollowProgress() *followProgress {
+	return &followProgress{names: newProgress(nil, nil, nil)}
+}
+
+func (p *followProgress) OnAdd(_ forwarder.Elem) {}
+
+func (p *followProgress) OnClone(_ forwarder.Elem, _ forwarder.ProgressState) {}
+
+func (p *followProgress) OnDone(elem forwarder.Elem, err error) {
+	if err != nil {
+		color.Red("%s error: %s", p.names.metaString(elem), err.Error())
+		return
+	}
+
+	color.Green("Forwarded %s", p.names.metaString(elem))
+}
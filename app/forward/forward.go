@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"reflect"
 	"strings"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
+	"github.com/fatih/color"
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/peers"
@@ -35,11 +35,36 @@ type Options struct {
 	Mode   forwarder.Mode
 	Silent bool
 	DryRun bool
+	Plan   PlanOutput
 	Single bool
 	Desc   bool
+
+	Continue bool
+	Restart  bool
+
+	Follow       bool
+	MirrorDelete bool
+
+	PersistMap bool
+
+	FromNS string
+	ToNS   string
+}
+
+// Account is a logged-in client with storage of its namespace
+type Account struct {
+	Client *telegram.Client
+	KV     storage.Storage
+}
+
+func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Options) error {
+	account := Account{Client: c, KV: kvd}
+	return RunWith(ctx, account, account, opts)
 }
 
-func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Options) (rerr error) {
+// RunWith reads source messages with the from account, and sends them with the to account.
+// Messages are always cloned if accounts are different, because the to account may not access source chats.
+func RunWith(ctx context.Context, from, to Account, opts Options) (rerr error) {
 	if opts.To == "-" || opts.Edit == "-" {
 		fg := texpr.NewFieldsGetter(nil)
 
@@ -52,13 +77,24 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		return nil
 	}
 
-	ctx = tctx.WithKV(ctx, kvd)
+	ctx = tctx.WithKV(ctx, from.KV)
+
+	newPool := func(c *telegram.Client) dcpool.Pool {
+		return dcpool.NewPool(c,
+			int64(viper.GetInt(consts.FlagPoolSize)),
+			tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	}
 
-	pool := dcpool.NewPool(c,
-		int64(viper.GetInt(consts.FlagPoolSize)),
-		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	pool := newPool(from.Client)
 	defer multierr.AppendInvoke(&rerr, multierr.Close(pool))
 
+	// pool of the account which sends messages
+	toPool, source := pool, dcpool.Pool(nil)
+	if from.Client != to.Client {
+		toPool, source = newPool(to.Client), pool
+		defer multierr.AppendInvoke(&rerr, multierr.Close(toPool))
+	}
+
 	ctx = tctx.WithPool(ctx, pool)
 
 	dialogs, err := collectDialogs(ctx, opts.From, opts.Desc)
@@ -66,9 +102,13 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		return errors.Wrap(err, "collect dialogs")
 	}
 
-	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(pool.Default(ctx))
+	manager := peers.Options{Storage: storage.NewPeers(from.KV)}.Build(pool.Default(ctx))
+	toManager := manager
+	if source != nil {
+		toManager = peers.Options{Storage: storage.NewPeers(to.KV)}.Build(toPool.Default(ctx))
+	}
 
-	to, err := resolveDest(ctx, manager, opts.To)
+	dest, err := resolveDest(ctx, toManager, opts.To)
 	if err != nil {
 		return errors.Wrap(err, "resolve dest peer")
 	}
@@ -78,26 +118,59 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		return errors.Wrap(err, "resolve edit")
 	}
 
+	it := newIter(iterOptions{
+		manager:   manager,
+		toManager: toManager,
+		pool:      pool,
+		to:        dest,
+		edit:      edit,
+		dialogs:   dialogs,
+		mode:      opts.Mode,
+		silent:    opts.Silent,
+		dryRun:    opts.DryRun,
+		grouped:   !opts.Single,
+		delay:     viper.GetDuration(consts.FlagDelay),
+	})
+
+	// dry run doesn't send anything, so there is no progress to resume
+	if !opts.DryRun {
+		if !opts.Restart {
+			// resume forward and ask user to continue
+			if err = resume(ctx, to.KV, it, !opts.Continue); err != nil {
+				return err
+			}
+		} else {
+			color.Yellow("Restart forward by 'restart' flag")
+		}
+
+		defer func() { // save progress, even if interrupted
+			multierr.AppendInto(&rerr, saveProgress(ctx, to.KV, it))
+		}()
+	}
+
 	fwProgress := prog.New(pw.FormatNumber)
-	fwProgress.SetNumTrackersExpected(totalMessages(dialogs))
+	fwProgress.SetNumTrackersExpected(it.Total() - it.Finished().count())
 	prog.EnablePS(ctx, fwProgress)
 
+	var mapping forwarder.Mapping // in-memory by default
+	if opts.PersistMap {
+		mapping = kvMapping{kvd: to.KV}
+	}
+
+	var pl *plan
+	if opts.DryRun {
+		pl = newPlan()
+		// print plan after progress is finished
+		defer func() { multierr.AppendInto(&rerr, pl.print(opts.Plan)) }()
+	}
+
 	fw := forwarder.New(forwarder.Options{
-		Pool: pool,
-		Iter: newIter(iterOptions{
-			manager: manager,
-			pool:    pool,
-			to:      to,
-			edit:    edit,
-			dialogs: dialogs,
-			mode:    opts.Mode,
-			silent:  opts.Silent,
-			dryRun:  opts.DryRun,
-			grouped: !opts.Single,
-			delay:   viper.GetDuration(consts.FlagDelay),
-		}),
-		Progress: newProgress(fwProgress),
+		Pool:     toPool,
+		Source:   source,
+		Iter:     it,
+		Progress: newProgress(fwProgress, it, pl),
 		Threads:  viper.GetInt(consts.FlagThreads),
+		Mapping:  mapping,
 	})
 
 	go fwProgress.Render()
@@ -116,6 +189,11 @@ func collectDialogs(ctx context.Context, input []string, desc bool) ([]*tmessage
 		)
 
 		switch {
+		case strings.HasPrefix(p, tmessage.QueryPrefix):
+			d, err = tmessage.Parse(tmessage.FromQuery(ctx, tctx.Pool(ctx), tctx.KV(ctx), []string{p}))
+			if err != nil {
+				return nil, errors.Wrap(err, "parse from query")
+			}
 		case strings.HasPrefix(p, "http"):
 			d, err = tmessage.Parse(tmessage.FromURL(ctx, tctx.Pool(ctx), tctx.KV(ctx), []string{p}))
 			if err != nil {
@@ -170,10 +248,11 @@ func resolveDest(ctx context.Context, manager *peers.Manager, input string) (*vm
 }
 
 // resolveEdit returns nil if input is empty, otherwise it returns a vm.Program. It can be a text or a file based on expression engine.
+// The program returns edited text, a transform or nil to skip the message.
 func resolveEdit(input string) (*vm.Program, error) {
 	compile := func(i string) (*vm.Program, error) {
 		// we pass empty peer and message to enable type checking
-		return expr.Compile(i, expr.Env(exprEnv(nil, nil)), expr.AsKind(reflect.String))
+		return expr.Compile(i, expr.Env(exprEnv(nil, nil)))
 	}
 
 	// no edit, nil program
@@ -2,13 +2,11 @@ package forward
 
 import (
 	"context"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/expr-lang/expr/vm"
 	"github.com/go-faster/errors"
-	"github.com/gotd/td/telegram/message/entity"
-	"github.com/gotd/td/telegram/message/html"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
 	"github.com/mitchellh/mapstructure"
@@ -21,16 +19,17 @@ import (
 )
 
 type iterOptions struct {
-	manager *peers.Manager
-	pool    dcpool.Pool
-	to      *vm.Program
-	edit    *vm.Program
-	dialogs []*tmessage.Dialog
-	mode    forwarder.Mode
-	silent  bool
-	dryRun  bool
-	grouped bool
-	delay   time.Duration
+	manager   *peers.Manager // manager of source account
+	toManager *peers.Manager // manager of destination account
+	pool      dcpool.Pool
+	to        *vm.Program
+	edit      *vm.Program
+	dialogs   []*tmessage.Dialog
+	mode      forwarder.Mode
+	silent    bool
+	dryRun    bool
+	grouped   bool
+	delay     time.Duration
 }
 
 type iter struct {
@@ -39,6 +38,10 @@ type iter struct {
 	i, j int
 	elem forwarder.Elem
 	err  error
+
+	mu          sync.Mutex
+	finished    finished
+	fingerprint string
 }
 
 type env struct {
@@ -79,6 +82,9 @@ func newIter(opts iterOptions) *iter {
 		j:    0,
 		elem: nil,
 		err:  nil,
+
+		finished:    make(finished),
+		fingerprint: fingerprint(opts),
 	}
 }
 
@@ -90,40 +96,81 @@ func (i *iter) Next(ctx context.Context) bool {
 	default:
 	}
 
-	// end of iteration or error occurred
-	if i.i >= len(i.opts.dialogs) || i.err != nil {
-		return false
-	}
-
 	// if delay is set, sleep for a while for each iteration
 	if i.opts.delay > 0 && (i.i+i.j) > 0 { // skip first delay
 		time.Sleep(i.opts.delay)
 	}
 
-	p, m := i.opts.dialogs[i.i].Peer, i.opts.dialogs[i.i].Messages[i.j]
+	for {
+		elem, ok := i.next(ctx)
+		if !ok {
+			return false
+		}
+		// message is skipped by edit expression
+		if elem == nil {
+			continue
+		}
+
+		i.elem = elem
+		return true
+	}
+}
+
+func (i *iter) next(ctx context.Context) (*iterElem, bool) {
+	var (
+		p tg.InputPeerClass
+		m int
+	)
+	for {
+		// end of iteration or error occurred
+		if i.i >= len(i.opts.dialogs) || i.err != nil {
+			return nil, false
+		}
+
+		p, m = i.opts.dialogs[i.i].Peer, i.opts.dialogs[i.i].Messages[i.j]
 
-	if i.j++; i.j >= len(i.opts.dialogs[i.i].Messages) {
-		i.i++
-		i.j = 0
+		if i.j++; i.j >= len(i.opts.dialogs[i.i].Messages) {
+			i.i++
+			i.j = 0
+		}
+
+		// skip messages forwarded in last run
+		if !i.isFinished(tutil.GetInputPeerID(p), m) {
+			break
+		}
 	}
 
 	from, err := i.opts.manager.FromInputPeer(ctx, p)
 	if err != nil {
 		i.err = errors.Wrap(err, "get from peer")
-		return false
+		return nil, false
 	}
 
 	msg, err := tutil.GetSingleMessage(ctx, i.opts.pool.Default(ctx), from.InputPeer(), m)
 	if err != nil {
 		i.err = errors.Wrapf(err, "get message: %d", m)
-		return false
+		return nil, false
+	}
+
+	elem, err := newElem(ctx, i.opts, from, msg)
+	if err != nil {
+		i.err = err
+		return nil, false
+	}
+	if elem == nil {
+		// skipped messages are also finished, so they won't block resuming
+		i.Finish(from.ID(), m)
 	}
 
+	return elem, true
+}
+
+// newElem routes and edits the message by expressions, and returns the element to be forwarded
+func newElem(ctx context.Context, opts iterOptions, from peers.Peer, msg *tg.Message) (*iterElem, error) {
 	// message routing
-	result, err := texpr.Run(i.opts.to, exprEnv(from, msg))
+	result, err := texpr.Run(opts.to, exprEnv(from, msg))
 	if err != nil {
-		i.err = errors.Wrap(err, "message routing")
-		return false
+		return nil, errors.Wrap(err, "message routing")
 	}
 
 	var (
@@ -135,76 +182,80 @@ func (i *iter) Next(ctx context.Context) bool {
 	case string:
 		// pure chat, no reply to, which is a compatible with old version
 		// and a convenient way to send message to self
-		to, err = i.resolvePeer(ctx, r)
+		to, err = resolvePeer(ctx, opts.toManager, r)
 	case map[string]interface{}:
 		// chat with reply to topic or message
 		var d dest
 
 		if err = mapstructure.WeakDecode(r, &d); err != nil {
-			i.err = errors.Wrapf(err, "decode dest: %v", result)
-			return false
+			return nil, errors.Wrapf(err, "decode dest: %v", result)
 		}
 
-		to, err = i.resolvePeer(ctx, d.Peer)
+		to, err = resolvePeer(ctx, opts.toManager, d.Peer)
 		thread = d.Thread
 	default:
-		i.err = errors.Errorf("message router must return string or dest: %T", result)
-		return false
+		return nil, errors.Errorf("message router must return string or dest: %T", result)
 	}
 
-	var modeOverride forwarder.Mode = -1 // default value is invalid
+	var (
+		modeOverride forwarder.Mode = -1 // default value is invalid
+		media        *replacement
+	)
 	// edit message
-	if i.opts.edit != nil {
-		result, err = texpr.Run(i.opts.edit, exprEnv(from, msg))
+	if opts.edit != nil {
+		result, err = texpr.Run(opts.edit, exprEnv(from, msg))
 		if err != nil {
-			i.err = errors.Wrap(err, "edit message")
-			return false
+			return nil, errors.Wrap(err, "edit message")
 		}
 
-		r, ok := result.(string)
-		if !ok {
-			i.err = errors.Errorf("edit must return string: %T", result)
-			return false
-		}
-
-		eb := entity.Builder{}
-		if err = html.HTML(strings.NewReader(r), &eb, html.Options{
-			UserResolver:          nil,
-			DisableTelegramEscape: false,
-		}); err != nil {
-			i.err = errors.Wrap(err, "parse edited message")
-			return false
+		var t transform
+		switch r := result.(type) {
+		case nil:
+			// skip the message
+			return nil, nil
+		case string:
+			// pure text, which is compatible with old version
+			t.Text = &r
+		case map[string]interface{}:
+			if err = mapstructure.WeakDecode(r, &t); err != nil {
+				return nil, errors.Wrapf(err, "decode transform: %v", result)
+			}
+		default:
+			return nil, errors.Errorf("edit must return string, transform or nil: %T", result)
 		}
 
 		// modify message
-		msg.Message, msg.Entities = eb.Complete()
+		if err = t.apply(msg); err != nil {
+			return nil, errors.Wrap(err, "transform message")
+		}
+		if media, err = t.media(ctx, opts.pool, msg); err != nil {
+			return nil, errors.Wrap(err, "transform media")
+		}
 		// direct mode can't modify message content, so we force it to be clone mode
 		modeOverride = forwarder.ModeClone
 	}
 
 	if err != nil {
-		i.err = errors.Wrapf(err, "resolve dest: %v", result)
-		return false
+		return nil, errors.Wrapf(err, "resolve dest: %v", result)
 	}
 
-	i.elem = &iterElem{
+	return &iterElem{
 		from:         from,
 		msg:          msg,
 		to:           to,
 		thread:       thread,
 		modeOverride: modeOverride,
-		opts:         i.opts,
-	}
-
-	return true
+		media:        media,
+		opts:         opts,
+	}, nil
 }
 
-func (i *iter) resolvePeer(ctx context.Context, peer string) (peers.Peer, error) {
+func resolvePeer(ctx context.Context, manager *peers.Manager, peer string) (peers.Peer, error) {
 	if peer == "" { // self
-		return i.opts.manager.Self(ctx)
+		return manager.Self(ctx)
 	}
 
-	return tutil.GetInputPeer(ctx, i.opts.manager, peer)
+	return tutil.GetInputPeer(ctx, manager, peer)
 }
 
 func (i *iter) Value() forwarder.Elem {
@@ -214,3 +265,61 @@ func (i *iter) Value() forwarder.Elem {
 func (i *iter) Err() error {
 	return i.err
 }
+
+func (i *iter) isFinished(peer int64, msg int) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	_, ok := i.finished[peer][msg]
+	return ok
+}
+
+func (i *iter) SetFinished(done finished) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.finished = done
+}
+
+func (i *iter) Finish(peer int64, msgs ...int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.finished[peer] == nil {
+		i.finished[peer] = make(map[int]struct{})
+	}
+	for _, msg := range msgs {
+		i.finished[peer][msg] = struct{}{}
+	}
+}
+
+func (i *iter) Finished() finished {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.finished
+}
+
+// Done reports whether all messages of dialogs are forwarded
+func (i *iter) Done() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, d := range i.opts.dialogs {
+		done := i.finished[tutil.GetInputPeerID(d.Peer)]
+		for _, msg := range d.Messages {
+			if _, ok := done[msg]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (i *iter) Total() int {
+	return totalMessages(i.opts.dialogs)
+}
+
+func (i *iter) Fingerprint() string {
+	return i.fingerprint
+}
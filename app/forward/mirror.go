@@ -0,0 +1,73 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/key"
+)
+
+// kvMapping is a forwarder.Mapping persisted by mirrors in kv storage
+type kvMapping struct {
+	kvd storage.Storage
+}
+
+func (m kvMapping) Get(ctx context.Context, from int64, msg int, to int64) (int, bool, error) {
+	mirrors, err := getMirrors(ctx, m.kvd, from, msg)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, mr := range mirrors {
+		if mr.Peer == to {
+			return mr.Msg, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (m kvMapping) Set(ctx context.Context, from int64, msg int, to int64, dst int) error {
+	return addMirror(ctx, m.kvd, from, msg, mirror{Peer: to, Msg: dst})
+}
+
+// mirror is a destination copy of the source message
+type mirror struct {
+	Peer int64 `json:"peer"`
+	Msg  int   `json:"msg"`
+}
+
+func getMirrors(ctx context.Context, kvd storage.Storage, peer int64, msg int) ([]mirror, error) {
+	b, err := kvd.Get(ctx, key.Mirror(peer, msg))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var mirrors []mirror
+	if err = json.Unmarshal(b, &mirrors); err != nil {
+		return nil, errors.Wrap(err, "unmarshal mirrors")
+	}
+	return mirrors, nil
+}
+
+func addMirror(ctx context.Context, kvd storage.Storage, peer int64, msg int, m mirror) error {
+	mirrors, err := getMirrors(ctx, kvd, peer, msg)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(append(mirrors, m))
+	if err != nil {
+		return err
+	}
+	return kvd.Set(ctx, key.Mirror(peer, msg), b)
+}
+
+func deleteMirrors(ctx context.Context, kvd storage.Storage, peer int64, msg int) error {
+	return kvd.Delete(ctx, key.Mirror(peer, msg))
+}
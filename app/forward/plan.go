@@ -0,0 +1,129 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/mattn/go-runewidth"
+
+	"github.com/iyear/tdl/core/forwarder"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+//go:generate go-enum --names --values --flag --nocase
+
+// PlanOutput
+// ENUM(table, json)
+type PlanOutput int
+
+// planItem describes how a message would be forwarded in dry run
+type planItem struct {
+	From      int64  `json:"from"`
+	FromName  string `json:"from_name"`
+	Messages  []int  `json:"messages"`
+	To        int64  `json:"to"`
+	ToName    string `json:"to_name"`
+	Thread    int    `json:"thread,omitempty"`
+	Mode      string `json:"mode"` // direct, clone or text
+	Text      string `json:"text,omitempty"`
+	MediaSize int64  `json:"media_size"`
+	Error     string `json:"error,omitempty"`
+}
+
+type plan struct {
+	items []*planItem
+}
+
+func newPlan() *plan {
+	// empty plan is printed as [] instead of null in json
+	return &plan{items: make([]*planItem, 0)}
+}
+
+func (p *plan) add(elem forwarder.Elem, pl forwarder.Plan) {
+	item := &planItem{
+		From:      elem.From().ID(),
+		FromName:  elem.From().VisibleName(),
+		Messages:  pl.Messages,
+		To:        elem.To().ID(),
+		ToName:    elem.To().VisibleName(),
+		Thread:    elem.Thread(),
+		Mode:      pl.Mode.String(),
+		Text:      elem.Msg().Message, // edited text
+		MediaSize: pl.MediaSize,
+	}
+	if pl.TextOnly {
+		item.Mode = "text"
+	}
+	if pl.Err != nil {
+		item.Error = pl.Err.Error()
+	}
+
+	p.items = append(p.items, item)
+}
+
+func (p *plan) print(output PlanOutput) error {
+	switch output {
+	case PlanOutputTable:
+		p.printTable()
+	case PlanOutputJson:
+		bytes, err := json.MarshalIndent(p.items, "", "\t")
+		if err != nil {
+			return errors.Wrap(err, "marshal json")
+		}
+
+		fmt.Println(string(bytes))
+	default:
+		return errors.Errorf("unknown plan output: %s", output)
+	}
+
+	return nil
+}
+
+func (p *plan) printTable() {
+	fmt.Printf("%s %s %s %s %s %s %s\n",
+		trunc("From", 25),
+		trunc("Messages", 15),
+		trunc("To", 25),
+		trunc("Thread", 8),
+		trunc("Mode", 6),
+		trunc("Size", 10),
+		"Text")
+
+	for _, item := range p.items {
+		msgs := make([]string, 0, len(item.Messages))
+		for _, m := range item.Messages {
+			msgs = append(msgs, strconv.Itoa(m))
+		}
+
+		thread := "-"
+		if item.Thread != 0 {
+			thread = strconv.Itoa(item.Thread)
+		}
+
+		text := strings.Join(strings.Fields(item.Text), " ")
+		if item.Error != "" {
+			text = "error: " + item.Error
+		}
+
+		fmt.Printf("%s %s %s %s %s %s %s\n",
+			trunc(fmt.Sprintf("%s(%d)", item.FromName, item.From), 25),
+			trunc(strings.Join(msgs, ","), 15),
+			trunc(fmt.Sprintf("%s(%d)", item.ToName, item.To), 25),
+			trunc(thread, 8),
+			trunc(item.Mode, 6),
+			trunc(utils.Byte.FormatBinaryBytes(item.MediaSize), 10),
+			runewidth.Truncate(text, 50, "..."))
+	}
+}
+
+func trunc(s string, len int) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		s = "-"
+	}
+
+	return runewidth.FillRight(runewidth.Truncate(s, len, "..."), len)
+}
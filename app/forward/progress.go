@@ -15,6 +15,8 @@ import (
 
 type progress struct {
 	pw       pw.Writer
+	it       *iter
+	plan     *plan                 // only set in dry run
 	trackers map[tuple]*pw.Tracker // TODO(iyear): concurrent map
 	elemName map[int64]string
 }
@@ -25,9 +27,11 @@ type tuple struct {
 	to   int64
 }
 
-func newProgress(p pw.Writer) *progress {
+func newProgress(p pw.Writer, it *iter, plan *plan) *progress {
 	return &progress{
 		pw:       p,
+		it:       it,
+		plan:     plan,
 		trackers: make(map[tuple]*pw.Tracker),
 		elemName: make(map[int64]string),
 	}
@@ -69,6 +73,19 @@ func (p *progress) OnDone(elem forwarder.Elem, err error) {
 	tracker.MarkAsDone()
 }
 
+func (p *progress) OnSent(elem forwarder.Elem, msgs map[int]int) {
+	for msg := range msgs {
+		p.it.Finish(elem.From().ID(), msg)
+	}
+}
+
+func (p *progress) OnPlan(elem forwarder.Elem, plan forwarder.Plan) {
+	if p.plan == nil {
+		return
+	}
+	p.plan.add(elem, plan)
+}
+
 func (p *progress) tuple(elem forwarder.Elem) tuple {
 	return tuple{
 		from: elem.From().ID(),
@@ -0,0 +1,119 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/key"
+)
+
+// finished records forwarded source messages: peer id -> message ids
+type finished map[int64]map[int]struct{}
+
+func (f finished) count() int {
+	n := 0
+	for _, msgs := range f {
+		n += len(msgs)
+	}
+	return n
+}
+
+func resume(ctx context.Context, kvd storage.Storage, it *iter, ask bool) error {
+	logctx.From(ctx).Debug("Check resume key",
+		zap.String("fingerprint", it.Fingerprint()))
+
+	b, err := kvd.Get(ctx, key.Resume(it.Fingerprint()))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if len(b) == 0 { // no progress
+		return nil
+	}
+
+	done := make(finished)
+	if err = json.Unmarshal(b, &done); err != nil {
+		return err
+	}
+
+	// finished is empty, no need to resume
+	if done.count() == 0 {
+		return nil
+	}
+
+	confirm := false
+	resumeStr := fmt.Sprintf("Found unfinished forward, continue from '%d/%d'", done.count(), it.Total())
+	if ask {
+		if err = survey.AskOne(&survey.Confirm{
+			Message: color.YellowString(resumeStr + "?"),
+		}, &confirm); err != nil {
+			return err
+		}
+	} else {
+		color.Yellow(resumeStr)
+		confirm = true
+	}
+
+	logctx.From(ctx).Debug("Resume forward",
+		zap.Int("finished", done.count()))
+
+	if !confirm {
+		// clear resume key
+		return kvd.Delete(ctx, key.Resume(it.Fingerprint()))
+	}
+
+	it.SetFinished(done)
+	return nil
+}
+
+func saveProgress(ctx context.Context, kvd storage.Storage, it *iter) error {
+	done := it.Finished()
+	logctx.From(ctx).Debug("Save progress",
+		zap.Int("finished", done.count()))
+
+	// all messages are forwarded, clear resume key
+	if it.Done() {
+		return kvd.Delete(ctx, key.Resume(it.Fingerprint()))
+	}
+
+	b, err := json.Marshal(done)
+	if err != nil {
+		return err
+	}
+	return kvd.Set(ctx, key.Resume(it.Fingerprint()), b)
+}
+
+// fingerprint identifies a forward job by its sources, routing and edit programs, and mode
+func fingerprint(opts iterOptions) string {
+	endian := binary.BigEndian
+	buf, b := &bytes.Buffer{}, make([]byte, 8)
+	for _, d := range opts.dialogs {
+		endian.PutUint64(b, uint64(tutil.GetInputPeerID(d.Peer)))
+		buf.Write(b)
+		for _, msg := range d.Messages {
+			endian.PutUint64(b, uint64(msg))
+			buf.Write(b)
+		}
+	}
+
+	buf.WriteString(opts.to.Source().String())
+	buf.WriteByte(0)
+	if opts.edit != nil {
+		buf.WriteString(opts.edit.Source().String())
+	}
+	buf.WriteByte(0)
+	fmt.Fprintf(buf, "%s:%t", opts.mode, opts.grouped)
+
+	return fmt.Sprintf("%x", sha256.Sum256(buf.Bytes()))
+}
@@ -0,0 +1,348 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/telegram/message/entity"
+	"github.com/gotd/td/telegram/message/html"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/dcpool"
+	tdownloader "github.com/iyear/tdl/core/downloader"
+	"github.com/iyear/tdl/core/tmedia"
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/pkg/watermark"
+)
+
+// transform is the structured result of edit expression
+type transform struct {
+	Text          *string           // new text or caption in HTML, nil keeps the original one
+	Replace       map[string]string // replace plain text, e.g. links or mentions
+	StripLinks    bool              // remove links, text of text links is kept
+	StripMentions bool              // remove mentions, text of text mentions is kept
+	DropEntities  []string          // drop entities by type, e.g. bold, url, hashtag
+	NoButtons     bool              // remove buttons of the message
+	Buttons       [][]button        // append rows of url buttons, which are only honored for bot accounts
+	Media         string            // local file which replaces media
+	Watermark     string            // local image which is drawn on photo
+}
+
+type button struct {
+	Text string
+	URL  string
+}
+
+// apply modifies text, entities and buttons of the message
+func (t *transform) apply(msg *tg.Message) error {
+	if t.Text != nil {
+		eb := entity.Builder{}
+		if err := html.HTML(strings.NewReader(*t.Text), &eb, html.Options{
+			UserResolver:          nil,
+			DisableTelegramEscape: false,
+		}); err != nil {
+			return errors.Wrap(err, "parse edited message")
+		}
+
+		msg.Message, msg.Entities = eb.Complete()
+	}
+
+	e := newTextEditor(msg.Message, msg.Entities)
+
+	// replace in a stable order
+	olds := make([]string, 0, len(t.Replace))
+	for old := range t.Replace {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		e.replaceAll(old, t.Replace[old])
+	}
+
+	if t.StripLinks {
+		e.strip(func(ent tg.MessageEntityClass) (remove, drop bool) {
+			switch ent.(type) {
+			case *tg.MessageEntityURL:
+				return true, false
+			case *tg.MessageEntityTextURL:
+				return false, true
+			}
+			return false, false
+		})
+	}
+	if t.StripMentions {
+		e.strip(func(ent tg.MessageEntityClass) (remove, drop bool) {
+			switch ent.(type) {
+			case *tg.MessageEntityMention:
+				return true, false
+			case *tg.MessageEntityMentionName, *tg.InputMessageEntityMentionName:
+				return false, true
+			}
+			return false, false
+		})
+	}
+	if len(t.DropEntities) > 0 {
+		types := make(map[string]struct{}, len(t.DropEntities))
+		for _, typ := range t.DropEntities {
+			types[strings.ToLower(typ)] = struct{}{}
+		}
+
+		e.strip(func(ent tg.MessageEntityClass) (remove, drop bool) {
+			_, ok := types[entityType(ent)]
+			return false, ok
+		})
+	}
+
+	msg.Message, msg.Entities = e.complete()
+
+	if t.NoButtons {
+		msg.ReplyMarkup = nil
+	}
+	if len(t.Buttons) > 0 {
+		markup, ok := msg.ReplyMarkup.(*tg.ReplyInlineMarkup)
+		if !ok {
+			markup = &tg.ReplyInlineMarkup{}
+		}
+
+		for _, row := range t.Buttons {
+			r := tg.KeyboardButtonRow{}
+			for _, b := range row {
+				r.Buttons = append(r.Buttons, &tg.KeyboardButtonURL{Text: b.Text, URL: b.URL})
+			}
+			markup.Rows = append(markup.Rows, r)
+		}
+
+		msg.ReplyMarkup = markup
+	}
+	msg.SetFlags()
+
+	return nil
+}
+
+// media returns the file which replaces media of the message, or nil if not replaced.
+// Watermarked photo is rendered lazily, see replacement.open.
+func (t *transform) media(ctx context.Context, pool dcpool.Pool, msg *tg.Message) (*replacement, error) {
+	if t.Media != "" {
+		stat, err := os.Stat(t.Media)
+		if err != nil {
+			return nil, errors.Wrap(err, "stat media")
+		}
+		if stat.IsDir() {
+			return nil, errors.Errorf("media %s is a directory", t.Media)
+		}
+		return &replacement{path: t.Media}, nil
+	}
+
+	if t.Watermark == "" {
+		return nil, nil
+	}
+	// only photos can be watermarked
+	if _, ok := msg.Media.(*tg.MessageMediaPhoto); !ok {
+		return nil, nil
+	}
+
+	f, err := os.Open(t.Watermark)
+	if err != nil {
+		return nil, errors.Wrap(err, "open watermark")
+	}
+	defer func() { _ = f.Close() }()
+
+	mark, err := watermark.Load(f)
+	if err != nil {
+		return nil, err
+	}
+
+	media, ok := tmedia.GetMedia(msg)
+	if !ok {
+		return nil, errors.Errorf("can't get photo of message %d", msg.ID)
+	}
+
+	return &replacement{name: "photo.jpg", render: func() ([]byte, error) {
+		photo := &bytes.Buffer{}
+		if _, err := downloader.NewDownloader().
+			WithPartSize(tdownloader.MaxPartSize).
+			Download(pool.Client(ctx, media.DC), media.InputFileLoc).
+			Stream(ctx, photo); err != nil {
+			return nil, errors.Wrap(err, "download photo")
+		}
+
+		out := &bytes.Buffer{}
+		if err := watermark.Encode(out, photo, mark); err != nil {
+			return nil, errors.Wrap(err, "watermark photo")
+		}
+		return out.Bytes(), nil
+	}}, nil
+}
+
+// replacement is a local file or rendered data which replaces media
+type replacement struct {
+	path   string
+	name   string
+	render func() ([]byte, error) // renders data, e.g. downloads and watermarks the photo
+}
+
+// open opens the replacement. Data is rendered only when it's actually sent, so dry run
+// and edits of mirrored copies don't download the original media.
+func (r *replacement) open(dryRun bool) (uploader.File, error) {
+	if r.path == "" {
+		if dryRun {
+			return &memFile{Reader: bytes.NewReader(nil), name: r.name}, nil
+		}
+
+		data, err := r.render()
+		if err != nil {
+			return nil, err
+		}
+		return &memFile{Reader: bytes.NewReader(data), name: r.name}, nil
+	}
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &localFile{File: f, size: stat.Size()}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (m *memFile) Name() string { return m.name }
+
+func (m *memFile) Size() int64 { return m.Reader.Size() }
+
+type localFile struct {
+	*os.File
+	size int64
+}
+
+func (l *localFile) Name() string { return filepath.Base(l.File.Name()) }
+
+func (l *localFile) Size() int64 { return l.size }
+
+// entityType returns short type name of entity, e.g. bold for messageEntityBold
+func entityType(ent tg.MessageEntityClass) string {
+	name := strings.TrimPrefix(ent.TypeName(), "inputMessageEntity")
+	name = strings.TrimPrefix(name, "messageEntity")
+	return strings.ToLower(name)
+}
+
+// textEditor edits text and keeps offsets of entities, which are in UTF-16 code units
+type textEditor struct {
+	text     []uint16
+	entities []tg.MessageEntityClass
+}
+
+func newTextEditor(text string, entities []tg.MessageEntityClass) *textEditor {
+	return &textEditor{
+		text:     utf16.Encode([]rune(text)),
+		entities: entities,
+	}
+}
+
+func (e *textEditor) complete() (string, []tg.MessageEntityClass) {
+	return string(utf16.Decode(e.text)), e.entities
+}
+
+// replaceRange replaces text in [start, end). Entities containing the range are resized,
+// entities after the range are moved, and entities partially overlapping the range are dropped.
+func (e *textEditor) replaceRange(start, end int, repl []uint16) {
+	delta := len(repl) - (end - start)
+
+	text := make([]uint16, 0, len(e.text)+delta)
+	text = append(text, e.text[:start]...)
+	text = append(text, repl...)
+	e.text = append(text, e.text[end:]...)
+
+	entities := make([]tg.MessageEntityClass, 0, len(e.entities))
+	for _, ent := range e.entities {
+		offset, length := ent.GetOffset(), ent.GetLength()
+
+		switch {
+		case offset+length <= start:
+		case offset >= end:
+			setEntityRange(ent, offset+delta, length)
+		case offset <= start && offset+length >= end:
+			if length += delta; length <= 0 {
+				continue
+			}
+			setEntityRange(ent, offset, length)
+		default:
+			continue
+		}
+
+		entities = append(entities, ent)
+	}
+	e.entities = entities
+}
+
+func (e *textEditor) replaceAll(old, repl string) {
+	if old == "" {
+		return
+	}
+
+	o, r := utf16.Encode([]rune(old)), utf16.Encode([]rune(repl))
+	for i := 0; i+len(o) <= len(e.text); {
+		if !slices.Equal(e.text[i:i+len(o)], o) {
+			i++
+			continue
+		}
+
+		e.replaceRange(i, i+len(o), r)
+		i += len(r)
+	}
+}
+
+// strip removes text of entities if remove is true, or only drops entities if drop is true
+func (e *textEditor) strip(f func(ent tg.MessageEntityClass) (remove, drop bool)) {
+	removed := make([]tg.MessageEntityClass, 0)
+	entities := make([]tg.MessageEntityClass, 0, len(e.entities))
+	for _, ent := range e.entities {
+		remove, drop := f(ent)
+		switch {
+		case remove:
+			removed = append(removed, ent)
+		case drop:
+			continue
+		}
+		entities = append(entities, ent)
+	}
+	e.entities = entities
+
+	// remove from the end, so that offsets of previous ones are not changed
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].GetOffset() > removed[j].GetOffset()
+	})
+	for _, ent := range removed {
+		start := ent.GetOffset()
+		if start >= len(e.text) { // out of text, there is nothing to remove
+			e.entities = slices.DeleteFunc(e.entities, func(x tg.MessageEntityClass) bool { return x == ent })
+			continue
+		}
+		e.replaceRange(start, min(start+ent.GetLength(), len(e.text)), nil)
+	}
+}
+
+// setEntityRange sets offset and length of the entity. All entity types have
+// the same fields, but there are no setters, so we set them by reflection.
+func setEntityRange(ent tg.MessageEntityClass, offset, length int) {
+	v := reflect.ValueOf(ent).Elem()
+	v.FieldByName("Offset").SetInt(int64(offset))
+	v.FieldByName("Length").SetInt(int64(length))
+}
@@ -0,0 +1,337 @@
+package forward
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func u16(s string) []uint16 { return utf16.Encode([]rune(s)) }
+
+func TestTextEditorReplaceRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		start, end int
+		repl       string
+		entities   []tg.MessageEntityClass
+		text       string
+		want       []tg.MessageEntityClass
+	}{
+		{
+			name: "entity before is kept", input: "hello world", start: 6, end: 11, repl: "tdl",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 5}},
+			text:     "hello tdl",
+			want:     []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 5}},
+		},
+		{
+			name: "entity after is moved", input: "hello world", start: 0, end: 5, repl: "hi",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityItalic{Offset: 6, Length: 5}},
+			text:     "hi world",
+			want:     []tg.MessageEntityClass{&tg.MessageEntityItalic{Offset: 3, Length: 5}},
+		},
+		{
+			name: "containing entity is resized", input: "hello world", start: 6, end: 11, repl: "gopher",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 11}},
+			text:     "hello gopher",
+			want:     []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 12}},
+		},
+		{
+			name: "exactly replaced entity is resized", input: "hello world", start: 6, end: 11, repl: "tdl",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityCode{Offset: 6, Length: 5}},
+			text:     "hello tdl",
+			want:     []tg.MessageEntityClass{&tg.MessageEntityCode{Offset: 6, Length: 3}},
+		},
+		{
+			name: "removed entity is dropped", input: "hello world", start: 6, end: 11, repl: "",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityCode{Offset: 6, Length: 5}},
+			text:     "hello ",
+			want:     []tg.MessageEntityClass{},
+		},
+		{
+			name: "partial overlap at start is dropped", input: "hello world", start: 3, end: 8, repl: "",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 5}},
+			text:     "helrld",
+			want:     []tg.MessageEntityClass{},
+		},
+		{
+			name: "partial overlap at end is dropped", input: "hello world", start: 3, end: 8, repl: "",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 6, Length: 5}},
+			text:     "helrld",
+			want:     []tg.MessageEntityClass{},
+		},
+		{
+			name: "nested entities", input: "hello world again", start: 6, end: 11, repl: "tdl",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 17},
+				&tg.MessageEntityItalic{Offset: 6, Length: 11},
+				&tg.MessageEntityCode{Offset: 12, Length: 5},
+			},
+			text: "hello tdl again",
+			want: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 15},
+				&tg.MessageEntityItalic{Offset: 6, Length: 9},
+				&tg.MessageEntityCode{Offset: 10, Length: 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTextEditor(tt.input, tt.entities)
+			e.replaceRange(tt.start, tt.end, u16(tt.repl))
+
+			text, entities := e.complete()
+			assert.Equal(t, tt.text, text)
+			assert.Equal(t, tt.want, entities)
+		})
+	}
+}
+
+func TestTextEditorReplaceAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		entities  []tg.MessageEntityClass
+		old, repl string
+		want      string
+		wantEnts  []tg.MessageEntityClass
+	}{
+		{name: "empty old", text: "abc", old: "", repl: "x", want: "abc"},
+		{name: "not found", text: "abc", old: "d", repl: "x", want: "abc"},
+		{name: "all occurrences", text: "a-a-a", old: "a", repl: "bb", want: "bb-bb-bb"},
+		{name: "replacement contains old", text: "aa", old: "a", repl: "aa", want: "aaaa"},
+		{
+			// 👍 is a surrogate pair, which takes two UTF-16 code units
+			name: "surrogate pairs before entity", text: "👍👍 @partner",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityMention{Offset: 5, Length: 8}},
+			old:      "👍", repl: "+",
+			want:     "++ @partner",
+			wantEnts: []tg.MessageEntityClass{&tg.MessageEntityMention{Offset: 3, Length: 8}},
+		},
+		{
+			name: "surrogate pairs in replacement", text: "hi @partner!",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 12},
+				&tg.MessageEntityMention{Offset: 3, Length: 8},
+			},
+			old: "@partner", repl: "😀 @mine",
+			want: "hi 😀 @mine!",
+			wantEnts: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 12},
+				&tg.MessageEntityMention{Offset: 3, Length: 8},
+			},
+		},
+		{
+			name: "partial overlap with entity", text: "foo bar",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 3}},
+			old:      "o b", repl: "",
+			want:     "foar",
+			wantEnts: []tg.MessageEntityClass{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTextEditor(tt.text, tt.entities)
+			e.replaceAll(tt.old, tt.repl)
+
+			text, entities := e.complete()
+			assert.Equal(t, tt.want, text)
+			if tt.wantEnts == nil {
+				assert.Empty(t, entities)
+				return
+			}
+			assert.Equal(t, tt.wantEnts, entities)
+		})
+	}
+}
+
+func TestTextEditorStrip(t *testing.T) {
+	e := newTextEditor("ab cd ef", []tg.MessageEntityClass{
+		&tg.MessageEntityBold{Offset: 0, Length: 2},
+		&tg.MessageEntityItalic{Offset: 3, Length: 2},
+		&tg.MessageEntityCode{Offset: 6, Length: 2},
+		&tg.MessageEntityURL{Offset: 20, Length: 2}, // out of text
+	})
+
+	e.strip(func(ent tg.MessageEntityClass) (remove, drop bool) {
+		switch ent.(type) {
+		case *tg.MessageEntityBold, *tg.MessageEntityCode, *tg.MessageEntityURL:
+			return true, false
+		case *tg.MessageEntityItalic:
+			return false, true
+		}
+		return false, false
+	})
+
+	text, entities := e.complete()
+	assert.Equal(t, " cd ", text)
+	assert.Empty(t, entities)
+}
+
+func TestSetEntityRange(t *testing.T) {
+	entities := []tg.MessageEntityClass{
+		&tg.MessageEntityBold{},
+		&tg.MessageEntityTextURL{URL: "https://t.me"},
+		&tg.MessageEntityMentionName{UserID: 1},
+		&tg.InputMessageEntityMentionName{UserID: &tg.InputUserSelf{}},
+		&tg.MessageEntityCustomEmoji{DocumentID: 2},
+		&tg.MessageEntityPre{Language: "go"},
+	}
+
+	for _, ent := range entities {
+		t.Run(entityType(ent), func(t *testing.T) {
+			setEntityRange(ent, 3, 7)
+			assert.Equal(t, 3, ent.GetOffset())
+			assert.Equal(t, 7, ent.GetLength())
+		})
+	}
+}
+
+func TestEntityType(t *testing.T) {
+	assert.Equal(t, "bold", entityType(&tg.MessageEntityBold{}))
+	assert.Equal(t, "texturl", entityType(&tg.MessageEntityTextURL{}))
+	assert.Equal(t, "mentionname", entityType(&tg.InputMessageEntityMentionName{}))
+}
+
+func TestTransformApply(t *testing.T) {
+	text := func(s string) *string { return &s }
+	markup := func() tg.ReplyMarkupClass {
+		return &tg.ReplyInlineMarkup{Rows: []tg.KeyboardButtonRow{{
+			Buttons: []tg.KeyboardButtonClass{&tg.KeyboardButtonURL{Text: "old", URL: "https://a.com"}},
+		}}}
+	}
+
+	tests := []struct {
+		name      string
+		transform transform
+		msg       *tg.Message
+		want      string
+		wantEnts  []tg.MessageEntityClass
+		wantRows  int // rows of inline buttons, -1 means no markup
+	}{
+		{
+			name:      "html text",
+			transform: transform{Text: text("<b>hi</b> 👋 <i>there</i>")},
+			msg:       &tg.Message{Message: "old", Entities: []tg.MessageEntityClass{&tg.MessageEntityCode{Offset: 0, Length: 3}}},
+			want:      "hi 👋 there",
+			wantEnts: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 2},
+				&tg.MessageEntityItalic{Offset: 6, Length: 5},
+			},
+			wantRows: -1,
+		},
+		{
+			name:      "strip links",
+			transform: transform{StripLinks: true},
+			msg: &tg.Message{Message: "🔗 https://a.com and docs", Entities: []tg.MessageEntityClass{
+				&tg.MessageEntityURL{Offset: 3, Length: 13},
+				&tg.MessageEntityTextURL{Offset: 21, Length: 4, URL: "https://b.com"},
+				&tg.MessageEntityBold{Offset: 17, Length: 3},
+			}},
+			want:     "🔗  and docs",
+			wantEnts: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 4, Length: 3}},
+			wantRows: -1,
+		},
+		{
+			name:      "strip mentions",
+			transform: transform{StripMentions: true},
+			msg: &tg.Message{Message: "by @alice and Bob", Entities: []tg.MessageEntityClass{
+				&tg.MessageEntityMention{Offset: 3, Length: 6},
+				&tg.MessageEntityMentionName{Offset: 14, Length: 3, UserID: 1},
+				&tg.MessageEntityItalic{Offset: 0, Length: 17},
+			}},
+			want:     "by  and Bob",
+			wantEnts: []tg.MessageEntityClass{&tg.MessageEntityItalic{Offset: 0, Length: 11}},
+			wantRows: -1,
+		},
+		{
+			name:      "drop entities",
+			transform: transform{DropEntities: []string{"Bold", "textUrl"}},
+			msg: &tg.Message{Message: "a b c", Entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 1},
+				&tg.MessageEntityTextURL{Offset: 2, Length: 1, URL: "https://t.me"},
+				&tg.MessageEntityHashtag{Offset: 4, Length: 1},
+			}},
+			want:     "a b c",
+			wantEnts: []tg.MessageEntityClass{&tg.MessageEntityHashtag{Offset: 4, Length: 1}},
+			wantRows: -1,
+		},
+		{
+			name:      "replace in order",
+			transform: transform{Replace: map[string]string{"b": "c", "a": "b"}},
+			msg:       &tg.Message{Message: "ab"},
+			want:      "cc", // a -> b first, then b -> c
+			wantEnts:  []tg.MessageEntityClass{},
+			wantRows:  -1,
+		},
+		{
+			name:      "no buttons",
+			transform: transform{NoButtons: true},
+			msg:       &tg.Message{Message: "x", ReplyMarkup: markup()},
+			want:      "x",
+			wantEnts:  []tg.MessageEntityClass{},
+			wantRows:  -1,
+		},
+		{
+			name:      "append buttons",
+			transform: transform{Buttons: [][]button{{{Text: "Go", URL: "https://t.me"}}}},
+			msg:       &tg.Message{Message: "x", ReplyMarkup: markup()},
+			want:      "x",
+			wantEnts:  []tg.MessageEntityClass{},
+			wantRows:  2,
+		},
+		{
+			name:      "replace buttons",
+			transform: transform{NoButtons: true, Buttons: [][]button{{{Text: "Go", URL: "https://t.me"}}}},
+			msg:       &tg.Message{Message: "x", ReplyMarkup: markup()},
+			want:      "x",
+			wantEnts:  []tg.MessageEntityClass{},
+			wantRows:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.transform.apply(tt.msg))
+
+			assert.Equal(t, tt.want, tt.msg.Message)
+			if tt.wantEnts == nil {
+				tt.wantEnts = []tg.MessageEntityClass{}
+			}
+			assert.Equal(t, tt.wantEnts, append([]tg.MessageEntityClass{}, tt.msg.Entities...))
+
+			if tt.wantRows < 0 {
+				assert.Nil(t, tt.msg.ReplyMarkup)
+				return
+			}
+			m, ok := tt.msg.ReplyMarkup.(*tg.ReplyInlineMarkup)
+			require.True(t, ok)
+			assert.Len(t, m.Rows, tt.wantRows)
+		})
+	}
+}
+
+func TestReplacementOpen(t *testing.T) {
+	rendered := 0
+	r := &replacement{name: "photo.jpg", render: func() ([]byte, error) {
+		rendered++
+		return []byte("watermarked"), nil
+	}}
+
+	// dry run doesn't download and render the photo
+	f, err := r.open(true)
+	require.NoError(t, err)
+	assert.Equal(t, "photo.jpg", f.Name())
+	assert.Equal(t, int64(0), f.Size())
+	assert.Equal(t, 0, rendered)
+
+	f, err = r.open(false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("watermarked")), f.Size())
+	assert.Equal(t, 1, rendered)
+}
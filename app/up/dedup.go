@@ -0,0 +1,142 @@
+package up
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/tmedia"
+	"github.com/iyear/tdl/pkg/key"
+)
+
+type docKey struct {
+	name string
+	size int64
+}
+
+// dedup finds files which already exist in the destination chat
+type dedup struct {
+	client  *tg.Client
+	kvd     storage.Storage
+	hash    bool                          // also match by SHA-256 recorded in kv storage
+	depth   int                           // number of latest messages to index, zero means the whole history
+	indexes map[int64]map[docKey]struct{} // peer id -> documents in chat
+}
+
+func newDedup(client *tg.Client, kvd storage.Storage, hash bool, depth int) *dedup {
+	return &dedup{
+		client:  client,
+		kvd:     kvd,
+		hash:    hash,
+		depth:   depth,
+		indexes: make(map[int64]map[docKey]struct{}),
+	}
+}
+
+// exists reports whether a document matching any of keys exists in the peer, and returns SHA-256 of
+// the local file if hash matching is enabled, which should be recorded after uploading.
+func (d *dedup) exists(ctx context.Context, peer peers.Peer, cur *File, keys ...docKey) (bool, string, error) {
+	index, err := d.index(ctx, peer)
+	if err != nil {
+		return false, "", errors.Wrap(err, "index chat")
+	}
+
+	for _, k := range keys {
+		// stream with unknown size can't be matched
+		if k.size < 0 {
+			continue
+		}
+		if _, ok := index[k]; ok {
+			return true, "", nil
+		}
+	}
+
+	if !d.hash || !isLocal(cur.File) {
+		return false, "", nil
+	}
+
+	sum, err := hashFile(cur)
+	if err != nil {
+		return false, "", errors.Wrap(err, "hash file")
+	}
+
+	_, err = d.kvd.Get(ctx, key.Uploaded(peer.ID(), sum))
+	switch {
+	case err == nil:
+		return true, sum, nil
+	case errors.Is(err, storage.ErrNotFound):
+		return false, sum, nil
+	default:
+		return false, "", errors.Wrap(err, "get uploaded hash")
+	}
+}
+
+// record marks the file hash as uploaded to the peer
+func (d *dedup) record(ctx context.Context, peer int64, hash string) error {
+	return d.kvd.Set(ctx, key.Uploaded(peer, hash), []byte{1})
+}
+
+func (d *dedup) index(ctx context.Context, peer peers.Peer) (map[docKey]struct{}, error) {
+	if index, ok := d.indexes[peer.ID()]; ok {
+		return index, nil
+	}
+
+	index := make(map[docKey]struct{})
+
+	iter := messages.NewIterator(query.NewQuery(d.client).Messages().GetHistory(peer.InputPeer()), 100)
+	for scanned := 0; (d.depth <= 0 || scanned < d.depth) && iter.Next(ctx); scanned++ {
+		msg, ok := iter.Value().Msg.(*tg.Message)
+		if !ok {
+			continue
+		}
+
+		media, ok := tmedia.GetMedia(msg)
+		if !ok {
+			continue
+		}
+
+		index[docKey{name: media.Name, size: media.Size}] = struct{}{}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	logctx.From(ctx).Info("Index destination chat",
+		zap.Int64("peer", peer.ID()),
+		zap.Int("documents", len(index)))
+
+	d.indexes[peer.ID()] = index
+	return index, nil
+}
+
+// hashFile returns SHA-256 of the local file or part
+func hashFile(cur *File) (string, error) {
+	f, err := os.Open(cur.File)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if cur.Part != nil {
+		r = io.NewSectionReader(f, cur.Part.Offset, cur.Part.Length)
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,50 @@
+package up
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/pkg/crypt"
+)
+
+func TestDedupExists(t *testing.T) {
+	manager := peers.Options{}.Build(tg.NewClient(nil))
+	peer := manager.Channel(&tg.Channel{ID: 100})
+
+	d := newDedup(nil, nil, false, 0)
+	// indexed chat is not fetched again
+	d.indexes[peer.ID()] = map[docKey]struct{}{
+		{name: "a.jpg", size: 10}:                                  {},
+		{name: "b.jpg" + crypt.Ext, size: crypt.Size(20, "b.jpg")}: {},
+		{name: "c.jpg", size: -1}:                                  {},
+	}
+
+	tests := []struct {
+		name string
+		keys []docKey
+		want bool
+	}{
+		{name: "plain", keys: []docKey{{name: "a.jpg", size: 10}}, want: true},
+		{name: "size mismatch", keys: []docKey{{name: "a.jpg", size: 11}}, want: false},
+		{name: "encrypted name", keys: []docKey{
+			{name: "b.jpg", size: 20},
+			{name: "b.jpg" + crypt.Ext, size: crypt.Size(20, "b.jpg")},
+		}, want: true},
+		{name: "unknown size", keys: []docKey{{name: "c.jpg", size: -1}}, want: false},
+		{name: "no keys", keys: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, hash, err := d.exists(context.Background(), peer, &File{File: "-"}, tt.keys...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, exists)
+			assert.Empty(t, hash)
+		})
+	}
+}
@@ -1,37 +1,52 @@
 package up
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram/message/entity"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
 
 	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/pkg/crypt"
+	"github.com/iyear/tdl/pkg/split"
 )
 
 type iterElem struct {
+	index   int // index of the file in iterator, used by resume
+	src     *File
 	file    *uploaderFile
 	thumb   *uploaderFile
 	to      peers.Peer
 	caption *entity.Builder
 	thread  int
-
-	asPhoto bool
-	gdrive  bool
-	remove  bool
+	env     Env         // env of expressions, used by post actions
+	chain   *replyChain // nil means no reply chain
+
+	schedule  time.Time // zero means posting immediately
+	mediaType uploader.MediaType
+	spoiler   bool
+	asPhoto   bool
+	gdrive    bool
+	remove    bool
+	hash      string // SHA-256 recorded after uploading, empty means no record
 }
 
 func (e *iterElem) File() uploader.File {
-	return e.file
+	return e.file.asFile()
 }
 
 func (e *iterElem) Thumb() (uploader.File, bool) {
 	if e.thumb == nil {
 		return nil, false
 	}
-	return e.thumb, true
+	return e.thumb.asFile(), true
 }
 
 func (e *iterElem) Caption() (string, []tg.MessageEntityClass) {
@@ -43,9 +58,27 @@ func (e *iterElem) To() tg.InputPeerClass {
 }
 
 func (e *iterElem) Thread() int {
+	// reply to the previous message if reply chain is enabled
+	if e.chain != nil {
+		if id, ok := e.chain.last(e.to.ID()); ok {
+			return id
+		}
+	}
 	return e.thread
 }
 
+func (e *iterElem) Schedule() time.Time {
+	return e.schedule
+}
+
+func (e *iterElem) MediaType() uploader.MediaType {
+	return e.mediaType
+}
+
+func (e *iterElem) Spoiler() bool {
+	return e.spoiler
+}
+
 func (e *iterElem) AsPhoto() bool {
 	return e.asPhoto
 }
@@ -59,19 +92,110 @@ func (e *iterElem) Remove() bool {
 }
 
 func (e *iterElem) FilePath() string {
-	if e.file != nil {
-		return e.file.File.Name()
+	if e.file != nil && e.file.local {
+		return e.file.path
 	}
 	return ""
 }
 
 type uploaderFile struct {
-	*os.File
-	size int64
+	io.Closer
+	rs    io.Reader // reads the uploaded content
+	path  string    // source of the file, e.g. local path, URL or archive entry
+	name  string
+	size  int64
+	local bool
+}
+
+func newUploaderFile(f *os.File, size int64) *uploaderFile {
+	return &uploaderFile{
+		Closer: f,
+		rs:     f,
+		path:   f.Name(),
+		name:   filepath.Base(f.Name()),
+		size:   size,
+		local:  true,
+	}
+}
+
+func newPartFile(f *os.File, part *split.Manifest) *uploaderFile {
+	return &uploaderFile{
+		Closer: f,
+		rs:     io.NewSectionReader(f, part.Offset, part.Length),
+		path:   f.Name(),
+		name:   part.PartName(),
+		size:   part.Length,
+		local:  true,
+	}
+}
+
+// newStreamFile wraps non-seekable source, size is -1 if unknown
+func newStreamFile(rc io.ReadCloser, path, name string, size int64) *uploaderFile {
+	return &uploaderFile{
+		Closer: rc,
+		rs:     rc,
+		path:   path,
+		name:   name,
+		size:   size,
+		local:  false,
+	}
+}
+
+func (u *uploaderFile) Read(p []byte) (int, error) {
+	return u.rs.Read(p)
+}
+
+// asFile returns the file with io.Seeker only if the source is seekable
+func (u *uploaderFile) asFile() uploader.File {
+	if rs, ok := u.rs.(io.ReadSeeker); ok {
+		return &seekableFile{uploaderFile: u, rs: rs}
+	}
+	return u
+}
+
+type seekableFile struct {
+	*uploaderFile
+	rs io.ReadSeeker
+}
+
+func (s *seekableFile) Seek(offset int64, whence int) (int64, error) {
+	return s.rs.Seek(offset, whence)
 }
 
 func (u *uploaderFile) Name() string {
-	return filepath.Base(u.File.Name())
+	return u.name
+}
+
+// encrypt replaces the uploaded content with its encrypted stream
+func (u *uploaderFile) encrypt(secret []byte, hideName bool) error {
+	src, ok := u.rs.(io.ReaderAt)
+	if !ok || u.size < 0 {
+		return errors.Errorf("encryption requires a local file: %s", u.path)
+	}
+
+	e, err := crypt.NewEncrypter(src, u.size, u.name, secret)
+	if err != nil {
+		return errors.Wrap(err, "new encrypter")
+	}
+
+	name := u.name
+	if hideName {
+		b := make([]byte, 16)
+		if _, err = rand.Read(b); err != nil {
+			return errors.Wrap(err, "random name")
+		}
+		name = hex.EncodeToString(b)
+	}
+
+	u.rs = e
+	u.name = name + crypt.Ext
+	u.size = e.Size()
+	return nil
+}
+
+// Path is the unique local path of the uploaded file or part
+func (u *uploaderFile) Path() string {
+	return filepath.Join(filepath.Dir(u.path), u.name)
 }
 
 func (u *uploaderFile) Size() int64 {
@@ -0,0 +1,117 @@
+package up
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/util/mediautil"
+	"github.com/iyear/tdl/pkg/exif"
+)
+
+// relDirs returns the parent directory of the file relative to its walk root
+func relDirs(file *File) (string, []string) {
+	var rel string
+
+	switch {
+	case file.Root == "":
+		return ".", []string{}
+	case strings.HasPrefix(file.File, file.Root) && !isLocal(file.File): // archive entry
+		rel = path.Dir(strings.TrimPrefix(file.File, file.Root))
+	default:
+		r, err := filepath.Rel(file.Root, filepath.Dir(file.File))
+		if err != nil {
+			return ".", []string{}
+		}
+		rel = filepath.ToSlash(r)
+	}
+
+	if rel == "." {
+		return rel, []string{}
+	}
+	return rel, strings.Split(rel, "/")
+}
+
+// mediaVisitor finds references of EXIF and Video, which are filled by probing files
+type mediaVisitor struct {
+	found bool
+}
+
+func (v *mediaVisitor) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.IdentifierNode); ok && (n.Value == "EXIF" || n.Value == "Video") {
+		v.found = true
+	}
+}
+
+// usesMedia reports whether any of programs references EXIF or Video,
+// so that files are only probed when needed. Nil programs are skipped.
+func usesMedia(programs ...*vm.Program) bool {
+	v := &mediaVisitor{}
+	for _, p := range programs {
+		if p == nil {
+			continue
+		}
+
+		node := p.Node()
+		ast.Walk(&node, v)
+		if v.found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// probeMedia reads EXIF of images and info of videos, errors are only logged
+// as media info is optional for expressions.
+func probeMedia(ctx context.Context, p, mime string) (EnvEXIF, EnvVideo) {
+	var (
+		e EnvEXIF
+		v EnvVideo
+	)
+
+	if !mediautil.IsImage(mime) && !mediautil.IsVideo(mime) {
+		return e, v
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		logctx.From(ctx).Error("open file", zap.String("file", p), zap.Error(err))
+		return e, v
+	}
+	defer func() { _ = f.Close() }()
+
+	switch {
+	case mime == "image/jpeg":
+		x, err := exif.Read(f)
+		if err != nil {
+			logctx.From(ctx).Debug("read exif", zap.String("file", p), zap.Error(err))
+			return e, v
+		}
+
+		e = EnvEXIF{
+			Make:      x.Make,
+			Model:     x.Model,
+			HasGPS:    x.HasGPS,
+			Latitude:  x.Latitude,
+			Longitude: x.Longitude,
+		}
+		if !x.DateTaken.IsZero() {
+			e.DateTaken = x.DateTaken.Format(time.DateTime)
+		}
+	case mediautil.IsVideo(mime):
+		if dur, w, h, err := mediautil.GetMP4Info(f); err == nil {
+			v = EnvVideo{Duration: dur, Width: w, Height: h}
+		}
+	}
+
+	return e, v
+}
@@ -0,0 +1,41 @@
+package up
+
+import (
+	"context"
+	"testing"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsesMedia(t *testing.T) {
+	tests := []struct {
+		name  string
+		exprs []string
+		want  bool
+	}{
+		{name: "none", exprs: nil, want: false},
+		{name: "file fields", exprs: []string{`FileName + FileExt`, `FileSize > 1024`}, want: false},
+		{name: "exif", exprs: []string{`FileName`, `EXIF.Model`}, want: true},
+		{name: "video", exprs: []string{`Video.Duration > 60 ? "long" : "short"`}, want: true},
+		{name: "nested", exprs: []string{`len(filter(Dirs, # == EXIF.Model)) > 0`}, want: true},
+		{name: "field name", exprs: []string{`{"EXIF": FileName}.EXIF`}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := exprEnv(context.Background(), nil, false)
+
+			var ps []*vm.Program
+			for _, e := range tt.exprs {
+				p, err := expr.Compile(e, expr.Env(env))
+				require.NoError(t, err)
+				ps = append(ps, p)
+			}
+
+			assert.Equal(t, tt.want, usesMedia(ps...))
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/expr-lang/expr/vm"
@@ -13,16 +14,35 @@ import (
 	"github.com/gotd/td/telegram/message/entity"
 	"github.com/gotd/td/telegram/message/html"
 	"github.com/gotd/td/telegram/peers"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
 
+	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/uploader"
 	"github.com/iyear/tdl/core/util/mediautil"
 	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/crypt"
+	"github.com/iyear/tdl/pkg/split"
 	"github.com/iyear/tdl/pkg/texpr"
 )
 
 type File struct {
-	File  string
+	File  string // local path, '-' for stdin, URL or 'archive.zip!/inner/path'
+	Name  string // file name of the source which has no name, e.g. stdin
+	Root  string // walk root of the file, used to resolve relative directories
 	Thumb string
+	Part  *split.Manifest // set if File is split into parts
+
+	Thread int    // overrides the thread of destination if not zero
+	Prefix string // plain text prepended to the caption
+
+	// per-file overrides, e.g. jobs of manifest
+	To       string    // overrides the destination peer if not empty
+	Caption  *string   // HTML caption, overrides the caption expression if not nil
+	Photo    *bool     // overrides --photo flag if not nil
+	Media    string    // overrides the media type if not empty
+	Spoiler  bool      // hide the photo or video under a spoiler
+	Schedule time.Time // overrides the schedule if not zero
 }
 
 type dest struct {
@@ -30,39 +50,56 @@ type dest struct {
 	Thread int
 }
 
+type media struct {
+	Type    string
+	Spoiler bool
+}
+
 type iter struct {
 	files   []*File
 	to      *vm.Program
 	caption *vm.Program
-	chat    string
-	topic   int
-	photo   bool
-	gdrive  bool
-	remove  bool
+	sched   scheduler   // nil means posting immediately
+	media   *vm.Program // nil means detecting media type by MIME
+	opts    Options
+	secret  []byte // encryption secret, nil means no encryption
+	dedup   *dedup // nil means no deduplication
 	delay   time.Duration
 	manager *peers.Manager
-
-	cur  int
-	err  error
-	file uploader.Elem
+	chain   *replyChain  // nil means no reply chain
+	parts   *partRemover // nil means original files of parts are not removed
+	probe   bool         // whether expressions use EXIF or Video, which need probing files
+
+	cur     int
+	skipped int
+	posted  int       // count of elements to be posted, used by schedule spacing
+	last    time.Time // schedule time of last element
+	err     error
+	file    uploader.Elem
+
+	mu       *sync.Mutex
+	finished map[int]struct{} // indexes of files which are uploaded or skipped
 }
 
-func newIter(files []*File, to, caption *vm.Program, chat string, topic int, photo, gdrive, remove bool, delay time.Duration, manager *peers.Manager) *iter {
+func newIter(files []*File, to, caption *vm.Program, sched scheduler, media *vm.Program, opts Options, secret []byte, dedup *dedup, delay time.Duration, manager *peers.Manager) *iter {
 	return &iter{
 		files:   files,
 		to:      to,
 		caption: caption,
-		chat:    chat,
-		topic:   topic,
-		photo:   photo,
-		gdrive:  gdrive,
-		remove:  remove,
+		sched:   sched,
+		media:   media,
+		opts:    opts,
+		secret:  secret,
+		dedup:   dedup,
 		delay:   delay,
 		manager: manager,
 
 		cur:  0,
 		err:  nil,
 		file: nil,
+
+		mu:       &sync.Mutex{},
+		finished: make(map[int]struct{}),
 	}
 }
 
@@ -83,80 +120,208 @@ func (i *iter) Next(ctx context.Context) bool {
 		time.Sleep(i.delay)
 	}
 
-	cur := i.files[i.cur]
-	i.cur++
+	for i.cur < len(i.files) {
+		index, cur := i.cur, i.files[i.cur]
+		i.cur++
 
-	file, err := i.next(ctx, cur)
-	if err != nil {
-		i.err = err
-		return false
+		if i.isFinished(index) {
+			if err := i.parts.finish(cur); err != nil {
+				i.err = errors.Wrap(err, "remove split file")
+				return false
+			}
+			continue
+		}
+
+		file, err := i.next(ctx, cur)
+		if err != nil {
+			i.err = err
+			return false
+		}
+		if file == nil { // already exists in destination
+			i.Finish(index)
+			if err = i.parts.finish(cur); err != nil {
+				i.err = errors.Wrap(err, "remove split file")
+				return false
+			}
+			continue
+		}
+
+		file.index = index
+		i.file = file
+		return true
 	}
 
-	i.file = file
-	return true
+	return false
 }
 
-func (i *iter) next(ctx context.Context, cur *File) (*iterElem, error) {
-	file, err := i.resolveFile(cur.File)
+func (i *iter) next(ctx context.Context, cur *File) (_ *iterElem, rerr error) {
+	file, err := i.resolveFile(ctx, cur)
 	if err != nil {
 		return nil, errors.Wrap(err, "resolve file")
 	}
 
-	env := exprEnv(ctx, cur)
+	// file and thumbnail are closed by uploader if the element is returned
+	var thumb *uploaderFile
+	defer func() {
+		if rerr != nil {
+			_ = closeFiles(file, thumb)
+		}
+	}()
+
+	env := exprEnv(ctx, cur, i.probe)
 
-	to, thread, err := i.resolveDest(ctx, env)
+	to, thread, err := i.resolveDest(ctx, env, cur.To)
 	if err != nil {
 		return nil, errors.Wrap(err, "resolve destination")
 	}
 
-	caption, err := i.resolveCaption(env)
+	if cur.Thread != 0 {
+		thread = cur.Thread
+	}
+
+	caption, err := i.resolveCaption(env, cur.Prefix, cur.Caption)
 	if err != nil {
 		return nil, errors.Wrap(err, "resolve caption")
 	}
 
-	thumb, err := i.resolveThumb(cur.Thumb)
+	thumb, err = i.resolveThumb(cur.Thumb)
 	if err != nil {
 		return nil, errors.Wrap(err, "resolve thumbnail")
 	}
 
-	return &iterElem{
+	// check before encrypting, which derives the key and hides the name
+	hash := ""
+	if i.dedup != nil {
+		keys := []docKey{{name: file.name, size: file.size}}
+		if i.secret != nil && !i.opts.EncryptName {
+			keys = append(keys, docKey{name: file.name + crypt.Ext, size: crypt.Size(file.size, file.name)})
+		}
+
+		var exists bool
+		if exists, hash, err = i.dedup.exists(ctx, to, cur, keys...); err != nil {
+			return nil, errors.Wrap(err, "check existing")
+		}
+
+		if exists {
+			logctx.From(ctx).Info("Skip existing file",
+				zap.String("file", file.Path()),
+				zap.Int64("to", to.ID()))
+
+			i.skipped++
+			err = closeFiles(file, thumb)
+			file, thumb = nil, nil // don't close them again
+			return nil, err
+		}
+	}
+
+	if i.secret != nil {
+		if err = file.encrypt(i.secret, i.opts.EncryptName); err != nil {
+			return nil, errors.Wrap(err, "encrypt file")
+		}
+	}
+
+	schedule, err := i.resolveSchedule(env, cur)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve schedule")
+	}
+
+	mediaType, spoiler, err := i.resolveMedia(env, cur)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve media type")
+	}
+
+	elem := &iterElem{
+		src:     cur,
 		file:    file,
 		thumb:   thumb,
 		to:      to,
 		caption: caption,
 		thread:  thread,
+		env:     env,
+
+		chain:     i.chain,
+		schedule:  schedule,
+		mediaType: mediaType,
+		spoiler:   spoiler,
+		asPhoto:   i.opts.Photo,
+		gdrive:    i.opts.Gdrive,
+		remove:    i.opts.Remove,
+		hash:      hash,
+	}
+
+	if cur.Photo != nil {
+		elem.asPhoto = *cur.Photo
+	}
+
+	if cur.Part != nil {
+		// parts are always uploaded as documents, and the original file
+		// is removed by partRemover after all parts are uploaded
+		part := cur.Part
+		if i.secret != nil && i.opts.EncryptName {
+			// original name and hash are only kept in the encrypted part
+			part = part.Redact(i.secret)
+		}
+		elem.caption.Plain("\n" + part.String())
+		elem.asPhoto = false
+		elem.mediaType = uploader.MediaTypeAuto
+		elem.remove = false
+	}
+
+	if i.secret != nil {
+		// thumbnail is a plaintext preview of the file
+		if thumb != nil {
+			err, thumb = thumb.Close(), nil
+			if err != nil {
+				return nil, errors.Wrap(err, "close thumbnail")
+			}
+			elem.thumb = nil
+		}
+		elem.asPhoto = false
+		elem.mediaType = uploader.MediaTypeAuto
+	}
 
-		asPhoto: i.photo,
-		gdrive:  i.gdrive,
-		remove:  i.remove,
-	}, nil
+	return elem, nil
 }
 
-func (i *iter) resolveFile(path string) (*uploaderFile, error) {
-	f, err := os.Open(path)
+func (i *iter) resolveFile(ctx context.Context, cur *File) (*uploaderFile, error) {
+	if !isLocal(cur.File) {
+		return openStream(ctx, cur)
+	}
+
+	f, err := os.Open(cur.File)
 	if err != nil {
 		return nil, errors.Wrap(err, "open file")
 	}
 
+	if cur.Part != nil {
+		return newPartFile(f, cur.Part), nil
+	}
+
 	stat, err := f.Stat()
 	if err != nil {
 		return nil, errors.Wrap(err, "stat file")
 	}
 
-	return &uploaderFile{
-		File: f,
-		size: stat.Size(),
-	}, nil
+	return newUploaderFile(f, stat.Size()), nil
 }
 
-func (i *iter) resolveDest(ctx context.Context, env Env) (peers.Peer, int, error) {
-	if i.chat != "" { // compatible with old version
-		to, err := i.resolvePeer(ctx, i.chat)
+func (i *iter) resolveDest(ctx context.Context, env Env, override string) (peers.Peer, int, error) {
+	if override != "" {
+		to, err := i.resolvePeer(ctx, override)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "resolve peer")
+		}
+
+		return to, 0, nil
+	}
+
+	if i.opts.Chat != "" { // compatible with old version
+		to, err := i.resolvePeer(ctx, i.opts.Chat)
 		if err != nil {
 			return nil, 0, errors.Wrap(err, "resolve chat")
 		}
 
-		return to, i.topic, nil
+		return to, i.opts.Thread, nil
 	}
 
 	// message routing
@@ -204,21 +369,32 @@ func (i *iter) resolvePeer(ctx context.Context, peer string) (peers.Peer, error)
 	return tutil.GetInputPeer(ctx, i.manager, peer)
 }
 
-func (i *iter) resolveCaption(env Env) (*entity.Builder, error) {
-	// parse caption
-	captionStr, err := texpr.Run(i.caption, env)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse caption")
-	}
+func (i *iter) resolveCaption(env Env, prefix string, override *string) (*entity.Builder, error) {
+	var r string
+	if override != nil {
+		r = *override
+	} else {
+		// parse caption
+		captionStr, err := texpr.Run(i.caption, env)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse caption")
+		}
 
-	r, ok := captionStr.(string)
-	if !ok {
-		return nil, errors.Errorf("caption must return string, got %T", captionStr)
+		var ok bool
+		if r, ok = captionStr.(string); !ok {
+			return nil, errors.Errorf("caption must return string, got %T", captionStr)
+		}
 	}
 
 	caption := &entity.Builder{}
+	if prefix != "" {
+		caption.Code(prefix)
+		if len(r) > 0 {
+			caption.Plain("\n")
+		}
+	}
 	if len(r) > 0 {
-		if err = html.HTML(strings.NewReader(r), caption, html.Options{
+		if err := html.HTML(strings.NewReader(r), caption, html.Options{
 			UserResolver:          nil,
 			DisableTelegramEscape: false,
 		}); err != nil {
@@ -229,6 +405,75 @@ func (i *iter) resolveCaption(env Env) (*entity.Builder, error) {
 	return caption, nil
 }
 
+func (i *iter) resolveSchedule(env Env, cur *File) (time.Time, error) {
+	if !cur.Schedule.IsZero() {
+		if !cur.Schedule.After(time.Now()) {
+			return time.Time{}, errors.Errorf("schedule time %s is in the past", cur.Schedule.Format(time.DateTime))
+		}
+		return cur.Schedule, nil
+	}
+
+	if i.sched == nil {
+		return time.Time{}, nil
+	}
+
+	// parts of the same file are posted together
+	if cur.Part != nil && cur.Part.Part > 1 {
+		return i.last, nil
+	}
+
+	t, err := i.sched(env, i.posted)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !t.IsZero() && !t.After(time.Now()) {
+		return time.Time{}, errors.Errorf("schedule time %s is in the past", t.Format(time.DateTime))
+	}
+
+	i.posted++
+	i.last = t
+	return t, nil
+}
+
+func (i *iter) resolveMedia(env Env, cur *File) (uploader.MediaType, bool, error) {
+	spoiler := i.opts.Spoiler || cur.Spoiler
+
+	if cur.Media != "" {
+		typ, err := uploader.ParseMediaType(cur.Media)
+		return typ, spoiler, err
+	}
+
+	if i.media == nil {
+		return uploader.MediaTypeAuto, spoiler, nil
+	}
+
+	result, err := texpr.Run(i.media, env)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "parse expression")
+	}
+
+	var m media
+	switch r := result.(type) {
+	case string:
+		m.Type = r
+	case map[string]interface{}:
+		if err = mapstructure.WeakDecode(r, &m); err != nil {
+			return 0, false, errors.Wrapf(err, "decode media: %v", result)
+		}
+	default:
+		return 0, false, errors.Errorf("media expression must return string or media: %T", result)
+	}
+
+	typ := uploader.MediaTypeAuto
+	if m.Type != "" {
+		if typ, err = uploader.ParseMediaType(m.Type); err != nil {
+			return 0, false, err
+		}
+	}
+
+	return typ, spoiler || m.Spoiler, nil
+}
+
 func (i *iter) resolveThumb(path string) (*uploaderFile, error) {
 	if path == "" {
 		return nil, nil
@@ -245,10 +490,55 @@ func (i *iter) resolveThumb(path string) (*uploaderFile, error) {
 		return nil, errors.Wrap(err, "open thumbnail file")
 	}
 
-	return &uploaderFile{
-		File: thumb,
-		size: 0,
-	}, nil
+	return newUploaderFile(thumb, 0), nil
+}
+
+// Skipped returns the count of files which already exist in destination
+func (i *iter) Skipped() int {
+	return i.skipped
+}
+
+func (i *iter) isFinished(index int) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	_, ok := i.finished[index]
+	return ok
+}
+
+func (i *iter) SetFinished(finished map[int]struct{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.finished = finished
+}
+
+func (i *iter) Finished() map[int]struct{} {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.finished
+}
+
+func (i *iter) Finish(index int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.finished[index] = struct{}{}
+}
+
+func (i *iter) Total() int {
+	return len(i.files)
+}
+
+func closeFiles(files ...*uploaderFile) error {
+	var err error
+	for _, f := range files {
+		if f != nil {
+			multierr.AppendInto(&err, f.Close())
+		}
+	}
+	return err
 }
 
 func (i *iter) Value() uploader.Elem {
@@ -0,0 +1,133 @@
+package up
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/core/util/fsutil"
+	"github.com/iyear/tdl/pkg/schedule"
+)
+
+// job is a line of manifest file
+type job struct {
+	Path     string  `json:"path"`     // local path, URL or archive entry
+	Name     string  `json:"name"`     // file name of URL source
+	To       string  `json:"to"`       // destination peer, empty means --chat/--to or 'Saved Messages'
+	Topic    int     `json:"topic"`    // topic or reply to message id
+	Caption  *string `json:"caption"`  // HTML caption, null means --caption expression
+	Thumb    string  `json:"thumb"`    // thumbnail path
+	Photo    *bool   `json:"photo"`    // true uploads images as photo, false as document, null means --photo
+	Media    string  `json:"media"`    // media type, empty means --media flag
+	Spoiler  bool    `json:"spoiler"`  // hide the photo or video under a spoiler
+	Schedule string  `json:"schedule"` // absolute time to post the message
+}
+
+// readManifest reads jobs from JSON Lines file, and returns files and fingerprint of the manifest
+func readManifest(path string) ([]*File, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "read manifest")
+	}
+
+	sum := sha256.Sum256(b)
+	dir := filepath.Dir(path)
+	now := time.Now()
+
+	files := make([]*File, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // caption can be long
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var j job
+		if err = json.Unmarshal([]byte(text), &j); err != nil {
+			return nil, "", errors.Wrapf(err, "line %d: invalid job", line)
+		}
+
+		f, err := j.file(dir, now)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "line %d", line)
+		}
+		files = append(files, f)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, "", errors.Wrap(err, "scan manifest")
+	}
+
+	return files, hex.EncodeToString(sum[:]), nil
+}
+
+// file converts job to file, relative local paths are resolved against the manifest dir
+func (j *job) file(dir string, now time.Time) (*File, error) {
+	if j.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	if j.Path == stdinPath {
+		return nil, errors.New("stdin is not supported in manifest")
+	}
+
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) || isURL(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	f := &File{
+		File:    resolve(j.Path),
+		Name:    j.Name,
+		Thumb:   resolve(j.Thumb),
+		Thread:  j.Topic,
+		To:      j.To,
+		Caption: j.Caption,
+		Photo:   j.Photo,
+		Media:   j.Media,
+		Spoiler: j.Spoiler,
+	}
+	if isURL(f.File) && f.Name == "" {
+		f.Name = urlName(f.File)
+	}
+
+	if isLocal(f.File) {
+		stat, err := os.Stat(f.File)
+		if err != nil {
+			return nil, errors.Wrap(err, "stat file")
+		}
+		if stat.IsDir() {
+			return nil, errors.Errorf("%s is a directory", f.File)
+		}
+		f.Root = filepath.Dir(f.File)
+	}
+	if f.Thumb != "" && !fsutil.PathExists(f.Thumb) {
+		return nil, errors.Errorf("thumbnail %s not found", f.Thumb)
+	}
+
+	if j.Media != "" {
+		if _, err := uploader.ParseMediaType(j.Media); err != nil {
+			return nil, err
+		}
+	}
+
+	if j.Schedule != "" {
+		t, err := schedule.ParseTime(j.Schedule, now)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse schedule")
+		}
+		f.Schedule = t
+	}
+
+	return f, nil
+}
@@ -0,0 +1,243 @@
+package up
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"go.uber.org/multierr"
+
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/texpr"
+)
+
+// replyChain records the last sent message of each peer, so that
+// each next upload replies to the previous one.
+type replyChain struct {
+	mu   sync.Mutex
+	msgs map[int64]int // peer id -> message id
+}
+
+func newReplyChain() *replyChain {
+	return &replyChain{msgs: make(map[int64]int)}
+}
+
+func (r *replyChain) last(peer int64) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.msgs[peer]
+	return id, ok
+}
+
+func (r *replyChain) set(peer int64, msg int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.msgs[peer] = msg
+}
+
+type link struct {
+	Path    string `json:"path"`
+	Chat    int64  `json:"chat"`
+	Message int    `json:"message"`
+	Link    string `json:"link"` // empty if the chat is not a channel or the message is scheduled
+	// Scheduled messages have temporary ids, which are changed after they are posted
+	Scheduled bool `json:"scheduled,omitempty"`
+}
+
+// PostEnv is the env of --on-sent-expr expression, which returns the shell command to run
+type PostEnv struct {
+	Env
+	Chat      int64  `comment:"Chat ID of the sent message"`
+	Message   int    `comment:"ID of the sent message, which is temporary if the message is scheduled"`
+	Link      string `comment:"Link of the sent message, empty if the chat is not a channel or group, or the message is scheduled"`
+	Scheduled bool   `comment:"Whether the message is scheduled"`
+}
+
+// postActions runs actions after messages are sent
+type postActions struct {
+	client     *tg.Client
+	pin        bool
+	react      string      // emoji reaction, empty means no reaction
+	onSent     string      // shell command, empty means no hook
+	onSentExpr *vm.Program // expression which returns the shell command, nil means no hook
+	chain      *replyChain // nil means no reply chain
+
+	mu    sync.Mutex
+	links *os.File // nil means no mapping file
+}
+
+func newPostActions(ctx context.Context, client *tg.Client, opts Options) (*postActions, error) {
+	p := &postActions{
+		client: client,
+		pin:    opts.Pin,
+		react:  opts.React,
+		onSent: opts.OnSent,
+	}
+	if opts.OnSentExpr != "" {
+		program, err := expr.Compile(opts.OnSentExpr,
+			expr.Env(PostEnv{Env: exprEnv(ctx, nil, false)}),
+			expr.AsKind(reflect.String))
+		if err != nil {
+			return nil, errors.Wrap(err, "compile on-sent expression")
+		}
+		p.onSentExpr = program
+	}
+	if opts.ReplyChain {
+		p.chain = newReplyChain()
+	}
+
+	if opts.LinkFile != "" {
+		f, err := os.OpenFile(opts.LinkFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, errors.Wrap(err, "open link file")
+		}
+		p.links = f
+	}
+
+	return p, nil
+}
+
+// enabled reports whether any action should be run
+func (p *postActions) enabled() bool {
+	return p.pin || p.react != "" || p.onSent != "" || p.onSentExpr != nil || p.chain != nil || p.links != nil
+}
+
+func (p *postActions) run(ctx context.Context, elem *iterElem, msg *tg.Message) error {
+	l := link{
+		Path:    elem.file.Path(),
+		Chat:    elem.to.ID(),
+		Message: msg.ID,
+	}
+
+	// scheduled messages have temporary ids, which can't be pinned, reacted, replied or linked,
+	// and those flags are rejected together with --schedule. Link file and hook still get the temporary id.
+	if !elem.schedule.IsZero() {
+		l.Scheduled = true
+		return p.notify(ctx, elem, l)
+	}
+
+	if p.chain != nil {
+		p.chain.set(elem.to.ID(), msg.ID)
+	}
+	l.Link = tutil.MessageLink(elem.to, elem.thread, msg.ID)
+
+	var err error
+	if p.pin {
+		if _, e := p.client.MessagesUpdatePinnedMessage(ctx, &tg.MessagesUpdatePinnedMessageRequest{
+			Silent: true,
+			Peer:   elem.to.InputPeer(),
+			ID:     msg.ID,
+		}); e != nil {
+			multierr.AppendInto(&err, errors.Wrap(e, "pin message"))
+		}
+	}
+
+	if p.react != "" {
+		if _, e := p.client.MessagesSendReaction(ctx, &tg.MessagesSendReactionRequest{
+			Peer:     elem.to.InputPeer(),
+			MsgID:    msg.ID,
+			Reaction: []tg.ReactionClass{&tg.ReactionEmoji{Emoticon: p.react}},
+		}); e != nil {
+			multierr.AppendInto(&err, errors.Wrap(e, "send reaction"))
+		}
+	}
+
+	multierr.AppendInto(&err, p.notify(ctx, elem, l))
+	return err
+}
+
+// notify writes the link file and runs the on-sent hook
+func (p *postActions) notify(ctx context.Context, elem *iterElem, l link) (err error) {
+	if p.links != nil {
+		if e := p.writeLink(l); e != nil {
+			multierr.AppendInto(&err, errors.Wrap(e, "write link"))
+		}
+	}
+
+	if p.onSent != "" || p.onSentExpr != nil {
+		if e := p.runOnSent(ctx, elem, l); e != nil {
+			multierr.AppendInto(&err, errors.Wrap(e, "run on-sent hook"))
+		}
+	}
+
+	return err
+}
+
+// runOnSent runs the shell command, or the command returned by the expression
+func (p *postActions) runOnSent(ctx context.Context, elem *iterElem, l link) error {
+	command := p.onSent
+	if p.onSentExpr != nil {
+		result, err := texpr.Run(p.onSentExpr, PostEnv{
+			Env:       elem.env,
+			Chat:      l.Chat,
+			Message:   l.Message,
+			Link:      l.Link,
+			Scheduled: l.Scheduled,
+		})
+		if err != nil {
+			return errors.Wrap(err, "run expression")
+		}
+		command = result.(string)
+	}
+
+	// empty command means skipping the message
+	if command == "" {
+		return nil
+	}
+	return p.hook(ctx, command, l)
+}
+
+func (p *postActions) writeLink(l link) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.links.Write(append(b, '\n'))
+	return err
+}
+
+// hook runs the command in shell with message info in environment variables
+func (p *postActions) hook(ctx context.Context, command string, l link) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"TDL_FILE="+l.Path,
+		"TDL_CHAT="+strconv.FormatInt(l.Chat, 10),
+		"TDL_MESSAGE="+strconv.Itoa(l.Message),
+		"TDL_LINK="+l.Link,
+		"TDL_SCHEDULED="+strconv.FormatBool(l.Scheduled),
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "output: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (p *postActions) Close() error {
+	if p.links != nil {
+		return p.links.Close()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package up
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPostActionsExpr(t *testing.T) {
+	ctx := context.Background()
+
+	// typo of expression is an error instead of a shell command
+	_, err := newPostActions(ctx, nil, Options{OnSentExpr: `"echo " + Mesage`})
+	assert.Error(t, err)
+
+	// expression must return the command
+	_, err = newPostActions(ctx, nil, Options{OnSentExpr: `Message`})
+	assert.Error(t, err)
+
+	p, err := newPostActions(ctx, nil, Options{OnSentExpr: `Link`})
+	require.NoError(t, err)
+	assert.True(t, p.enabled())
+	assert.NotNil(t, p.onSentExpr)
+	require.NoError(t, p.Close())
+
+	// plain command is never compiled
+	p, err = newPostActions(ctx, nil, Options{OnSent: `echo "$TDL_FILE" + x`})
+	require.NoError(t, err)
+	assert.Nil(t, p.onSentExpr)
+	require.NoError(t, p.Close())
+}
+
+func TestPostActionsScheduled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook output is written by sh")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	links, out := filepath.Join(dir, "links.jsonl"), filepath.Join(dir, "out.txt")
+
+	p, err := newPostActions(ctx, nil, Options{
+		LinkFile:   links,
+		OnSentExpr: `"echo " + string(Message) + " " + string(Scheduled) + " \"$TDL_SCHEDULED\" > ` + out + `"`,
+	})
+	require.NoError(t, err)
+
+	manager := peers.Options{}.Build(tg.NewClient(nil))
+	elem := &iterElem{
+		file:     &uploaderFile{path: "a.jpg", name: "a.jpg"},
+		to:       manager.Channel(&tg.Channel{ID: 100, Username: "tdl"}),
+		schedule: time.Now().Add(time.Hour),
+	}
+
+	// pin, react and reply chain are rejected with schedule, so client is never used
+	require.NoError(t, p.run(ctx, elem, &tg.Message{ID: 42}))
+	require.NoError(t, p.Close())
+
+	b, err := os.ReadFile(links)
+	require.NoError(t, err)
+	var l link
+	require.NoError(t, json.Unmarshal(b, &l))
+	assert.Equal(t, link{Path: "a.jpg", Chat: 100, Message: 42, Scheduled: true}, l)
+
+	b, err = os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "42 true true", strings.TrimSpace(string(b)))
+}
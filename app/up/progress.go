@@ -1,12 +1,14 @@
 package up
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
 
 	"github.com/fatih/color"
 	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
 	pw "github.com/jedib0t/go-pretty/v6/progress"
 
 	"github.com/iyear/tdl/core/uploader"
@@ -15,8 +17,16 @@ import (
 )
 
 type progress struct {
+	ctx      context.Context
 	pw       pw.Writer
 	trackers *sync.Map // map[tuple]*pw.Tracker
+	dedup    *dedup
+	parts    *partRemover
+
+	// sent is called after the file is sent successfully
+	sent func(elem *iterElem, msg *tg.Message)
+	// done is called after the file is uploaded and post-processed successfully
+	done func(elem *iterElem)
 }
 
 type tuple struct {
@@ -24,10 +34,12 @@ type tuple struct {
 	to   int64
 }
 
-func newProgress(p pw.Writer) *progress {
+func newProgress(ctx context.Context, p pw.Writer, dedup *dedup) *progress {
 	return &progress{
+		ctx:      ctx,
 		pw:       p,
 		trackers: &sync.Map{},
+		dedup:    dedup,
 	}
 }
 
@@ -47,6 +59,12 @@ func (p *progress) OnUpload(elem uploader.Elem, state uploader.ProgressState) {
 	t.SetValue(state.Uploaded)
 }
 
+func (p *progress) OnSent(elem uploader.Elem, msg *tg.Message) {
+	if p.sent != nil {
+		p.sent(elem.(*iterElem), msg)
+	}
+}
+
 func (p *progress) OnDone(elem uploader.Elem, err error) {
 	tracker, ok := p.trackers.Load(p.tuple(elem))
 	if !ok {
@@ -65,12 +83,28 @@ func (p *progress) OnDone(elem uploader.Elem, err error) {
 		return
 	}
 
-	if e.remove {
-		if err := os.Remove(e.file.File.Name()); err != nil {
+	if p.dedup != nil && e.hash != "" {
+		if err := p.dedup.record(p.ctx, e.to.ID(), e.hash); err != nil {
+			p.fail(t, elem, errors.Wrap(err, "record uploaded hash"))
+			return
+		}
+	}
+
+	if err := p.parts.finish(e.src); err != nil {
+		p.fail(t, elem, errors.Wrap(err, "remove split file"))
+		return
+	}
+
+	if e.remove && e.FilePath() != "" {
+		if err := os.Remove(e.FilePath()); err != nil {
 			p.fail(t, elem, errors.Wrap(err, "remove file"))
 			return
 		}
 	}
+
+	if p.done != nil {
+		p.done(e)
+	}
 }
 
 func (p *progress) closeFile(e *iterElem) error {
@@ -93,7 +127,7 @@ func (p *progress) fail(t *pw.Tracker, elem uploader.Elem, err error) {
 }
 
 func (p *progress) tuple(elem uploader.Elem) tuple {
-	return tuple{elem.(*iterElem).file.File.Name(), elem.(*iterElem).to.ID()}
+	return tuple{elem.(*iterElem).file.Path(), elem.(*iterElem).to.ID()}
 }
 
 func (p *progress) processMessage(elem uploader.Elem) string {
@@ -102,5 +136,5 @@ func (p *progress) processMessage(elem uploader.Elem) string {
 
 func (p *progress) elemString(elem uploader.Elem) string {
 	e := elem.(*iterElem)
-	return fmt.Sprintf("%s -> %s(%d)", e.file.File.Name(), e.to.VisibleName(), e.to.ID())
+	return fmt.Sprintf("%s -> %s(%d)", e.file.Path(), e.to.VisibleName(), e.to.ID())
 }
@@ -0,0 +1,80 @@
+package up
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/key"
+)
+
+func resume(ctx context.Context, kvd storage.Storage, it *iter, fingerprint string, ask bool) error {
+	logctx.From(ctx).Debug("Check resume key",
+		zap.String("fingerprint", fingerprint))
+
+	b, err := kvd.Get(ctx, key.Resume(fingerprint))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if len(b) == 0 { // no progress
+		return nil
+	}
+
+	finished := make(map[int]struct{})
+	if err = json.Unmarshal(b, &finished); err != nil {
+		return err
+	}
+
+	// finished is empty, no need to resume
+	if len(finished) == 0 {
+		return nil
+	}
+
+	confirm := false
+	resumeStr := fmt.Sprintf("Found unfinished upload, continue from '%d/%d'", len(finished), it.Total())
+	if ask {
+		if err = survey.AskOne(&survey.Confirm{
+			Message: color.YellowString(resumeStr + "?"),
+		}, &confirm); err != nil {
+			return err
+		}
+	} else {
+		color.Yellow(resumeStr)
+		confirm = true
+	}
+
+	logctx.From(ctx).Debug("Resume upload",
+		zap.Int("finished", len(finished)))
+
+	if !confirm {
+		// clear resume key
+		return kvd.Delete(ctx, key.Resume(fingerprint))
+	}
+
+	it.SetFinished(finished)
+	return nil
+}
+
+func saveProgress(ctx context.Context, kvd storage.Storage, it *iter, fingerprint string) error {
+	finished := it.Finished()
+	logctx.From(ctx).Debug("Save progress",
+		zap.Int("finished", len(finished)))
+
+	// all jobs are finished, clear resume key
+	if len(finished) >= it.Total() {
+		return kvd.Delete(ctx, key.Resume(fingerprint))
+	}
+
+	b, err := json.Marshal(finished)
+	if err != nil {
+		return err
+	}
+	return kvd.Set(ctx, key.Resume(fingerprint), b)
+}
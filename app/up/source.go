@@ -0,0 +1,157 @@
+package up
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+)
+
+const (
+	stdinPath       = "-"
+	archiveSep      = "!/"
+	defaultHTTPName = "file"
+)
+
+func isURL(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// splitArchive splits 'archive.zip!/inner/path' into archive and inner path
+func splitArchive(p string) (archive, inner string, ok bool) {
+	idx := strings.Index(p, archiveSep)
+	if idx < 0 || !strings.EqualFold(path.Ext(p[:idx]), ".zip") {
+		return "", "", false
+	}
+
+	return p[:idx], p[idx+len(archiveSep):], true
+}
+
+// isLocal reports whether the path is a plain local file
+func isLocal(p string) bool {
+	if p == stdinPath || isURL(p) {
+		return false
+	}
+	_, _, ok := splitArchive(p)
+	return !ok
+}
+
+// urlName returns the file name of the URL
+func urlName(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return defaultHTTPName
+	}
+
+	if name := path.Base(parsed.Path); name != "." && name != "/" {
+		return name
+	}
+	return defaultHTTPName
+}
+
+// walkArchive lists entries of the archive under the inner path
+func walkArchive(archive, inner string) ([]string, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, errors.Wrap(err, "open archive")
+	}
+	defer func() { _ = r.Close() }()
+
+	inner = strings.Trim(inner, "/")
+
+	entries := make([]string, 0)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if inner == "" || f.Name == inner || strings.HasPrefix(f.Name, inner+"/") {
+			entries = append(entries, archive+archiveSep+f.Name)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.Errorf("no entries found in %s%s%s", archive, archiveSep, inner)
+	}
+
+	return entries, nil
+}
+
+// openStream opens non-local sources as streams
+func openStream(ctx context.Context, cur *File) (*uploaderFile, error) {
+	switch {
+	case cur.File == stdinPath:
+		return newStreamFile(io.NopCloser(os.Stdin), cur.File, cur.Name, -1), nil
+	case isURL(cur.File):
+		return openURL(ctx, cur)
+	}
+
+	archive, inner, ok := splitArchive(cur.File)
+	if !ok {
+		return nil, errors.Errorf("unsupported source: %s", cur.File)
+	}
+
+	return openArchive(archive, inner, cur.File)
+}
+
+func openURL(ctx context.Context, cur *File) (*uploaderFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cur.File, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "do request")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	// ContentLength is -1 if unknown, which is also accepted by uploader
+	return newStreamFile(resp.Body, cur.File, cur.Name, resp.ContentLength), nil
+}
+
+func openArchive(archive, inner, p string) (_ *uploaderFile, rerr error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, errors.Wrap(err, "open archive")
+	}
+	defer func() {
+		if rerr != nil {
+			_ = r.Close()
+		}
+	}()
+
+	f, err := r.Open(inner)
+	if err != nil {
+		return nil, errors.Wrap(err, "open entry")
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "stat entry")
+	}
+
+	return newStreamFile(&archiveEntry{File: f, archive: r}, p, path.Base(inner), stat.Size()), nil
+}
+
+type archiveEntry struct {
+	fs.File
+	archive *zip.ReadCloser
+}
+
+func (a *archiveEntry) Close() error {
+	return multierr.Combine(a.File.Close(), a.archive.Close())
+}
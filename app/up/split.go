@@ -0,0 +1,78 @@
+package up
+
+import (
+	"os"
+	"sync"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/pkg/split"
+)
+
+// splitFiles expands files larger than size into numbered parts
+func splitFiles(files []*File, size int64) ([]*File, error) {
+	if size <= 0 {
+		return files, nil
+	}
+
+	res := make([]*File, 0, len(files))
+	for _, f := range files {
+		if !isLocal(f.File) {
+			res = append(res, f)
+			continue
+		}
+
+		parts, err := split.Plan(f.File, size)
+		if err != nil {
+			return nil, errors.Wrapf(err, "split file %s", f.File)
+		}
+
+		if len(parts) == 0 {
+			res = append(res, f)
+			continue
+		}
+
+		for _, p := range parts {
+			res = append(res, &File{
+				File:  f.File,
+				Root:  f.Root,
+				Thumb: f.Thumb,
+				Part:  p,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+// partRemover removes the original file once all its parts are uploaded
+type partRemover struct {
+	mu   *sync.Mutex
+	done map[string]int // manifest id -> number of uploaded parts
+}
+
+func newPartRemover() *partRemover {
+	return &partRemover{
+		mu:   &sync.Mutex{},
+		done: make(map[string]int),
+	}
+}
+
+// finish records the uploaded or skipped part of the file, and removes
+// the file if it's the last one. Nil remover does nothing.
+func (r *partRemover) finish(f *File) error {
+	if r == nil || f.Part == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	r.done[f.Part.ID()]++
+	complete := r.done[f.Part.ID()] == f.Part.Total
+	r.mu.Unlock()
+
+	if !complete {
+		return nil
+	}
+
+	return os.Remove(f.File)
+}
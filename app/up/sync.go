@@ -0,0 +1,372 @@
+package up
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/unpack"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/spf13/viper"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/dcpool"
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/tclient"
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/consts"
+	"github.com/iyear/tdl/pkg/key"
+	"github.com/iyear/tdl/pkg/prog"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+//go:generate go-enum --values --names --flag --nocase
+
+// SyncStructure is the way to preserve folder structure in chat
+// ENUM(none, caption, topic)
+type SyncStructure int
+
+type SyncOptions struct {
+	Dir       string
+	Chat      string
+	Thread    int
+	Includes  []string
+	Excludes  []string
+	Caption   string
+	Photo     bool
+	Structure SyncStructure
+	Delete    bool // delete messages of removed or replaced files
+	DryRun    bool
+}
+
+type syncState struct {
+	Files  map[string]*syncFile `json:"files"`  // relative path -> file
+	Topics map[string]int       `json:"topics"` // relative dir -> topic id
+}
+
+type syncFile struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"` // unix nano
+	Hash    string `json:"hash"`
+	Msg     int    `json:"msg"` // message id in chat, zero means unknown
+}
+
+// SyncPush uploads new or changed files in the directory, and records their state
+// in kv storage, so that unchanged files are skipped in the next run.
+func SyncPush(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts SyncOptions) (rerr error) {
+	root, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return errors.Wrap(err, "abs dir")
+	}
+
+	pool := dcpool.NewPool(c,
+		int64(viper.GetInt(consts.FlagPoolSize)),
+		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	defer multierr.AppendInvoke(&rerr, multierr.Close(pool))
+
+	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(pool.Default(ctx))
+
+	var to peers.Peer
+	if opts.Chat == "" {
+		to, err = manager.Self(ctx)
+	} else {
+		to, err = tutil.GetInputPeer(ctx, manager, opts.Chat)
+	}
+	if err != nil {
+		return errors.Wrap(err, "resolve chat")
+	}
+
+	stateKey := key.Sync(syncFingerprint(root, to.ID(), opts.Thread))
+	state, err := loadSyncState(ctx, kvd, stateKey)
+	if err != nil {
+		return errors.Wrap(err, "load sync state")
+	}
+
+	files, err := walk([]string{root}, opts.Includes, opts.Excludes, "")
+	if err != nil {
+		return err
+	}
+
+	pending, removed, err := diffSync(root, files, state)
+	if err != nil {
+		return errors.Wrap(err, "diff files")
+	}
+
+	color.Blue("Files: %d | Changed: %d | Removed: %d", len(files), len(pending), len(removed))
+
+	if opts.DryRun {
+		for _, f := range pending {
+			fmt.Println("+", f.rel)
+		}
+		for _, rel := range removed {
+			fmt.Println("-", rel)
+		}
+		return nil
+	}
+
+	mu := &sync.Mutex{}
+	defer func() { // always save state, even if interrupted
+		mu.Lock()
+		defer mu.Unlock()
+		multierr.AppendInto(&rerr, saveSyncState(ctx, kvd, stateKey, state))
+	}()
+
+	sender := message.NewSender(pool.Default(ctx))
+	deleteMsgs := func(ids ...int) error {
+		if !opts.Delete || len(ids) == 0 {
+			return nil
+		}
+		_, err := sender.To(to.InputPeer()).Revoke().Messages(ctx, ids...)
+		return err
+	}
+
+	// mirror deletions
+	ids := make([]int, 0, len(removed))
+	for _, rel := range removed {
+		if msg := state.Files[rel].Msg; msg != 0 {
+			ids = append(ids, msg)
+		}
+	}
+	if err = deleteMsgs(ids...); err != nil {
+		return errors.Wrap(err, "delete removed files")
+	}
+	if opts.Delete {
+		for _, rel := range removed {
+			delete(state.Files, rel)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	upFiles := make([]*File, 0, len(pending))
+	byPath := make(map[string]*pendingFile, len(pending))
+	for _, p := range pending {
+		switch opts.Structure {
+		case SyncStructureCaption:
+			p.file.Prefix = p.rel
+		case SyncStructureTopic:
+			if p.file.Thread, err = syncTopic(ctx, pool.Default(ctx), to, state, path.Dir(p.rel), opts.Thread); err != nil {
+				return errors.Wrapf(err, "resolve topic of %s", p.rel)
+			}
+		}
+
+		upFiles = append(upFiles, p.file)
+		byPath[p.file.File] = p
+	}
+
+	caption, err := resolveCaption(ctx, opts.Caption)
+	if err != nil {
+		return errors.Wrap(err, "get caption")
+	}
+	dest, err := resolveDest(ctx, manager, "")
+	if err != nil {
+		return errors.Wrap(err, "get target peer")
+	}
+
+	upOpts := Options{
+		Chat:    opts.Chat,
+		Thread:  opts.Thread,
+		Photo:   opts.Photo,
+		Caption: opts.Caption,
+	}
+
+	upProgress := prog.New(utils.Byte.FormatBinaryBytes)
+	upProgress.SetNumTrackersExpected(len(upFiles))
+	prog.EnablePS(ctx, upProgress)
+
+	progress := newProgress(ctx, upProgress, nil)
+	progress.sent = func(elem *iterElem, msg *tg.Message) {
+		p, ok := byPath[elem.src.File]
+		if !ok {
+			return
+		}
+
+		mu.Lock()
+		old := state.Files[p.rel]
+		p.state.Msg = msg.ID
+		state.Files[p.rel] = p.state
+		mu.Unlock()
+
+		if old != nil && old.Msg != 0 {
+			if err := deleteMsgs(old.Msg); err != nil {
+				logctx.From(ctx).Warn("Delete replaced file",
+					zap.String("file", p.rel),
+					zap.Error(err))
+			}
+		}
+	}
+
+	options := uploader.Options{
+		Client:   pool.Default(ctx),
+		Threads:  viper.GetInt(consts.FlagThreads),
+		Iter:     newIter(upFiles, dest, caption, nil, nil, upOpts, nil, nil, viper.GetDuration(consts.FlagDelay), manager),
+		Progress: progress,
+	}
+
+	go upProgress.Render()
+	defer prog.Wait(ctx, upProgress)
+
+	return uploader.New(options).Upload(ctx, viper.GetInt(consts.FlagLimit))
+}
+
+type pendingFile struct {
+	rel   string
+	file  *File
+	state *syncFile
+}
+
+// diffSync returns new or changed files, and removed relative paths
+func diffSync(root string, files []*File, state *syncState) ([]*pendingFile, []string, error) {
+	seen := make(map[string]struct{}, len(files))
+	pending := make([]*pendingFile, 0)
+
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.File)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "relative path")
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = struct{}{}
+
+		stat, err := os.Stat(f.File)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "stat file")
+		}
+
+		old := state.Files[rel]
+		if old != nil && old.Size == stat.Size() && old.ModTime == stat.ModTime().UnixNano() {
+			continue
+		}
+
+		hash, err := hashFile(f)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "hash %s", rel)
+		}
+
+		// touched but not modified
+		if old != nil && old.Size == stat.Size() && old.Hash == hash {
+			old.ModTime = stat.ModTime().UnixNano()
+			continue
+		}
+
+		pending = append(pending, &pendingFile{
+			rel:  rel,
+			file: f,
+			state: &syncFile{
+				Size:    stat.Size(),
+				ModTime: stat.ModTime().UnixNano(),
+				Hash:    hash,
+			},
+		})
+	}
+
+	removed := make([]string, 0)
+	for rel := range state.Files {
+		if _, ok := seen[rel]; !ok {
+			removed = append(removed, rel)
+		}
+	}
+	sort.Strings(removed)
+
+	return pending, removed, nil
+}
+
+// syncTopic returns the topic of the relative dir, and creates it if not exists
+func syncTopic(ctx context.Context, client *tg.Client, to peers.Peer, state *syncState, dir string, root int) (int, error) {
+	if dir == "." {
+		return root, nil
+	}
+	if id, ok := state.Topics[dir]; ok {
+		return id, nil
+	}
+
+	ch, ok := to.(peers.Channel)
+	if !ok || !ch.Raw().Forum {
+		return 0, errors.New("topic structure requires a forum chat")
+	}
+
+	topics, err := client.ChannelsGetForumTopics(ctx, &tg.ChannelsGetForumTopicsRequest{
+		Channel: ch.InputChannel(),
+		Q:       dir,
+		Limit:   100,
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "get forum topics")
+	}
+
+	for _, t := range topics.Topics {
+		if topic, ok := t.(*tg.ForumTopic); ok && topic.Title == dir {
+			state.Topics[dir] = topic.ID
+			return topic.ID, nil
+		}
+	}
+
+	id, err := unpack.MessageID(client.ChannelsCreateForumTopic(ctx, &tg.ChannelsCreateForumTopicRequest{
+		Channel:  ch.InputChannel(),
+		Title:    dir,
+		RandomID: rand.Int63(),
+	}))
+	if err != nil {
+		return 0, errors.Wrap(err, "create forum topic")
+	}
+
+	state.Topics[dir] = id
+	return id, nil
+}
+
+func syncFingerprint(root string, peer int64, thread int) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", root, peer, thread))))
+}
+
+func loadSyncState(ctx context.Context, kvd storage.Storage, key string) (*syncState, error) {
+	state := &syncState{
+		Files:  make(map[string]*syncFile),
+		Topics: make(map[string]int),
+	}
+
+	b, err := kvd.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	// old state may be saved without topics
+	if state.Topics == nil {
+		state.Topics = make(map[string]int)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*syncFile)
+	}
+
+	return state, nil
+}
+
+func saveSyncState(ctx context.Context, kvd storage.Storage, key string, state *syncState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return kvd.Set(ctx, key, b)
+}
@@ -0,0 +1,90 @@
+package up
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSync(t *testing.T) {
+	hash := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	mtime := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		rel     string
+		content string
+		state   *syncFile // nil means not synced before
+		pending bool
+	}{
+		{name: "added", rel: "added.txt", content: "added", pending: true},
+		{name: "added in sub dir", rel: "sub/added.txt", content: "nested", pending: true},
+		{name: "unchanged", rel: "unchanged.txt", content: "same",
+			state: &syncFile{Size: 4, ModTime: mtime.UnixNano(), Hash: hash("same"), Msg: 1}},
+		{name: "touched", rel: "touched.txt", content: "same",
+			state: &syncFile{Size: 4, ModTime: mtime.Add(-time.Hour).UnixNano(), Hash: hash("same"), Msg: 2}},
+		{name: "changed content", rel: "changed.txt", content: "new!", pending: true,
+			state: &syncFile{Size: 4, ModTime: mtime.Add(-time.Hour).UnixNano(), Hash: hash("old!"), Msg: 3}},
+		{name: "changed size", rel: "resized.txt", content: "longer", pending: true,
+			state: &syncFile{Size: 4, ModTime: mtime.UnixNano(), Hash: hash("long"), Msg: 4}},
+	}
+
+	root := t.TempDir()
+	state := &syncState{
+		Files: map[string]*syncFile{
+			"removed.txt":     {Size: 1, Msg: 5},
+			"gone/nested.txt": {Size: 1, Msg: 6},
+		},
+		Topics: map[string]int{},
+	}
+
+	files := make([]*File, 0, len(tests))
+	for _, tt := range tests {
+		path := filepath.Join(root, filepath.FromSlash(tt.rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+		files = append(files, &File{File: path, Root: root})
+		if tt.state != nil {
+			state.Files[tt.rel] = tt.state
+		}
+	}
+
+	pending, removed, err := diffSync(root, files, state)
+	require.NoError(t, err)
+
+	got := make(map[string]*pendingFile, len(pending))
+	for _, p := range pending {
+		got[p.rel] = p
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := got[tt.rel]
+			require.Equal(t, tt.pending, ok)
+			if !ok {
+				// touched files are not uploaded again, but their mtime is updated
+				assert.Equal(t, mtime.UnixNano(), state.Files[tt.rel].ModTime)
+				return
+			}
+
+			assert.Equal(t, &syncFile{
+				Size:    int64(len(tt.content)),
+				ModTime: mtime.UnixNano(),
+				Hash:    hash(tt.content),
+			}, p.state)
+		})
+	}
+
+	assert.Equal(t, []string{"gone/nested.txt", "removed.txt"}, removed)
+}
@@ -3,10 +3,13 @@ package up
 import (
 	"context"
 	"fmt"
+	"mime"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
@@ -15,6 +18,7 @@ import (
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
 	"github.com/spf13/viper"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
@@ -26,7 +30,9 @@ import (
 	"github.com/iyear/tdl/core/uploader"
 	"github.com/iyear/tdl/core/util/tutil"
 	"github.com/iyear/tdl/pkg/consts"
+	"github.com/iyear/tdl/pkg/crypt"
 	"github.com/iyear/tdl/pkg/prog"
+	"github.com/iyear/tdl/pkg/schedule"
 	"github.com/iyear/tdl/pkg/texpr"
 	"github.com/iyear/tdl/pkg/utils"
 )
@@ -36,27 +42,84 @@ type Options struct {
 	Thread   int
 	To       string
 	Paths    []string
+	Name     string // file name of stdin or URL sources
 	Includes []string
 	Excludes []string
 	Remove   bool
 	Gdrive   bool
 	Photo    bool
 	Caption  string
+	Schedule string // absolute time, spacing spec or expression of Env
+	Media    string // media type or expression of Env, empty means detecting by MIME
+	Spoiler  bool
+
+	// Manifest is a JSON Lines file of upload jobs, which replaces Paths
+	Manifest string
+	// resume opts of manifest
+	Continue, Restart bool
+
+	// post-upload actions
+	Pin        bool
+	ReplyChain bool
+	React      string // emoji reaction added to each sent message
+	OnSent     string // shell command run after each message is sent
+	OnSentExpr string // expression of PostEnv returning the shell command, replaces OnSent
+	LinkFile   string // JSON Lines file of local path to message link
+
+	// SplitSize splits files larger than it into parts, zero means no split
+	SplitSize int64
+
+	// deduplication opts
+	SkipExisting bool
+	SkipHash     bool
+	SkipDepth    int // number of latest messages indexed by SkipExisting, zero means the whole history
+
+	// encryption opts
+	Encrypt     bool
+	EncryptName bool
+	KeyFile     string
+	Passphrase  string
 }
 
 type Env struct {
-	FilePath  string `comment:"File path"`
-	FileName  string `comment:"File name"`
-	FileExt   string `comment:"File extension"`
-	ThumbPath string `comment:"Thumbnail path"`
-	MIME      string `comment:"File mime type"`
+	FilePath  string   `comment:"File path"`
+	FileName  string   `comment:"File name"`
+	FileExt   string   `comment:"File extension"`
+	FileSize  int64    `comment:"File size. Unit: Byte. -1 if unknown"`
+	ModTime   int64    `comment:"Modification time of file. Unix timestamp, 0 if unknown"`
+	Dir       string   `comment:"Parent directory relative to the walk root, '.' if the file is in the root"`
+	Dirs      []string `comment:"Parent directories relative to the walk root, from outermost to innermost"`
+	ThumbPath string   `comment:"Thumbnail path"`
+	MIME      string   `comment:"File mime type"`
+	EXIF      EnvEXIF  `comment:"EXIF of JPEG image"`
+	Video     EnvVideo `comment:"Video info of MP4 file"`
+}
+
+type EnvEXIF struct {
+	DateTaken string  `comment:"Date taken, format: 2006-01-02 15:04:05. Empty if unknown"`
+	Make      string  `comment:"Camera manufacturer"`
+	Model     string  `comment:"Camera model"`
+	HasGPS    bool    `comment:"Whether GPS coordinates exist"`
+	Latitude  float64 `comment:"GPS latitude in degrees, negative means south"`
+	Longitude float64 `comment:"GPS longitude in degrees, negative means west"`
+}
+
+type EnvVideo struct {
+	Duration int `comment:"Video duration. Unit: Second"`
+	Width    int `comment:"Video width"`
+	Height   int `comment:"Video height"`
 }
 
 func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Options) (rerr error) {
-	if opts.To == "-" || opts.Caption == "-" {
+	if opts.To == "-" || opts.Caption == "-" || opts.Schedule == "-" || opts.Media == "-" || opts.OnSentExpr == "-" {
 		fg := texpr.NewFieldsGetter(nil)
 
-		fields, err := fg.Walk(exprEnv(context.Background(), nil))
+		var env any = exprEnv(context.Background(), nil, false)
+		if opts.OnSentExpr == "-" { // link info is only available after sent
+			env = PostEnv{}
+		}
+
+		fields, err := fg.Walk(env)
 		if err != nil {
 			return fmt.Errorf("failed to walk fields: %w", err)
 		}
@@ -65,13 +128,34 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		return nil
 	}
 
-	files, err := walk(opts.Paths, opts.Includes, opts.Excludes)
-	if err != nil {
+	var (
+		files       []*File
+		fingerprint string // empty means upload can't be resumed
+		err         error
+	)
+	if opts.Manifest != "" {
+		if files, fingerprint, err = readManifest(opts.Manifest); err != nil {
+			return err
+		}
+		// parts are indexed by split size
+		fingerprint = fmt.Sprintf("%s:%d", fingerprint, opts.SplitSize)
+	} else if files, err = walk(opts.Paths, opts.Includes, opts.Excludes, opts.Name); err != nil {
+		return err
+	}
+
+	if files, err = splitFiles(files, opts.SplitSize); err != nil {
 		return err
 	}
 
 	color.Blue("Files count: %d", len(files))
 
+	var secret []byte
+	if opts.Encrypt {
+		if secret, err = crypt.Secret(opts.KeyFile, opts.Passphrase); err != nil {
+			return errors.Wrap(err, "load encryption secret")
+		}
+	}
+
 	pool := dcpool.NewPool(c,
 		int64(viper.GetInt(consts.FlagPoolSize)),
 		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
@@ -89,28 +173,95 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		return errors.Wrap(err, "get caption")
 	}
 
+	schedule, scheduleProgram, err := resolveSchedule(ctx, opts.Schedule)
+	if err != nil {
+		return errors.Wrap(err, "get schedule")
+	}
+
+	media, err := resolveMedia(ctx, opts.Media)
+	if err != nil {
+		return errors.Wrap(err, "get media type")
+	}
+
 	upProgress := prog.New(utils.Byte.FormatBinaryBytes)
 	upProgress.SetNumTrackersExpected(len(files))
 	prog.EnablePS(ctx, upProgress)
 
+	var dd *dedup
+	if opts.SkipExisting {
+		dd = newDedup(pool.Default(ctx), kvd, opts.SkipHash, opts.SkipDepth)
+	}
+
+	it := newIter(files, to, caption, schedule, media, opts, secret, dd, viper.GetDuration(consts.FlagDelay), manager)
+	progress := newProgress(ctx, upProgress, dd)
+
+	if opts.Remove && opts.SplitSize > 0 {
+		it.parts = newPartRemover()
+		progress.parts = it.parts
+	}
+
+	actions, err := newPostActions(ctx, pool.Default(ctx), opts)
+	if err != nil {
+		return errors.Wrap(err, "init post actions")
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(actions))
+
+	it.probe = usesMedia(to, caption, scheduleProgram, media, actions.onSentExpr)
+
+	if actions.enabled() {
+		it.chain = actions.chain
+		progress.sent = func(elem *iterElem, msg *tg.Message) {
+			if err := actions.run(ctx, elem, msg); err != nil {
+				upProgress.Log(color.RedString("%s post actions error: %s", progress.elemString(elem), err.Error()))
+			}
+		}
+	}
+
+	limit := viper.GetInt(consts.FlagLimit)
+	if opts.ReplyChain && limit > 1 {
+		color.Yellow("Reply chain requires sequential uploads, limit is set to 1")
+		limit = 1
+	}
+
+	if fingerprint != "" {
+		if !opts.Restart {
+			// resume upload and ask user to continue
+			if err = resume(ctx, kvd, it, fingerprint, !opts.Continue); err != nil {
+				return err
+			}
+		} else {
+			color.Yellow("Restart upload by 'restart' flag")
+		}
+
+		progress.done = func(elem *iterElem) { it.Finish(elem.index) }
+		defer func() { // save progress
+			multierr.AppendInto(&rerr, saveProgress(ctx, kvd, it, fingerprint))
+		}()
+	}
+
 	options := uploader.Options{
 		Client:   pool.Default(ctx),
 		Threads:  viper.GetInt(consts.FlagThreads),
-		Iter:     newIter(files, to, caption, opts.Chat, opts.Thread, opts.Photo, opts.Gdrive, opts.Remove, viper.GetDuration(consts.FlagDelay), manager),
-		Progress: newProgress(upProgress),
+		Iter:     it,
+		Progress: progress,
 	}
 
 	up := uploader.New(options)
 
 	go upProgress.Render()
-	defer prog.Wait(ctx, upProgress)
+	defer func() {
+		prog.Wait(ctx, upProgress)
+		if it.Skipped() > 0 {
+			color.Yellow("Skipped %d files which already exist in destination", it.Skipped())
+		}
+	}()
 
-	return up.Upload(ctx, viper.GetInt(consts.FlagLimit))
+	return up.Upload(ctx, limit)
 }
 
 func resolveDest(ctx context.Context, manager *peers.Manager, input string) (*vm.Program, error) {
 	compile := func(i string) (*vm.Program, error) {
-		return expr.Compile(i, expr.Env(exprEnv(ctx, nil)))
+		return expr.Compile(i, expr.Env(exprEnv(ctx, nil, false)))
 	}
 
 	if input == "" {
@@ -131,7 +282,7 @@ func resolveDest(ctx context.Context, manager *peers.Manager, input string) (*vm
 func resolveCaption(ctx context.Context, input string) (*vm.Program, error) {
 	compile := func(i string) (*vm.Program, error) {
 		// we pass empty peer and message to enable type checking
-		return expr.Compile(i, expr.Env(exprEnv(ctx, nil)), expr.AsKind(reflect.String))
+		return expr.Compile(i, expr.Env(exprEnv(ctx, nil, false)), expr.AsKind(reflect.String))
 	}
 
 	// default
@@ -148,24 +299,134 @@ func resolveCaption(ctx context.Context, input string) (*vm.Program, error) {
 	return compile(input)
 }
 
-func exprEnv(ctx context.Context, file *File) Env {
+// scheduler returns the time to post the n-th message, zero means posting immediately
+type scheduler func(env Env, n int) (time.Time, error)
+
+// resolveSchedule returns the scheduler of input, and the compiled program if input is an expression
+func resolveSchedule(ctx context.Context, input string) (scheduler, *vm.Program, error) {
+	if input == "" {
+		return nil, nil, nil
+	}
+
+	// absolute time or spacing spec
+	spacing, err := schedule.Parse(input, time.Now())
+	if err == nil {
+		return func(_ Env, n int) (time.Time, error) {
+			return spacing.At(n), nil
+		}, nil, nil
+	}
+	if schedule.Like(input) {
+		return nil, nil, errors.Wrap(err, "parse schedule")
+	}
+
+	// file or expression
+	if exp, err := os.ReadFile(input); err == nil {
+		input = string(exp)
+	}
+
+	program, err := expr.Compile(input, expr.Env(exprEnv(ctx, nil, false)))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "compile expression")
+	}
+
+	return func(env Env, _ int) (time.Time, error) {
+		result, err := texpr.Run(program, env)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "run expression")
+		}
+
+		switch r := result.(type) {
+		case time.Time:
+			return r, nil
+		case string:
+			if r == "" {
+				return time.Time{}, nil
+			}
+			return schedule.ParseTime(r, time.Now())
+		case int:
+			if r == 0 {
+				return time.Time{}, nil
+			}
+			return time.Unix(int64(r), 0), nil
+		default:
+			return time.Time{}, errors.Errorf("schedule expression must return time, string or unix timestamp: %T", result)
+		}
+	}, program, nil
+}
+
+func resolveMedia(ctx context.Context, input string) (*vm.Program, error) {
+	if input == "" {
+		return nil, nil
+	}
+
+	compile := func(i string) (*vm.Program, error) {
+		return expr.Compile(i, expr.Env(exprEnv(ctx, nil, false)))
+	}
+
+	// media type
+	if _, err := uploader.ParseMediaType(input); err == nil {
+		return compile(strconv.Quote(input))
+	}
+
+	// file
+	if exp, err := os.ReadFile(input); err == nil {
+		return compile(string(exp))
+	}
+
+	// expression
+	return compile(input)
+}
+
+// exprEnv returns the env of file for expressions, EXIF and Video are filled only if probe is set
+func exprEnv(ctx context.Context, file *File, probe bool) Env {
 	if file == nil {
 		return Env{}
 	}
 
-	extension := filepath.Ext(file.File)
-	filename := strings.TrimSuffix(filepath.Base(file.File), extension)
-	mime, err := mimetype.DetectFile(file.File)
-	if err != nil {
-		mime = &mimetype.MIME{}
-		logctx.From(ctx).Error("detect file mime", zap.Error(err))
+	name := file.Name
+	if name == "" {
+		name = filepath.Base(file.File)
 	}
+	extension := filepath.Ext(name)
+	filename := strings.TrimSuffix(name, extension)
 
-	return Env{
+	env := Env{
 		FilePath:  file.File,
 		FileName:  filename,
 		FileExt:   extension,
+		FileSize:  -1,
 		ThumbPath: file.Thumb,
-		MIME:      mime.String(),
+		MIME:      detectMIME(ctx, file.File, extension),
+	}
+	env.Dir, env.Dirs = relDirs(file)
+
+	if isLocal(file.File) {
+		if stat, err := os.Stat(file.File); err == nil {
+			env.FileSize = stat.Size()
+			env.ModTime = stat.ModTime().Unix()
+		}
+		if probe {
+			env.EXIF, env.Video = probeMedia(ctx, file.File, env.MIME)
+		}
+	}
+	if file.Part != nil {
+		env.FileSize = file.Part.Length
+	}
+
+	return env
+}
+
+// detectMIME detects MIME by content for local files, and by extension for streams
+// which can't be read twice.
+func detectMIME(ctx context.Context, path, ext string) string {
+	if !isLocal(path) {
+		return mime.TypeByExtension(ext)
+	}
+
+	m, err := mimetype.DetectFile(path)
+	if err != nil {
+		logctx.From(ctx).Error("detect file mime", zap.Error(err))
+		return ""
 	}
+	return m.String()
 }
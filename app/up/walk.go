@@ -2,22 +2,71 @@ package up
 
 import (
 	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/go-faster/errors"
+
 	"github.com/iyear/tdl/core/util/fsutil"
 	"github.com/iyear/tdl/pkg/consts"
 	"github.com/iyear/tdl/pkg/filterMap"
 )
 
-func walk(paths, includes, excludes []string) ([]*File, error) {
+func walk(paths, includes, excludes []string, name string) ([]*File, error) {
 	files := make([]*File, 0)
 
 	includesMap := filterMap.New(includes, fsutil.AddPrefixDot)
 	excludesMap := filterMap.New(excludes, fsutil.AddPrefixDot)
 	excludesMap[consts.UploadThumbExt] = struct{}{} // ignore thumbnail files
 
+	filter := func(path string) bool {
+		ext := filepath.Ext(path)
+		if _, ok := includesMap[ext]; len(includesMap) > 0 && !ok {
+			return false
+		}
+		if _, ok := excludesMap[ext]; len(excludesMap) > 0 && ok {
+			return false
+		}
+		return true
+	}
+
 	for _, path := range paths {
+		switch {
+		case path == stdinPath:
+			if name == "" {
+				return nil, errors.New("file name must be specified by --name when uploading from stdin")
+			}
+			files = append(files, &File{File: path, Name: name})
+			continue
+		case isURL(path):
+			f := &File{File: path, Name: name}
+			if f.Name == "" {
+				f.Name = urlName(path)
+			}
+			files = append(files, f)
+			continue
+		}
+
+		if archive, inner, ok := splitArchive(path); ok {
+			entries, err := walkArchive(archive, inner)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range entries {
+				if filter(entry) {
+					files = append(files, &File{File: entry, Root: archive + archiveSep})
+				}
+			}
+			continue
+		}
+
+		root := path
+		if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+			root = filepath.Dir(path)
+		}
+
 		err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
@@ -27,15 +76,11 @@ func walk(paths, includes, excludes []string) ([]*File, error) {
 			}
 
 			// process include and exclude
-			ext := filepath.Ext(path)
-			if _, ok := includesMap[ext]; len(includesMap) > 0 && !ok {
-				return nil
-			}
-			if _, ok := excludesMap[ext]; len(excludesMap) > 0 && ok {
+			if !filter(path) {
 				return nil
 			}
 
-			f := File{File: path}
+			f := File{File: path, Root: root}
 			t := strings.TrimRight(path, filepath.Ext(path)) + consts.UploadThumbExt
 			if fsutil.PathExists(t) {
 				f.Thumb = t
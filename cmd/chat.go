@@ -4,17 +4,20 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gotd/contrib/middleware/ratelimit"
 	"github.com/gotd/td/telegram"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"golang.org/x/time/rate"
 
 	"github.com/iyear/tdl/app/chat"
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/consts"
 )
 
 var limiter = ratelimit.New(rate.Every(500*time.Millisecond), 2)
@@ -26,7 +29,7 @@ func NewChat() *cobra.Command {
 		GroupID: groupTools.ID,
 	}
 
-	cmd.AddCommand(NewChatList(), NewChatExport(), NewChatUsers())
+	cmd.AddCommand(NewChatList(), NewChatExport(), NewChatUsers(), NewChatLog())
 
 	return cmd
 }
@@ -50,6 +53,14 @@ func NewChatList() *cobra.Command {
 	return cmd
 }
 
+// formatExt is the default extension of transcript and analytics formats
+var formatExt = map[chat.ExportFormat]string{
+	chat.ExportFormatHtml:     ".html",
+	chat.ExportFormatMarkdown: ".md",
+	chat.ExportFormatCsv:      ".csv",
+	chat.ExportFormatJsonl:    ".jsonl",
+}
+
 func NewChatExport() *cobra.Command {
 	var opts chat.ExportOptions
 
@@ -83,6 +94,24 @@ func NewChatExport() *cobra.Command {
 				return fmt.Errorf("unknown export type: %s", opts.Type)
 			}
 
+			if ext, ok := formatExt[opts.Format]; ok && !cmd.Flags().Changed("output") {
+				opts.Output = strings.TrimSuffix(opts.Output, filepath.Ext(opts.Output)) + ext
+			}
+			switch opts.Format {
+			case chat.ExportFormatHtml, chat.ExportFormatMarkdown:
+				// media files are linked with the same name as download
+				if opts.Template == "" {
+					opts.Template = viper.GetString(consts.FlagDlTemplate)
+				}
+			}
+			if opts.Incremental && (opts.Format == chat.ExportFormatCsv || opts.Format == chat.ExportFormatJsonl) {
+				// each snapshot of analytics should contain all messages in range
+				return fmt.Errorf("'incremental' flag can't be used with %s format", opts.Format)
+			}
+			if opts.WithSender && opts.Format != chat.ExportFormatMinimal && opts.Format != chat.ExportFormatArchive {
+				return fmt.Errorf("'with-sender' flag can't be used with %s format", opts.Format)
+			}
+
 			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
 				return chat.Export(logctx.Named(ctx, "export"), c, kvd, opts)
 			}, limiter)
@@ -96,6 +125,7 @@ func NewChatExport() *cobra.Command {
 	)
 
 	cmd.Flags().VarP(&opts.Type, _type, "T", fmt.Sprintf("export type: [%s]", strings.Join(chat.ExportTypeNames(), ", ")))
+	cmd.Flags().Var(&opts.Format, "format", fmt.Sprintf("export format: [%s]. archive is compatible with result.json of Telegram Desktop, html and markdown are readable transcripts, csv and jsonl are statistics of messages appended as time series", strings.Join(chat.ExportFormatNames(), ", ")))
 	cmd.Flags().StringVarP(&opts.Chat, _chat, "c", "", "chat id or domain. If not specified, 'Saved Messages' will be used")
 
 	// topic id and message id is the same field in tg.MessagesGetRepliesRequest
@@ -104,10 +134,14 @@ func NewChatExport() *cobra.Command {
 
 	cmd.Flags().IntSliceVarP(&opts.Input, input, "i", []int{}, "input data, depends on export type")
 	cmd.Flags().StringVarP(&opts.Filter, "filter", "f", "true", "filter messages by expression, defaults to match all messages. Specify '-' to see available fields")
-	cmd.Flags().StringVarP(&opts.Output, "output", "o", "tdl-export.json", "output JSON file path")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", "tdl-export.json", "output file path, extension is changed by html, markdown, csv and jsonl format if not specified")
+	cmd.Flags().StringVar(&opts.Template, "template", "", "file name template of downloaded media which is linked in html and markdown transcript, default is the template of download")
+	cmd.Flags().StringVar(&opts.MediaDir, "media-dir", "downloads", "directory of downloaded media which is linked in html and markdown transcript, relative to output file")
 	cmd.Flags().BoolVar(&opts.WithContent, "with-content", false, "export with message content")
 	cmd.Flags().BoolVar(&opts.Raw, "raw", false, "export raw message struct of Telegram MTProto API, useful for debugging")
 	cmd.Flags().BoolVar(&opts.All, "all", false, "export all messages including non-media messages, but still affected by filter and type flag")
+	cmd.Flags().BoolVar(&opts.WithSender, "with-sender", false, "export with sender details, including id, username, display name and bot flag. Only for minimal and archive format")
+	cmd.Flags().BoolVar(&opts.Incremental, "incremental", false, "only export messages newer than the last incremental export of the chat, existing output file is rotated. Not for csv and jsonl format")
 
 	// completion and validation
 	_ = cmd.RegisterFlagCompletionFunc(input, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -149,3 +183,25 @@ func NewChatUsers() *cobra.Command {
 	cmd.Flags().BoolVar(&opts.Raw, "raw", false, "export raw message struct of Telegram MTProto API, useful for debugging")
 	return cmd
 }
+
+func NewChatLog() *cobra.Command {
+	var opts chat.AdminLogOptions
+
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "export admin log events from channels and groups, such as joins, leaves, bans and edits",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+				return chat.AdminLog(logctx.Named(ctx, "log"), c, kvd, opts)
+			}, limiter)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", "tdl-log.json", "output JSON file path")
+	cmd.Flags().StringVarP(&opts.Chat, "chat", "c", "", "domain id (channels, supergroups, etc.)")
+	cmd.Flags().StringSliceVar(&opts.Events, "event", []string{}, fmt.Sprintf("only export events of types, defaults to all events: [%s]", strings.Join(chat.AdminLogEventNames(), ", ")))
+	cmd.Flags().StringSliceVar(&opts.Admins, "admin", []string{}, "only export events performed by admins, defaults to all admins")
+	cmd.Flags().StringVarP(&opts.Query, "query", "q", "", "search query of events")
+	cmd.Flags().BoolVar(&opts.Raw, "raw", false, "export raw action struct of Telegram MTProto API, useful for debugging")
+	return cmd
+}
@@ -65,6 +65,11 @@ func NewDownload() *cobra.Command {
 	cmd.Flags().BoolVar(&opts.Continue, _continue, false, "continue the last download directly")
 	cmd.Flags().BoolVar(&opts.Restart, restart, false, "restart the last download directly")
 
+	// decryption flags
+	cmd.Flags().BoolVar(&opts.Decrypt, "decrypt", false, "decrypt files uploaded by 'tdl upload --encrypt' and restore their original names")
+	cmd.Flags().StringVar(&opts.KeyFile, "key-file", "", "file whose content is used as decryption secret")
+	cmd.Flags().StringVar(&opts.Passphrase, "passphrase", "", "passphrase used as decryption secret, ask for it if both --key-file and --passphrase are empty")
+
 	// serve flags
 	cmd.Flags().BoolVar(&opts.Serve, "serve", false, "serve the media files as a http server instead of downloading them with built-in downloader")
 	cmd.Flags().IntVar(&opts.Port, "port", 8080, "http server port")
@@ -76,6 +81,7 @@ func NewDownload() *cobra.Command {
 	_ = cmd.MarkFlagDirname(dir)
 	cmd.MarkFlagsMutuallyExclusive(include, exclude)
 	cmd.MarkFlagsMutuallyExclusive(_continue, restart)
+	cmd.MarkFlagsMutuallyExclusive("key-file", "passphrase")
 
 	return cmd
 }
@@ -7,11 +7,13 @@ import (
 
 	"github.com/gotd/td/telegram"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/iyear/tdl/app/forward"
 	"github.com/iyear/tdl/core/forwarder"
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/consts"
 )
 
 func NewForward() *cobra.Command {
@@ -22,20 +24,96 @@ func NewForward() *cobra.Command {
 		Short:   "Forward messages with automatic fallback and message routing",
 		GroupID: groupTools.ID,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.MirrorDelete && !opts.Follow {
+				return fmt.Errorf("'mirror-delete' flag requires 'follow' flag")
+			}
+			if cmd.Flags().Changed("plan") && !opts.DryRun {
+				return fmt.Errorf("'plan' flag requires 'dry-run' flag")
+			}
+			if opts.Follow {
+				// follow mode mirrors new messages only, there is nothing to resume, reverse or plan
+				for _, f := range []struct {
+					name string
+					set  bool
+				}{
+					{"continue", opts.Continue},
+					{"restart", opts.Restart},
+					{"desc", opts.Desc},
+					{"dry-run", opts.DryRun},
+					{"plan", cmd.Flags().Changed("plan")},
+				} {
+					if f.set {
+						return fmt.Errorf("'follow' flag can't be used with '%s' flag", f.name)
+					}
+				}
+			}
+
+			fromNS, toNS := opts.FromNS, opts.ToNS
+			if fromNS == "" {
+				fromNS = viper.GetString(consts.FlagNamespace)
+			}
+			if toNS == "" {
+				toNS = viper.GetString(consts.FlagNamespace)
+			}
+
+			if fromNS != toNS {
+				if opts.Follow {
+					return fmt.Errorf("'follow' flag can't be used with different 'from-ns' and 'to-ns'")
+				}
+
+				// read with one account and send with another
+				return tRunNS(cmd.Context(), fromNS, func(ctx context.Context, fc *telegram.Client, fkvd storage.Storage) error {
+					return tRunNS(ctx, toNS, func(ctx context.Context, tc *telegram.Client, tkvd storage.Storage) error {
+						return forward.RunWith(logctx.Named(ctx, "forward"),
+							forward.Account{Client: fc, KV: fkvd},
+							forward.Account{Client: tc, KV: tkvd},
+							opts)
+					})
+				})
+			}
+
+			if opts.Follow {
+				var u *forward.Updates
+				return tRunWithUpdates(cmd.Context(), func(kvd storage.Storage) telegram.UpdateHandler {
+					u = forward.NewUpdates(cmd.Context(), kvd)
+					return u
+				}, func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+					return forward.Follow(logctx.Named(ctx, "forward"), c, kvd, u, opts)
+				})
+			}
+
 			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
 				return forward.Run(logctx.Named(ctx, "forward"), c, kvd, opts)
 			})
 		},
 	}
 
-	cmd.Flags().StringArrayVar(&opts.From, "from", []string{}, "messages to be forwarded, can be links or exported JSON files")
+	cmd.Flags().StringArrayVar(&opts.From, "from", []string{}, "messages to be forwarded, can be links, exported JSON files or chat queries, or chats in follow mode")
 	cmd.Flags().StringVar(&opts.To, "to", "", "destination peer, can be a CHAT or router based on expression engine")
-	cmd.Flags().StringVar(&opts.Edit, "edit", "", "edit message or caption with expression engine. Empty means no edit")
+	cmd.Flags().StringVar(&opts.Edit, "edit", "", "edit message with expression engine, which returns text, transform or nil to skip. Empty means no edit")
 	cmd.Flags().Var(&opts.Mode, "mode", fmt.Sprintf("forward mode: [%s]", strings.Join(forwarder.ModeNames(), ", ")))
 	cmd.Flags().BoolVar(&opts.Silent, "silent", false, "send messages silently")
 	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "do not actually send messages, just show how they would be sent")
+	cmd.Flags().Var(&opts.Plan, "plan", fmt.Sprintf("output format of dry run plan: [%s], requires --dry-run flag", strings.Join(forward.PlanOutputNames(), ", ")))
 	cmd.Flags().BoolVar(&opts.Single, "single", false, "do not automatically detect and forward grouped messages")
 	cmd.Flags().BoolVar(&opts.Desc, "desc", false, "forward messages in reverse order for each input peer")
+	cmd.Flags().StringVar(&opts.FromNS, "from-ns", "", "namespace of the account which reads source messages, default is the global namespace")
+	cmd.Flags().StringVar(&opts.ToNS, "to-ns", "", "namespace of the account which sends messages, default is the global namespace")
+	cmd.Flags().BoolVar(&opts.PersistMap, "persist-map", false, "persist source to destination message ids, so that replies to messages forwarded in previous runs are preserved")
+
+	const (
+		_continue = "continue"
+		restart   = "restart"
+	)
+	// resume flags, if both false then ask user
+	cmd.Flags().BoolVar(&opts.Continue, _continue, false, "continue the last forward directly")
+	cmd.Flags().BoolVar(&opts.Restart, restart, false, "restart the last forward directly")
+
+	cmd.MarkFlagsMutuallyExclusive(_continue, restart)
+
+	// follow flags
+	cmd.Flags().BoolVar(&opts.Follow, "follow", false, "keep running and mirror new messages of source chats as they arrive, '--from' should be chats")
+	cmd.Flags().BoolVar(&opts.MirrorDelete, "mirror-delete", false, "delete mirrored copies when source messages are deleted in follow mode")
 
 	return cmd
 }
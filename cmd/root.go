@@ -138,7 +138,7 @@ func New() *cobra.Command {
 	cmd.AddGroup(groupAccount, groupTools, groupExtensions)
 
 	cmd.AddCommand(NewVersion(), NewLogin(), NewDownload(), NewForward(),
-		NewChat(), NewUpload(), NewBackup(), NewRecover(), NewMigrate(),
+		NewChat(), NewUpload(), NewSync(), NewBackup(), NewRecover(), NewMigrate(),
 		NewGen(), NewExtension(em))
 
 	// append extension command to root
@@ -213,8 +213,12 @@ func completeExtFiles(ext ...string) completeFunc {
 }
 
 func tOptions(ctx context.Context) (tclient.Options, error) {
+	return tOptionsNS(ctx, viper.GetString(consts.FlagNamespace))
+}
+
+func tOptionsNS(ctx context.Context, ns string) (tclient.Options, error) {
 	// init tclient kv
-	kvd, err := kv.From(ctx).Open(viper.GetString(consts.FlagNamespace))
+	kvd, err := kv.From(ctx).Open(ns)
 	if err != nil {
 		return tclient.Options{}, errors.Wrap(err, "open kv storage")
 	}
@@ -230,11 +234,33 @@ func tOptions(ctx context.Context) (tclient.Options, error) {
 }
 
 func tRun(ctx context.Context, f func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error, middlewares ...telegram.Middleware) error {
+	return tRunWithUpdates(ctx, nil, f, middlewares...)
+}
+
+// tRunWithUpdates is like tRun, but updates received by the client are passed to the handler built with kv storage
+func tRunWithUpdates(ctx context.Context, handler func(kvd storage.Storage) telegram.UpdateHandler, f func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error, middlewares ...telegram.Middleware) error {
 	o, err := tOptions(ctx)
 	if err != nil {
 		return errors.Wrap(err, "build telegram options")
 	}
+	if handler != nil {
+		o.UpdateHandler = handler(o.KV)
+	}
+
+	return runClient(ctx, o, f, middlewares...)
+}
+
+// tRunNS is like tRun, but the client uses session of the specified namespace
+func tRunNS(ctx context.Context, ns string, f func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error, middlewares ...telegram.Middleware) error {
+	o, err := tOptionsNS(ctx, ns)
+	if err != nil {
+		return errors.Wrap(err, "build telegram options")
+	}
+
+	return runClient(ctx, o, f, middlewares...)
+}
 
+func runClient(ctx context.Context, o tclient.Options, f func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error, middlewares ...telegram.Middleware) error {
 	client, err := tclient.New(ctx, o, false, middlewares...)
 	if err != nil {
 		return errors.Wrap(err, "create client")
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/spf13/cobra"
+
+	"github.com/iyear/tdl/app/up"
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+)
+
+func NewSync() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "sync",
+		Short:   "Mirror local directories to Telegram",
+		GroupID: groupTools.ID,
+	}
+
+	cmd.AddCommand(NewSyncPush())
+
+	return cmd
+}
+
+func NewSyncPush() *cobra.Command {
+	var opts up.SyncOptions
+
+	cmd := &cobra.Command{
+		Use:   "push <dir>",
+		Short: "Upload new or changed files in the directory, and skip unchanged ones",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Dir = args[0]
+
+			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+				if opts.Structure == up.SyncStructureTopic && opts.Chat == "" {
+					return errors.New("error flags: --chat should be set when --structure is topic")
+				}
+				if opts.Thread != 0 && opts.Chat == "" {
+					return errors.New("error flags: --chat should be set when --topic is set")
+				}
+				return up.SyncPush(logctx.Named(ctx, "sync"), c, kvd, opts)
+			})
+		},
+	}
+
+	const (
+		include = "include"
+		exclude = "exclude"
+	)
+	cmd.Flags().StringVarP(&opts.Chat, "chat", "c", "", "chat id or domain, and empty means 'Saved Messages'")
+	cmd.Flags().IntVar(&opts.Thread, "topic", 0, "specify topic id. Must be used together with --chat flag")
+	cmd.Flags().StringSliceVarP(&opts.Includes, include, "i", []string{}, "include the specified file extensions")
+	cmd.Flags().StringSliceVarP(&opts.Excludes, exclude, "e", []string{}, "exclude the specified file extensions")
+	cmd.Flags().StringVar(&opts.Caption, "caption", `"<code>"+FileName+"</code> - <code>"+MIME+"</code>"`, "caption for the uploaded media")
+	cmd.Flags().BoolVar(&opts.Photo, "photo", false, "upload the image as a photo instead of a file")
+	cmd.Flags().Var(&opts.Structure, "structure", fmt.Sprintf("how to preserve folder structure: [%s]. 'caption' prepends relative path to caption, 'topic' uploads each folder to a forum topic", strings.Join(up.SyncStructureNames(), ", ")))
+	cmd.Flags().BoolVar(&opts.Delete, "delete", false, "delete messages of files which are removed or replaced locally")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "only print files to be uploaded and removed")
+
+	cmd.MarkFlagsMutuallyExclusive(include, exclude)
+
+	return cmd
+}
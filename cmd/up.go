@@ -2,18 +2,26 @@ package cmd
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/spf13/cobra"
 
 	"github.com/iyear/tdl/app/up"
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/pkg/crypt"
+	"github.com/iyear/tdl/pkg/utils"
 )
 
 func NewUpload() *cobra.Command {
-	var opts up.Options
+	var (
+		opts      up.Options
+		splitSize string
+	)
 
 	cmd := &cobra.Command{
 		Use:     "upload",
@@ -28,31 +36,90 @@ func NewUpload() *cobra.Command {
 				if opts.Chat != "" && opts.To != "" {
 					return errors.New("conflicting flags: --chat and --to cannot be set at the same time")
 				}
+				if !opts.Encrypt && (opts.EncryptName || opts.KeyFile != "" || opts.Passphrase != "") {
+					return errors.New("error flags: --encrypt should be set when encryption flags are set")
+				}
+				if (opts.Continue || opts.Restart) && opts.Manifest == "" {
+					return errors.New("error flags: --manifest should be set when --continue or --restart is set")
+				}
+				if (opts.SkipHash || opts.SkipDepth != 0) && !opts.SkipExisting {
+					return errors.New("error flags: --skip-existing should be set when --skip-hash or --skip-existing-depth is set")
+				}
+				if splitSize != "" {
+					size, err := utils.Byte.ParseBinaryBytes(splitSize)
+					if err != nil {
+						return errors.Wrap(err, "parse --split-size")
+					}
+					opts.SplitSize = size
+
+					self, err := c.Self(ctx)
+					if err != nil {
+						return errors.Wrap(err, "get self")
+					}
+					limit := uploader.MaxFileSize(self.Premium)
+					if opts.Encrypt { // leave room for encryption header and tags
+						limit = crypt.MaxPlainSize(limit)
+					}
+					if size <= 0 || size > limit {
+						return errors.Errorf("error flags: --split-size should be positive and not larger than %s", utils.Byte.FormatBinaryBytes(limit))
+					}
+				}
 				return up.Run(logctx.Named(ctx, "up"), c, kvd, opts)
 			})
 		},
 	}
 
 	const (
-		_chat   = "chat"
-		path    = "path"
-		include = "include"
-		exclude = "exclude"
+		_chat     = "chat"
+		path      = "path"
+		manifest  = "manifest"
+		include   = "include"
+		exclude   = "exclude"
+		_continue = "continue"
+		restart   = "restart"
 	)
 	cmd.Flags().StringVarP(&opts.Chat, _chat, "c", "", "chat id or domain, and empty means 'Saved Messages'. Can be used together with --topic flag. Conflicts with --to flag.")
 	cmd.Flags().IntVar(&opts.Thread, "topic", 0, "specify topic id. Must be used together with --chat flag. Conflicts with --to flag.")
 	cmd.Flags().StringVar(&opts.To, "to", "", "destination peer, can be a CHAT or router based on expression engine. Conflicts with --chat and --topic flag.")
-	cmd.Flags().StringSliceVarP(&opts.Paths, path, "p", []string{}, "dirs or files")
+	cmd.Flags().StringSliceVarP(&opts.Paths, path, "p", []string{}, "dirs or files. '-' means stdin, 'http(s)://...' means remote file, 'archive.zip!/inner/path' means entries in zip archive")
+	cmd.Flags().StringVar(&opts.Manifest, manifest, "", "JSON Lines file of upload jobs, each line specifies path, destination, caption, thumbnail, etc. Conflicts with --path flag")
+	cmd.Flags().BoolVar(&opts.Continue, _continue, false, "continue the last upload of manifest directly")
+	cmd.Flags().BoolVar(&opts.Restart, restart, false, "restart the last upload of manifest directly")
+	cmd.Flags().StringVar(&opts.Name, "name", "", "file name of stdin or URL sources, required when uploading from stdin")
 	cmd.Flags().StringSliceVarP(&opts.Includes, include, "i", []string{}, "include the specified file extensions")
 	cmd.Flags().StringSliceVarP(&opts.Excludes, exclude, "e", []string{}, "exclude the specified file extensions")
 	cmd.Flags().BoolVar(&opts.Remove, "rm", false, "remove the uploaded files after uploading")
 	cmd.Flags().BoolVar(&opts.Gdrive, "gdrive", false, "upload to google drive after uploading to telegram")
 	cmd.Flags().BoolVar(&opts.Photo, "photo", false, "upload the image as a photo instead of a file")
+	cmd.Flags().StringVar(&opts.Media, "media", "", fmt.Sprintf("media type: [%s], or expression which returns type name or {Type, Spoiler} per file. Empty means detecting by MIME. Specify '-' to see available fields", strings.Join(uploader.MediaTypeNames(), ", ")))
+	cmd.Flags().BoolVar(&opts.Spoiler, "spoiler", false, "hide photos, videos and animations under a spoiler")
+	cmd.Flags().StringVar(&splitSize, "split-size", "", "split files larger than this size into numbered parts, e.g. 1.9GB, and it can't be larger than the maximum file size of the account. Parts are reassembled by 'tdl download'")
+	cmd.Flags().BoolVar(&opts.SkipExisting, "skip-existing", false, "skip files whose name and size match a document in the destination chat")
+	cmd.Flags().IntVar(&opts.SkipDepth, "skip-existing-depth", 0, "number of latest messages in the destination chat indexed by --skip-existing, 0 means the whole history")
+	cmd.Flags().BoolVar(&opts.SkipHash, "skip-hash", false, "also skip files whose SHA-256 is recorded by previous uploads to the destination chat. Must be used together with --skip-existing flag")
+	cmd.Flags().BoolVar(&opts.Encrypt, "encrypt", false, "encrypt files with AES-256-GCM before uploading. Restore them by 'tdl download --decrypt'")
+	cmd.Flags().BoolVar(&opts.EncryptName, "encrypt-name", false, "upload encrypted files with random names, the original names are stored in encrypted header")
+	cmd.Flags().StringVar(&opts.KeyFile, "key-file", "", "file whose content is used as encryption secret")
+	cmd.Flags().StringVar(&opts.Passphrase, "passphrase", "", "passphrase used as encryption secret, ask for it if both --key-file and --passphrase are empty")
+	cmd.Flags().StringVar(&opts.Schedule, "schedule", "", "post messages later. Absolute time like '2024-01-02 09:00', spacing like 'every 30m from 09:00', or expression which returns time, string or unix timestamp. Specify '-' to see available fields")
+	cmd.Flags().BoolVar(&opts.Pin, "pin", false, "pin each sent message silently")
+	cmd.Flags().BoolVar(&opts.ReplyChain, "reply-chain", false, "reply each next upload to the previous one in the same chat, which forces sequential uploads")
+	cmd.Flags().StringVar(&opts.React, "react", "", "add the emoji reaction to each sent message, e.g. 👍")
+	cmd.Flags().StringVar(&opts.OnSent, "on-sent", "", "shell command run after each message is sent, with TDL_FILE, TDL_CHAT, TDL_MESSAGE, TDL_LINK and TDL_SCHEDULED environment variables")
+	cmd.Flags().StringVar(&opts.OnSentExpr, "on-sent-expr", "", "expression which returns the shell command run after each message is sent, empty result means skipping. Specify '-' to see available fields")
+	cmd.Flags().StringVar(&opts.LinkFile, "link-file", "", "append local path and message link of each sent message to the JSON Lines file")
 	cmd.Flags().StringVar(&opts.Caption, "caption", `"<code>"+FileName+"</code> - <code>"+MIME+"</code>"`, "caption for the uploaded media")
 
 	// completion and validation
-	_ = cmd.MarkFlagRequired(path)
+	cmd.MarkFlagsOneRequired(path, manifest)
+	cmd.MarkFlagsMutuallyExclusive(path, manifest)
 	cmd.MarkFlagsMutuallyExclusive(include, exclude)
+	cmd.MarkFlagsMutuallyExclusive(_continue, restart)
+	cmd.MarkFlagsMutuallyExclusive("pin", "schedule")
+	cmd.MarkFlagsMutuallyExclusive("react", "schedule")
+	cmd.MarkFlagsMutuallyExclusive("reply-chain", "schedule")
+	cmd.MarkFlagsMutuallyExclusive("on-sent", "on-sent-expr")
+	cmd.MarkFlagsMutuallyExclusive("key-file", "passphrase")
 
 	return cmd
 }
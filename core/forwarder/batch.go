@@ -0,0 +1,170 @@
+package forwarder
+
+import (
+	"context"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// MaxBatchSize is the max count of message ids in one messages.forwardMessages request
+const MaxBatchSize = 100
+
+type batchItem struct {
+	elem    Elem
+	grouped []*tg.Message
+}
+
+// batch collects consecutive direct forwards with the same route,
+// so that they can be forwarded by one request in order.
+type batch struct {
+	items []batchItem
+	size  int
+}
+
+type batchKey struct {
+	from, to int64
+	thread   int
+	silent   bool
+	dryRun   bool
+}
+
+func newBatchKey(elem Elem) batchKey {
+	return batchKey{
+		from:   elem.From().ID(),
+		to:     elem.To().ID(),
+		thread: elem.Thread(),
+		silent: elem.AsSilent(),
+		dryRun: elem.AsDryRun(),
+	}
+}
+
+// batchable reports whether the element can be forwarded by server-side batch
+func batchable(elem Elem) bool {
+	return elem.Mode() == ModeDirect && !protectedDialog(elem.From()) && !protectedMessage(elem.Msg())
+}
+
+func itemSize(grouped []*tg.Message) int {
+	if len(grouped) > 0 {
+		return len(grouped)
+	}
+	return 1
+}
+
+// fits reports whether the element can be appended to the batch.
+// grouped messages are never split, so that they are still an album in destination.
+func (b *batch) fits(elem Elem, grouped []*tg.Message) bool {
+	if len(b.items) == 0 {
+		return true
+	}
+
+	return newBatchKey(b.items[0].elem) == newBatchKey(elem) &&
+		b.size+itemSize(grouped) <= MaxBatchSize
+}
+
+func (b *batch) add(elem Elem, grouped []*tg.Message) {
+	b.items = append(b.items, batchItem{elem: elem, grouped: grouped})
+	b.size += itemSize(grouped)
+}
+
+func (b *batch) ids() []int {
+	ids := make([]int, 0, b.size)
+	for _, item := range b.items {
+		if len(item.grouped) == 0 {
+			ids = append(ids, item.elem.Msg().ID)
+			continue
+		}
+		for _, m := range item.grouped {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+func (b *batch) reset() {
+	b.items = nil
+	b.size = 0
+}
+
+// flush forwards all collected messages by one request. If the request fails,
+// each message falls back to clone mode.
+func (f *Forwarder) flush(ctx context.Context, b *batch) error {
+	if len(b.items) == 0 {
+		return nil
+	}
+	items := b.items
+	ids := b.ids()
+	b.reset()
+
+	sent, err := f.forwardBatch(ctx, items[0].elem, ids)
+	if err == nil {
+		for _, item := range items {
+			f.onSent(ctx, item.elem, sent, item.grouped...)
+			f.onPlan(item.elem, Plan{Mode: ModeDirect}, item.grouped...)
+			f.opts.Progress.OnDone(item.elem, nil)
+		}
+		return nil
+	}
+
+	if errors.Is(err, context.Canceled) {
+		for _, item := range items {
+			f.opts.Progress.OnDone(item.elem, err)
+		}
+		return err
+	}
+
+	logctx.From(ctx).Warn("Batch forward failed, fallback to clone",
+		zap.Int64("from", items[0].elem.From().ID()),
+		zap.Int64("to", items[0].elem.To().ID()),
+		zap.Int("messages", len(ids)),
+		zap.Error(err))
+
+	for _, item := range items {
+		if err := f.forwardMessage(ctx, item.elem, ModeClone, item.grouped...); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// forwardBatch forwards messages by one request, and returns destination ids of them
+func (f *Forwarder) forwardBatch(ctx context.Context, elem Elem, ids []int) (map[int]int, error) {
+	randIDs := make([]int64, 0, len(ids))
+	srcIDs := make(map[int64]int, len(ids))
+	for _, id := range ids {
+		randID := f.rand.Int63()
+		randIDs = append(randIDs, randID)
+		srcIDs[randID] = id
+	}
+
+	req := &tg.MessagesForwardMessagesRequest{
+		Silent:            elem.AsSilent(),
+		Background:        false,
+		WithMyScore:       false,
+		DropAuthor:        false,
+		DropMediaCaptions: false,
+		Noforwards:        false,
+		FromPeer:          elem.From().InputPeer(),
+		ID:                ids,
+		RandomID:          randIDs,
+		ToPeer:            elem.To().InputPeer(),
+		TopMsgID:          elem.Thread(),
+		ScheduleDate:      0,
+		SendAs:            nil,
+	}
+	req.SetFlags()
+	updates, err := f.forwardClient(ctx, elem).MessagesForwardMessages(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "batch forward")
+	}
+
+	sent := make(map[int]int, len(ids))
+	collectSent(sent, updates, srcIDs)
+	return sent, nil
+}
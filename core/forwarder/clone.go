@@ -3,7 +3,6 @@ package forwarder
 import (
 	"context"
 	"io"
-	"os"
 
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram/downloader"
@@ -11,6 +10,7 @@ import (
 	"github.com/gotd/td/tg"
 	"go.uber.org/atomic"
 	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
 
 	tdownloader "github.com/iyear/tdl/core/downloader"
 	"github.com/iyear/tdl/core/tmedia"
@@ -37,46 +37,52 @@ func (f *Forwarder) cloneMedia(ctx context.Context, opts cloneOptions, dryRun bo
 		return &tg.InputFile{}, nil
 	}
 
-	temp, err := os.CreateTemp("", "tdl_*")
-	if err != nil {
-		return nil, errors.Wrap(err, "create temp file")
-	}
-	defer func() {
-		multierr.AppendInto(&rerr, temp.Close())
-		multierr.AppendInto(&rerr, os.Remove(temp.Name()))
-	}()
-
 	threads := tutil.BestThreads(opts.media.Size, f.opts.Threads)
 
-	_, err = downloader.NewDownloader().
-		WithPartSize(tdownloader.MaxPartSize).
-		Download(f.opts.Pool.Client(ctx, opts.media.DC), opts.media.InputFileLoc).
-		WithThreads(threads).
-		Parallel(ctx, writeAt{
-			f:    temp,
-			opts: opts,
-		})
-	if err != nil {
-		return nil, errors.Wrap(err, "download")
-	}
+	// stream downloaded parts to uploader directly instead of waiting for the whole file
+	pipe := newPipe(int64(threads) * tdownloader.MaxPartSize * 2)
+	defer multierr.AppendInvoke(&rerr, multierr.Close(pipe))
 
 	var file tg.InputFileClass
 
-	if _, err = temp.Seek(0, io.SeekStart); err != nil {
-		return nil, errors.Wrap(err, "seek")
-	}
-
-	upload := uploader.NewUpload(opts.media.Name, temp, opts.media.Size)
-	file, err = uploader.NewUploader(f.opts.Pool.Default(ctx)).
-		WithPartSize(tuploader.MaxPartSize).
-		WithThreads(threads).
-		WithProgress(uploaded{
-			opts: opts,
-			prev: atomic.NewInt64(0),
-		}).
-		Upload(ctx, upload)
-	if err != nil {
-		return nil, errors.Wrap(err, "upload")
+	wg, wgctx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		_, err := downloader.NewDownloader().
+			WithPartSize(tdownloader.MaxPartSize).
+			Download(f.source().Client(wgctx, opts.media.DC), opts.media.InputFileLoc).
+			WithThreads(threads).
+			Parallel(wgctx, writeAt{
+				f:    pipe,
+				opts: opts,
+			})
+		pipe.CloseWrite(err)
+		if err != nil {
+			return errors.Wrap(err, "download")
+		}
+		return nil
+	})
+	wg.Go(func() error {
+		upload := uploader.NewUpload(opts.media.Name, pipe, opts.media.Size)
+
+		var err error
+		file, err = uploader.NewUploader(f.opts.Pool.Default(wgctx)).
+			WithPartSize(tuploader.MaxPartSize).
+			WithThreads(threads).
+			WithProgress(uploaded{
+				opts: opts,
+				prev: atomic.NewInt64(0),
+			}).
+			Upload(wgctx, upload)
+		if err != nil {
+			// stop writing, downloader will be canceled by context
+			pipe.CloseWrite(err)
+			return errors.Wrap(err, "upload")
+		}
+		return nil
+	})
+
+	if err := wg.Wait(); err != nil {
+		return nil, err
 	}
 
 	return file, nil
@@ -29,6 +29,10 @@ type Options struct {
 	Threads  int
 	Iter     Iter
 	Progress Progress
+	Mapping  Mapping // optional, default is in-memory mapping of current run
+	// Source is the optional pool of another account which reads source messages, default is Pool.
+	// If it's set, messages are always cloned, because the sending account may not access source chats.
+	Source dcpool.Pool
 }
 
 type Forwarder struct {
@@ -43,6 +47,10 @@ type tuple struct {
 }
 
 func New(opts Options) *Forwarder {
+	if opts.Mapping == nil {
+		opts.Mapping = newMemMapping()
+	}
+
 	return &Forwarder{
 		sent: make(map[tuple]struct{}),
 		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
@@ -51,6 +59,8 @@ func New(opts Options) *Forwarder {
 }
 
 func (f *Forwarder) Forward(ctx context.Context) error {
+	b := &batch{}
+
 	for f.opts.Iter.Next(ctx) {
 		elem := f.opts.Iter.Value()
 		if _, ok := f.sent[f.tuple(elem.From(), elem.Msg())]; ok {
@@ -58,20 +68,40 @@ func (f *Forwarder) Forward(ctx context.Context) error {
 			continue
 		}
 
+		var grouped []*tg.Message
 		if _, ok := elem.Msg().GetGroupedID(); ok && elem.AsGrouped() {
-			grouped, err := tutil.GetGroupedMessages(ctx, f.opts.Pool.Default(ctx), elem.From().InputPeer(), elem.Msg())
+			var err error
+			grouped, err = tutil.GetGroupedMessages(ctx, f.source().Default(ctx), elem.From().InputPeer(), elem.Msg())
 			if err != nil {
 				continue
 			}
+		}
 
-			if err = f.forwardMessage(ctx, elem, grouped...); err != nil {
-				continue
+		if f.opts.Source == nil && batchable(elem) {
+			if !b.fits(elem, grouped) {
+				if err := f.flush(ctx, b); err != nil {
+					return err
+				}
 			}
 
+			f.opts.Progress.OnAdd(elem)
+			f.markSent(elem, grouped...)
+			b.add(elem, grouped)
 			continue
 		}
 
-		if err := f.forwardMessage(ctx, elem); err != nil {
+		// keep the order of messages
+		if err := f.flush(ctx, b); err != nil {
+			return err
+		}
+
+		mode := elem.Mode()
+		if f.opts.Source != nil {
+			mode = ModeClone
+		}
+
+		f.opts.Progress.OnAdd(elem)
+		if err := f.forwardMessage(ctx, elem, mode, grouped...); err != nil {
 			// canceled by user, so we directly return error to stop all
 			if errors.Is(err, context.Canceled) {
 				return err
@@ -80,18 +110,83 @@ func (f *Forwarder) Forward(ctx context.Context) error {
 		}
 	}
 
+	if err := f.flush(ctx, b); err != nil {
+		return err
+	}
+
 	return f.opts.Iter.Err()
 }
 
-func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*tg.Message) (rerr error) {
-	f.opts.Progress.OnAdd(elem)
-	defer func() {
-		f.sent[f.tuple(elem.From(), elem.Msg())] = struct{}{}
+func (f *Forwarder) markSent(elem Elem, grouped ...*tg.Message) {
+	f.sent[f.tuple(elem.From(), elem.Msg())] = struct{}{}
+
+	// grouped message also should be marked as sent
+	for _, m := range grouped {
+		f.sent[f.tuple(elem.From(), m)] = struct{}{}
+	}
+}
+
+// onSent records mapping of sent messages and notifies progress with all source messages
+// of the element, sent is the known destination ids
+func (f *Forwarder) onSent(ctx context.Context, elem Elem, sent map[int]int, grouped ...*tg.Message) {
+	msgs := map[int]int{elem.Msg().ID: sent[elem.Msg().ID]}
+	if len(grouped) > 0 {
+		msgs = make(map[int]int, len(grouped))
+		for _, m := range grouped {
+			msgs[m.ID] = sent[m.ID]
+		}
+	}
+
+	for src, dst := range msgs {
+		if dst == 0 {
+			continue
+		}
+		if err := f.opts.Mapping.Set(ctx, elem.From().ID(), src, elem.To().ID(), dst); err != nil {
+			logctx.From(ctx).Warn("Set mapped message",
+				zap.Int64("from", elem.From().ID()),
+				zap.Int("message", src),
+				zap.Error(err))
+		}
+	}
+
+	if p, ok := f.opts.Progress.(ProgressSent); ok {
+		p.OnSent(elem, msgs)
+	}
+}
 
-		// grouped message also should be marked as sent
+// onPlan notifies progress with the decision of dry run
+func (f *Forwarder) onPlan(elem Elem, plan Plan, grouped ...*tg.Message) {
+	p, ok := f.opts.Progress.(ProgressPlan)
+	if !ok || !elem.AsDryRun() {
+		return
+	}
+
+	plan.Messages = []int{elem.Msg().ID}
+	if len(grouped) > 0 {
+		plan.Messages = make([]int, 0, len(grouped))
 		for _, m := range grouped {
-			f.sent[f.tuple(elem.From(), m)] = struct{}{}
+			plan.Messages = append(plan.Messages, m.ID)
+		}
+	}
+	// size is unknown if media can't be got
+	plan.MediaSize, _ = mediaSizeSum(elem.Msg(), grouped...)
+
+	p.OnPlan(elem, plan)
+}
+
+// forwardMessage forwards the element with specified mode, caller should call OnAdd before.
+func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, mode Mode, grouped ...*tg.Message) (rerr error) {
+	// source message id -> destination message id
+	sent := make(map[int]int)
+	// how the element is actually forwarded
+	plan := Plan{Mode: mode}
+	defer func() {
+		f.markSent(elem, grouped...)
+		if rerr == nil {
+			f.onSent(ctx, elem, sent, grouped...)
 		}
+		plan.Err = rerr
+		f.onPlan(elem, plan, grouped...)
 		f.opts.Progress.OnDone(elem, rerr)
 	}()
 
@@ -108,9 +203,11 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 	done := atomic.NewInt64(0)
 
 	forwardTextOnly := func(msg *tg.Message) error {
+		plan.TextOnly = true
 		if msg.Message == "" {
 			return errors.Errorf("empty message content, skip send: %d", msg.ID)
 		}
+		randID := f.rand.Int63()
 		req := &tg.MessagesSendMessageRequest{
 			NoWebpage:              false,
 			Silent:                 elem.AsSilent(),
@@ -119,9 +216,9 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 			Noforwards:             false,
 			UpdateStickersetsOrder: false,
 			Peer:                   elem.To().InputPeer(),
-			ReplyTo:                getReplyTo(elem.Thread()),
+			ReplyTo:                f.replyTo(ctx, elem, msg),
 			Message:                msg.Message,
-			RandomID:               f.rand.Int63(),
+			RandomID:               randID,
 			ReplyMarkup:            msg.ReplyMarkup,
 			Entities:               msg.Entities,
 			ScheduleDate:           0,
@@ -129,13 +226,22 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 		}
 		req.SetFlags()
 
-		if _, err := f.forwardClient(ctx, elem).MessagesSendMessage(ctx, req); err != nil {
+		updates, err := f.forwardClient(ctx, elem).MessagesSendMessage(ctx, req)
+		if err != nil {
 			return errors.Wrap(err, "send message")
 		}
+		collectSent(sent, updates, map[int64]int{randID: msg.ID})
 		return nil
 	}
 
+	// media which replaces the original one of element message in clone mode
+	var replaced tg.InputMediaClass
+
 	convForwardedMedia := func(msg *tg.Message) (tg.InputMediaClass, error) {
+		if replaced != nil && msg.ID == elem.Msg().ID {
+			return replaced, nil
+		}
+
 		if _, hasMedia := msg.GetMedia(); !hasMedia {
 			// media can't be forwarded via simple copy(it depends on the server ids)
 			// if it's not a media message, just break and send text copy
@@ -147,12 +253,13 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 
 		// we should clone photo and document via re-upload, it will be banned if we forward it directly.
 		// but other media can be forwarded directly via copy
-		if (!protectedDialog(elem.From()) && !protectedMessage(msg)) || !photoOrDocument(msg.Media) {
+		// media of another account also should be re-uploaded, its file reference is not valid for sender
+		if (f.opts.Source == nil && !protectedDialog(elem.From()) && !protectedMessage(msg)) || !photoOrDocument(msg.Media) {
 			media, ok := tmedia.ConvInputMedia(msg.Media)
 			if !ok {
 				return nil, errors.Errorf("can't convert message %d to input class directly", msg.ID)
 			}
-			return media, nil
+			return adaptPoll(elem.To(), media), nil
 		}
 
 		media, ok := tmedia.GetMedia(msg)
@@ -246,61 +353,50 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 		return inputMedia, nil
 	}
 
-	switch elem.Mode() {
+	switch mode {
 	case ModeDirect:
 		// it can be forwarded via API
 		if !protectedDialog(elem.From()) && !protectedMessage(elem.Msg()) {
-			directForward := func(ids ...int) error {
-				randIDs := make([]int64, 0, len(ids))
-				for range ids {
-					randIDs = append(randIDs, f.rand.Int63())
-				}
-
-				req := &tg.MessagesForwardMessagesRequest{
-					Silent:            elem.AsSilent(),
-					Background:        false,
-					WithMyScore:       false,
-					DropAuthor:        false,
-					DropMediaCaptions: false,
-					Noforwards:        false,
-					FromPeer:          elem.From().InputPeer(),
-					ID:                ids,
-					RandomID:          randIDs,
-					ToPeer:            elem.To().InputPeer(),
-					TopMsgID:          elem.Thread(),
-					ScheduleDate:      0,
-					SendAs:            nil,
-				}
-				req.SetFlags()
-				if _, err := f.forwardClient(ctx, elem).MessagesForwardMessages(ctx, req); err != nil {
-					return errors.Wrap(err, "directly forward")
-				}
-				return nil
-			}
-
 			if len(grouped) > 0 {
 				ids := make([]int, 0, len(grouped))
 				for _, m := range grouped {
 					ids = append(ids, m.ID)
 				}
 
-				if err = directForward(ids...); err != nil {
+				forwarded, err := f.forwardBatch(ctx, elem, ids)
+				if err != nil {
 					goto fallback
 				}
 
+				sent = forwarded
 				return nil
 			}
 
-			if err = directForward(elem.Msg().ID); err != nil {
+			forwarded, err := f.forwardBatch(ctx, elem, []int{elem.Msg().ID})
+			if err != nil {
 				goto fallback
 			}
+
+			sent = forwarded
 			return nil
 		}
 	fallback:
 		fallthrough
 	case ModeClone:
+		plan.Mode = ModeClone
+		file, err := replacedMedia(elem)
+		if err != nil {
+			return errors.Wrap(err, "get replaced media")
+		}
+		if file != nil {
+			if replaced, err = f.uploadMedia(ctx, elem, file); err != nil {
+				return errors.Wrap(err, "replace media")
+			}
+		}
+
 		if len(grouped) > 0 {
 			media := make([]tg.InputSingleMedia, 0, len(grouped))
+			randIDs := make(map[int64]int, len(grouped))
 			for _, gm := range grouped {
 				m, err := convForwardedMedia(gm)
 				if err != nil {
@@ -308,9 +404,11 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 					continue
 				}
 
+				randID := f.rand.Int63()
+				randIDs[randID] = gm.ID
 				single := tg.InputSingleMedia{
 					Media:    m,
-					RandomID: f.rand.Int63(),
+					RandomID: randID,
 					Message:  gm.Message,
 					Entities: gm.Entities,
 				}
@@ -327,15 +425,17 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 					Noforwards:             false,
 					UpdateStickersetsOrder: false,
 					Peer:                   elem.To().InputPeer(),
-					ReplyTo:                getReplyTo(elem.Thread()),
+					ReplyTo:                f.replyTo(ctx, elem, elem.Msg()),
 					MultiMedia:             media,
 					ScheduleDate:           0,
 					SendAs:                 nil,
 				}
 				req.SetFlags()
-				if _, err := f.forwardClient(ctx, elem).MessagesSendMultiMedia(ctx, req); err != nil {
+				updates, err := f.forwardClient(ctx, elem).MessagesSendMultiMedia(ctx, req)
+				if err != nil {
 					return errors.Wrap(err, "send multi media")
 				}
+				collectSent(sent, updates, randIDs)
 				return nil
 			}
 
@@ -344,10 +444,13 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 
 		media, err := convForwardedMedia(elem.Msg())
 		if err != nil {
-			log.Debug("Can't convert forwarded media", zap.Error(err))
-			return forwardTextOnly(elem.Msg())
+			if _, hasMedia := elem.Msg().GetMedia(); hasMedia {
+				log.Warn("Can't convert forwarded media, fallback to text", zap.Error(err))
+			}
+			return forwardTextOnly(withMediaText(elem.Msg()))
 		}
 		// send text copy with forwarded media
+		randID := f.rand.Int63()
 		req := &tg.MessagesSendMediaRequest{
 			Silent:                 elem.AsSilent(),
 			Background:             false,
@@ -355,10 +458,10 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 			Noforwards:             false,
 			UpdateStickersetsOrder: false,
 			Peer:                   elem.To().InputPeer(),
-			ReplyTo:                getReplyTo(elem.Thread()),
+			ReplyTo:                f.replyTo(ctx, elem, elem.Msg()),
 			Media:                  media,
 			Message:                elem.Msg().Message,
-			RandomID:               rand.Int63(),
+			RandomID:               randID,
 			ReplyMarkup:            elem.Msg().ReplyMarkup,
 			Entities:               elem.Msg().Entities,
 			ScheduleDate:           0,
@@ -366,13 +469,20 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 		}
 		req.SetFlags()
 
-		if _, err := f.forwardClient(ctx, elem).MessagesSendMedia(ctx, req); err != nil {
+		updates, err := f.forwardClient(ctx, elem).MessagesSendMedia(ctx, req)
+		if err != nil {
+			// rebuilt poll may still be rejected by destination, e.g. quiz in some chats
+			if _, ok := media.(*tg.InputMediaPoll); ok {
+				log.Warn("Can't send poll, fallback to text", zap.Error(err))
+				return forwardTextOnly(withMediaText(elem.Msg()))
+			}
 			return errors.Wrap(err, "send single media")
 		}
+		collectSent(sent, updates, map[int64]int{randID: elem.Msg().ID})
 		return nil
 	}
 
-	return errors.Errorf("unsupported mode %v", elem.Mode())
+	return errors.Errorf("unsupported mode %v", mode)
 }
 
 func (f *Forwarder) tuple(peer peers.Peer, msg *tg.Message) tuple {
@@ -406,6 +516,14 @@ func (w *wrapProgress) add(n int64) {
 	})
 }
 
+// source returns the pool which reads source messages
+func (f *Forwarder) source() dcpool.Pool {
+	if f.opts.Source != nil {
+		return f.opts.Source
+	}
+	return f.opts.Pool
+}
+
 func (f *Forwarder) forwardClient(ctx context.Context, elem Elem) *tg.Client {
 	if elem.AsDryRun() {
 		return tg.NewClient(nopInvoker{})
@@ -460,6 +578,32 @@ func mediaSizeSum(msg *tg.Message, grouped ...*tg.Message) (int64, error) {
 	return m.Size, nil
 }
 
+// collectSent records destination ids of sent messages, randIDs maps random id to source message id
+func collectSent(sent map[int]int, updates tg.UpdatesClass, randIDs map[int64]int) {
+	var list []tg.UpdateClass
+
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		// only returned by single message sending, which has no random id
+		for _, src := range randIDs {
+			sent[src] = u.ID
+		}
+		return
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	}
+
+	for _, update := range list {
+		if m, ok := update.(*tg.UpdateMessageID); ok {
+			if src, ok := randIDs[m.RandomID]; ok {
+				sent[src] = m.ID
+			}
+		}
+	}
+}
+
 func getReplyTo(thread int) tg.InputReplyToClass {
 	replyTo := &tg.InputReplyToMessage{
 		ReplyToMsgID: thread,
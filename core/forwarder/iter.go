@@ -5,6 +5,8 @@ import (
 
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
+
+	tuploader "github.com/iyear/tdl/core/uploader"
 )
 
 type Iter interface {
@@ -25,3 +27,10 @@ type Elem interface {
 	AsDryRun() bool
 	AsGrouped() bool // detect and forward grouped messages
 }
+
+// ElemMedia can be implemented by Elem to replace media of the message in clone mode.
+type ElemMedia interface {
+	// Media returns the file to be uploaded instead of the original media, nil means keeping it.
+	// The file is closed after uploading if it implements io.Closer.
+	Media() (tuploader.File, error)
+}
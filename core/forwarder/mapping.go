@@ -0,0 +1,108 @@
+package forwarder
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// Mapping records destination copies of source messages, which is used to preserve
+// reply structure and topics in clone mode. It can be persisted to preserve them across runs.
+type Mapping interface {
+	Get(ctx context.Context, from int64, msg int, to int64) (int, bool, error)
+	Set(ctx context.Context, from int64, msg int, to int64, dst int) error
+}
+
+type mappingKey struct {
+	from int64
+	msg  int
+	to   int64
+}
+
+// memMapping is the default Mapping which only lives in one run
+type memMapping struct {
+	mu sync.RWMutex
+	m  map[mappingKey]int
+}
+
+func newMemMapping() *memMapping {
+	return &memMapping{m: make(map[mappingKey]int)}
+}
+
+func (m *memMapping) Get(_ context.Context, from int64, msg int, to int64) (int, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dst, ok := m.m[mappingKey{from: from, msg: msg, to: to}]
+	return dst, ok, nil
+}
+
+func (m *memMapping) Set(_ context.Context, from int64, msg int, to int64, dst int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.m[mappingKey{from: from, msg: msg, to: to}] = dst
+	return nil
+}
+
+// mapped returns the destination copy of the source message in the same destination peer
+func (f *Forwarder) mapped(ctx context.Context, elem Elem, msg int) int {
+	if msg == 0 {
+		return 0
+	}
+
+	dst, ok, err := f.opts.Mapping.Get(ctx, elem.From().ID(), msg, elem.To().ID())
+	if err != nil {
+		logctx.From(ctx).Warn("Get mapped message",
+			zap.Int64("from", elem.From().ID()),
+			zap.Int("message", msg),
+			zap.Error(err))
+		return 0
+	}
+	if !ok {
+		return 0
+	}
+	return dst
+}
+
+// replyTo returns reply header of the copy. If the source message replies to a message or
+// belongs to a topic which has been forwarded to the same destination, the copy replies to
+// the corresponding one. Otherwise, it replies to the thread of the element.
+func (f *Forwarder) replyTo(ctx context.Context, elem Elem, msg *tg.Message) tg.InputReplyToClass {
+	header, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	// replies to other chats can't be preserved
+	if !ok || header.ReplyToPeerID != nil {
+		return getReplyTo(elem.Thread())
+	}
+
+	top := header.ReplyToTopID
+	if top == 0 && header.ForumTopic {
+		// message replies to the topic directly
+		top = header.ReplyToMsgID
+	}
+
+	thread := elem.Thread()
+	if dst := f.mapped(ctx, elem, top); dst != 0 {
+		thread = dst
+	}
+
+	reply := 0
+	if header.ReplyToMsgID != top {
+		reply = f.mapped(ctx, elem, header.ReplyToMsgID)
+	}
+	if reply == 0 {
+		return getReplyTo(thread)
+	}
+
+	replyTo := &tg.InputReplyToMessage{
+		ReplyToMsgID: reply,
+		TopMsgID:     thread,
+	}
+	replyTo.SetFlags()
+
+	return replyTo
+}
@@ -0,0 +1,159 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+	"go.uber.org/multierr"
+
+	"github.com/iyear/tdl/core/tmedia"
+	tuploader "github.com/iyear/tdl/core/uploader"
+)
+
+// replacedMedia returns the file which replaces media of the element
+func replacedMedia(elem Elem) (tuploader.File, error) {
+	m, ok := elem.(ElemMedia)
+	if !ok {
+		return nil, nil
+	}
+	return m.Media()
+}
+
+// uploadMedia uploads the local file as media of the copy. Images are sent as photos,
+// and others are sent as documents.
+func (f *Forwarder) uploadMedia(ctx context.Context, elem Elem, file tuploader.File) (_ tg.InputMediaClass, rerr error) {
+	if c, ok := file.(io.Closer); ok {
+		defer multierr.AppendInvoke(&rerr, multierr.Close(c))
+	}
+
+	mimeType := mime.TypeByExtension(filepath.Ext(file.Name()))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	var uploaded tg.InputFileClass = &tg.InputFile{}
+	// if dry run, just use empty input file
+	if !elem.AsDryRun() {
+		var err error
+		uploaded, err = uploader.NewUploader(f.opts.Pool.Default(ctx)).
+			WithPartSize(tuploader.MaxPartSize).
+			WithThreads(f.opts.Threads).
+			Upload(ctx, uploader.NewUpload(file.Name(), file, file.Size()))
+		if err != nil {
+			return nil, errors.Wrap(err, "upload")
+		}
+	}
+
+	var media tg.InputMediaClass
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp":
+		media = &tg.InputMediaUploadedPhoto{File: uploaded}
+	default:
+		document := &tg.InputMediaUploadedDocument{
+			File:     uploaded,
+			MimeType: mimeType,
+			Attributes: []tg.DocumentAttributeClass{
+				&tg.DocumentAttributeFilename{FileName: filepath.Base(file.Name())},
+			},
+		}
+		document.SetFlags()
+		media = document
+	}
+
+	// uploaded media should be uploaded to the peer first, so that it can be used in albums
+	messageMedia, err := f.forwardClient(ctx, elem).MessagesUploadMedia(ctx, &tg.MessagesUploadMediaRequest{
+		Peer:  elem.To().InputPeer(),
+		Media: media,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "upload media")
+	}
+
+	inputMedia, ok := tmedia.ConvInputMedia(messageMedia)
+	if !ok && !elem.AsDryRun() {
+		return nil, errors.Errorf("can't convert uploaded media to input class")
+	}
+
+	return inputMedia, nil
+}
+
+// adaptPoll clears poll settings which are not allowed in broadcast channels. Voters of
+// channel polls are always anonymous, and close time of the original poll may have passed.
+func adaptPoll(to peers.Peer, media tg.InputMediaClass) tg.InputMediaClass {
+	poll, ok := media.(*tg.InputMediaPoll)
+	if !ok {
+		return media
+	}
+	if c, ok := to.(peers.Channel); !ok || !c.IsBroadcast() {
+		return media
+	}
+
+	poll.Poll.PublicVoters = false
+	poll.Poll.CloseDate, poll.Poll.ClosePeriod = 0, 0
+	poll.Poll.Flags = 0 // SetFlags doesn't unset flags of cleared fields
+	poll.Poll.SetFlags()
+
+	return poll
+}
+
+// withMediaText returns a copy of message whose media is described in text, which is the
+// fallback when media can't be cloned. Entities are kept as the description is appended.
+func withMediaText(msg *tg.Message) *tg.Message {
+	text := mediaText(msg.Media)
+	if text == "" {
+		return msg
+	}
+
+	m := *msg
+	if m.Message != "" {
+		m.Message += "\n\n"
+	}
+	m.Message += text
+
+	return &m
+}
+
+func mediaText(media tg.MessageMediaClass) string {
+	switch m := media.(type) {
+	case *tg.MessageMediaPoll:
+		b := &strings.Builder{}
+		b.WriteString("Poll: " + m.Poll.Question.Text)
+		for _, a := range m.Poll.Answers {
+			b.WriteString("\n- " + a.Text.Text)
+		}
+		return b.String()
+	case *tg.MessageMediaContact:
+		name := strings.TrimSpace(m.FirstName + " " + m.LastName)
+		return fmt.Sprintf("Contact: %s %s", name, m.PhoneNumber)
+	case *tg.MessageMediaVenue:
+		return fmt.Sprintf("Venue: %s, %s", m.Title, m.Address)
+	case *tg.MessageMediaGeo:
+		return geoText(m.Geo)
+	case *tg.MessageMediaGeoLive:
+		return geoText(m.Geo)
+	case *tg.MessageMediaDice:
+		return m.Emoticon
+	case *tg.MessageMediaWebPage:
+		if w, ok := m.Webpage.(*tg.WebPage); ok {
+			return w.URL
+		}
+	}
+
+	return ""
+}
+
+func geoText(geo tg.GeoPointClass) string {
+	g, ok := geo.AsNotEmpty()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("Location: %f, %f", g.Lat, g.Long)
+}
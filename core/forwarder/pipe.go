@@ -0,0 +1,142 @@
+package forwarder
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-faster/errors"
+)
+
+// pipe connects parallel downloading with sequential uploading. Parts written near the read
+// offset are kept in memory, and parts too far ahead are spilled to a temp file, which is
+// created only when needed. So the memory usage is bounded by window.
+type pipe struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	window  int64            // max bytes ahead of read offset kept in memory
+	off     int64            // read offset
+	chunks  map[int64][]byte // offset -> data in memory
+	spilled map[int64]int64  // offset -> length of data in temp file
+	temp    *os.File
+
+	done bool  // all parts are written
+	err  error // writer side error
+}
+
+func newPipe(window int64) *pipe {
+	p := &pipe{
+		window:  window,
+		chunks:  make(map[int64][]byte),
+		spilled: make(map[int64]int64),
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+func (p *pipe) WriteAt(b []byte, off int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	if off+int64(len(b))-p.off <= p.window {
+		// writer may reuse the buffer
+		p.chunks[off] = append([]byte(nil), b...)
+		p.cond.Broadcast()
+		return len(b), nil
+	}
+
+	// ordering requires buffering too much, spill it to disk
+	if p.temp == nil {
+		temp, err := os.CreateTemp("", "tdl_*")
+		if err != nil {
+			return 0, errors.Wrap(err, "create temp file")
+		}
+		p.temp = temp
+	}
+
+	n, err := p.temp.WriteAt(b, off)
+	if err != nil {
+		return n, errors.Wrap(err, "write temp file")
+	}
+	p.spilled[off] = int64(n)
+	p.cond.Broadcast()
+
+	return n, nil
+}
+
+func (p *pipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if data, ok := p.chunks[p.off]; ok {
+			n := copy(b, data)
+			delete(p.chunks, p.off)
+			if n < len(data) {
+				p.chunks[p.off+int64(n)] = data[n:]
+			}
+			p.off += int64(n)
+			p.cond.Broadcast()
+			return n, nil
+		}
+
+		if size, ok := p.spilled[p.off]; ok {
+			n, err := p.temp.ReadAt(b[:min(int64(len(b)), size)], p.off)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return n, errors.Wrap(err, "read temp file")
+			}
+			delete(p.spilled, p.off)
+			if int64(n) < size {
+				p.spilled[p.off+int64(n)] = size - int64(n)
+			}
+			p.off += int64(n)
+			p.cond.Broadcast()
+			return n, nil
+		}
+
+		if p.err != nil {
+			return 0, p.err
+		}
+		if p.done {
+			return 0, io.EOF
+		}
+
+		p.cond.Wait()
+	}
+}
+
+// CloseWrite marks the end of writing. If err is not nil, pending and following reads return it.
+func (p *pipe) CloseWrite(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.err = err
+	}
+	p.done = true
+	p.cond.Broadcast()
+}
+
+// Close releases buffered data and removes the temp file
+func (p *pipe) Close() error {
+	p.CloseWrite(io.ErrClosedPipe)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.chunks, p.spilled = nil, nil
+	if p.temp == nil {
+		return nil
+	}
+
+	if err := p.temp.Close(); err != nil {
+		return err
+	}
+	return os.Remove(p.temp.Name())
+}
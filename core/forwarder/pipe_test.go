@@ -0,0 +1,136 @@
+package forwarder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// readAll reads p with buffers of size n until EOF
+func readAll(t *testing.T, p *pipe, n int) []byte {
+	t.Helper()
+
+	var out []byte
+	buf := make([]byte, n)
+	for {
+		m, err := p.Read(buf)
+		out = append(out, buf[:m]...)
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+}
+
+func TestPipe(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuv")
+
+	tests := []struct {
+		name   string
+		window int64
+		part   int
+		order  []int // indexes of parts in writing order
+		buf    int   // read buffer size
+		spill  bool  // whether some parts are spilled to temp file
+	}{
+		{name: "in order", window: 32, part: 4, order: []int{0, 1, 2, 3, 4, 5, 6, 7}, buf: 4},
+		{name: "out of order within window", window: 32, part: 4, order: []int{1, 0, 3, 2, 5, 4, 7, 6}, buf: 4},
+		{name: "out of order beyond window", window: 4, part: 4, order: []int{7, 6, 5, 4, 3, 2, 1, 0}, buf: 4, spill: true},
+		{name: "small reads across spill boundary", window: 8, part: 8, order: []int{3, 2, 1, 0}, buf: 3, spill: true},
+		{name: "large reads across spill boundary", window: 8, part: 8, order: []int{1, 0, 3, 2}, buf: 20, spill: true},
+		{name: "single byte reads", window: 4, part: 4, order: []int{2, 0, 1, 7, 3, 6, 4, 5}, buf: 1, spill: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPipe(tt.window)
+
+			for _, i := range tt.order {
+				off := i * tt.part
+				part := append([]byte(nil), data[off:off+tt.part]...)
+				if _, err := p.WriteAt(part, int64(off)); err != nil {
+					t.Fatalf("write part %d: %v", i, err)
+				}
+				// writer may reuse the buffer
+				copy(part, bytes.Repeat([]byte{'x'}, len(part)))
+			}
+			p.CloseWrite(nil)
+
+			if spilled := p.temp != nil; spilled != tt.spill {
+				t.Errorf("spilled = %v, want %v", spilled, tt.spill)
+			}
+
+			if got := readAll(t, p, tt.buf); !bytes.Equal(got, data) {
+				t.Errorf("read %q, want %q", got, data)
+			}
+
+			var name string
+			if p.temp != nil {
+				name = p.temp.Name()
+			}
+			if err := p.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if name != "" {
+				if _, err := os.Stat(name); !os.IsNotExist(err) {
+					t.Errorf("temp file %s is not removed", name)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeCloseWrite(t *testing.T) {
+	errWriter := errors.New("download failed")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "error", err: errWriter, want: errWriter},
+		{name: "done", err: nil, want: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPipe(8)
+			defer func() { _ = p.Close() }()
+
+			result := make(chan error, 1)
+			go func() {
+				_, err := p.Read(make([]byte, 4))
+				result <- err
+			}()
+
+			// read should be blocked as nothing is written
+			select {
+			case err := <-result:
+				t.Fatalf("read returned before CloseWrite: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			p.CloseWrite(tt.err)
+
+			select {
+			case err := <-result:
+				if !errors.Is(err, tt.want) {
+					t.Errorf("read error = %v, want %v", err, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("read is not unblocked by CloseWrite")
+			}
+
+			if tt.err != nil {
+				if _, err := p.WriteAt([]byte("late"), 0); !errors.Is(err, tt.err) {
+					t.Errorf("write after CloseWrite error = %v, want %v", err, tt.err)
+				}
+			}
+		})
+	}
+}
@@ -14,3 +14,24 @@ type ProgressState struct {
 	Done  int64
 	Total int64
 }
+
+// ProgressSent is an optional interface of Progress. OnSent is called with all source messages
+// which are successfully forwarded by the element, including grouped ones. msgs maps source
+// message id to destination message id, which is zero if unknown.
+type ProgressSent interface {
+	OnSent(elem Elem, msgs map[int]int)
+}
+
+// ProgressPlan is an optional interface of Progress. OnPlan is called in dry run with the
+// decision of how the element would be forwarded.
+type ProgressPlan interface {
+	OnPlan(elem Elem, plan Plan)
+}
+
+type Plan struct {
+	Mode      Mode  // mode which is actually used, direct may fall back to clone
+	TextOnly  bool  // only text is sent in clone mode, because media can't be cloned
+	Messages  []int // source messages, including grouped ones
+	MediaSize int64 // total size of media
+	Err       error // error which would stop forwarding
+}
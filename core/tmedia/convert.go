@@ -21,13 +21,16 @@ func ConvInputMedia(media tg.MessageMediaClass) (tg.InputMediaClass, bool) {
 	case *tg.MessageMediaInvoice:
 		return ConvInputMediaInvoice(v)
 	case *tg.MessageMediaGeoLive:
-		return ConvInputMediaGeoLive(v)
+		// live location can only be updated by its sender, so it's sent as static one
+		return ConvInputMediaGeo(&tg.MessageMediaGeo{Geo: v.Geo})
 	case *tg.MessageMediaPoll:
 		return ConvInputMediaPoll(v)
 	case *tg.MessageMediaDice:
 		return ConvInputMediaDice(v)
 	case *tg.MessageMediaStory:
 		return ConvInputMediaStory(v)
+	case *tg.MessageMediaWebPage:
+		return ConvInputMediaWebPage(v)
 	case *tg.MessageMediaUnsupported:
 		return nil, false
 	default:
@@ -136,10 +139,41 @@ func ConvInputMediaGeoLive(v *tg.MessageMediaGeoLive) (*tg.InputMediaGeoLive, bo
 	return nil, false
 }
 
+// ConvInputMediaPoll rebuilds poll with its answers, votes are not kept.
+// Quiz is sent as regular poll if the correct answer is unknown.
 func ConvInputMediaPoll(v *tg.MessageMediaPoll) (*tg.InputMediaPoll, bool) {
-	// TODO(): unsupported
-	_ = v
-	return nil, false
+	poll := tg.Poll{
+		Closed:         v.Poll.Closed,
+		PublicVoters:   v.Poll.PublicVoters,
+		MultipleChoice: v.Poll.MultipleChoice,
+		Quiz:           v.Poll.Quiz,
+		Question:       v.Poll.Question,
+		Answers:        v.Poll.Answers,
+		ClosePeriod:    v.Poll.ClosePeriod,
+		CloseDate:      v.Poll.CloseDate,
+	}
+
+	ret := &tg.InputMediaPoll{}
+	if poll.Quiz {
+		for _, r := range v.Results.Results {
+			if r.Correct {
+				ret.CorrectAnswers = append(ret.CorrectAnswers, r.Option)
+			}
+		}
+
+		if len(ret.CorrectAnswers) == 0 {
+			poll.Quiz = false
+		} else {
+			ret.Solution = v.Results.Solution
+			ret.SolutionEntities = v.Results.SolutionEntities
+		}
+	}
+
+	poll.SetFlags()
+	ret.Poll = poll
+	ret.SetFlags()
+
+	return ret, true
 }
 
 func ConvInputMediaDice(v *tg.MessageMediaDice) (*tg.InputMediaDice, bool) {
@@ -148,6 +182,32 @@ func ConvInputMediaDice(v *tg.MessageMediaDice) (*tg.InputMediaDice, bool) {
 	}, true
 }
 
+// ConvInputMediaWebPage converts web page preview to its url, preview is generated again by server
+func ConvInputMediaWebPage(v *tg.MessageMediaWebPage) (*tg.InputMediaWebPage, bool) {
+	var url string
+	switch w := v.Webpage.(type) {
+	case *tg.WebPage:
+		url = w.URL
+	case *tg.WebPageEmpty:
+		url, _ = w.GetURL()
+	case *tg.WebPagePending:
+		url, _ = w.GetURL()
+	}
+	if url == "" {
+		return nil, false
+	}
+
+	ret := &tg.InputMediaWebPage{
+		ForceLargeMedia: v.ForceLargeMedia,
+		ForceSmallMedia: v.ForceSmallMedia,
+		Optional:        true, // don't fail if preview can't be generated
+		URL:             url,
+	}
+	ret.SetFlags()
+
+	return ret, true
+}
+
 func ConvInputMediaStory(v *tg.MessageMediaStory) (*tg.InputMediaStory, bool) {
 	// TODO(): unsupported
 	_ = v
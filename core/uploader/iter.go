@@ -3,6 +3,7 @@ package uploader
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/gotd/td/tg"
 )
@@ -13,8 +14,11 @@ type Iter interface {
 	Err() error
 }
 
+// File is the content to be uploaded. It can also implement io.Seeker,
+// which enables video metadata probing and uploading to Google Drive.
+// Size returns -1 if the size of the stream is unknown.
 type File interface {
-	io.ReadSeeker
+	io.Reader
 	Name() string
 	Size() int64
 }
@@ -30,3 +34,20 @@ type Elem interface {
 	Remove() bool
 	FilePath() string
 }
+
+// ElemSchedule can be implemented by Elem to post the message later.
+type ElemSchedule interface {
+	// Schedule returns the time to post the message, zero means posting immediately.
+	Schedule() time.Time
+}
+
+// ElemSpoiler can be implemented by Elem to hide photos and videos under a spoiler.
+type ElemSpoiler interface {
+	Spoiler() bool
+}
+
+// ElemMediaType can be implemented by Elem to force the media type of the file.
+type ElemMediaType interface {
+	// MediaType returns the type of sent media, auto means detecting by MIME.
+	MediaType() MediaType
+}
@@ -0,0 +1,166 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/util/fsutil"
+	"github.com/iyear/tdl/core/util/mediautil"
+)
+
+//go:generate go-enum --values --names --flag --nocase
+
+// MediaType is the type of sent media, auto means detecting by MIME
+// ENUM(auto, document, photo, video, audio, voice, round, animation, sticker)
+type MediaType int
+
+// mediaType returns the forced type of elem, or detects it by MIME
+func mediaType(elem Elem, mime string) (MediaType, bool) {
+	if t, ok := elem.(ElemMediaType); ok && t.MediaType() != MediaTypeAuto {
+		return t.MediaType(), true
+	}
+
+	switch {
+	case mediautil.IsImage(mime) && elem.AsPhoto() && mime != "image/webp": // webp should be uploaded as document
+		return MediaTypePhoto, false
+	case mediautil.IsVideo(mime):
+		return MediaTypeVideo, false
+	case mediautil.IsAudio(mime):
+		return MediaTypeAudio, false
+	default:
+		return MediaTypeDocument, false
+	}
+}
+
+func (u *Uploader) media(ctx context.Context, elem Elem, f tg.InputFileClass, mime string, caption message.StyledTextOption) (message.MediaOption, error) {
+	typ, forced := mediaType(elem, mime)
+	name := elem.File().Name()
+
+	spoiler := false
+	if s, ok := elem.(ElemSpoiler); ok {
+		spoiler = s.Spoiler()
+	}
+
+	doc := message.UploadedDocument(f, caption).MIME(mime).Filename(name)
+	// raw document is only built for spoiler, which is not supported by builders
+	raw := &tg.InputMediaUploadedDocument{
+		File:       f,
+		MimeType:   mime,
+		Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: name}},
+		Spoiler:    true,
+	}
+	// upload thumbnail TODO(iyear): maybe still unavailable
+	if thumb, ok := elem.Thumb(); ok {
+		if thumbFile, err := uploader.NewUploader(u.opts.Client).
+			FromReader(ctx, thumb.Name(), thumb); err == nil {
+			doc = doc.Thumb(thumbFile)
+			raw.SetThumb(thumbFile)
+		}
+	}
+
+	switch typ {
+	case MediaTypePhoto:
+		if spoiler {
+			return message.Media(&tg.InputMediaUploadedPhoto{File: f, Spoiler: true}, caption), nil
+		}
+		return message.UploadedPhoto(f, caption), nil
+	case MediaTypeVideo:
+		dur, w, h, err := probeMP4(elem.File())
+		if err != nil {
+			// #132. There may be some errors, but we can still upload the file as document
+			if spoiler {
+				return message.Media(raw, caption), nil
+			}
+			return doc, nil
+		}
+		if spoiler {
+			raw.Attributes = append(raw.Attributes, videoAttribute(dur, w, h))
+			return message.Media(raw, caption), nil
+		}
+		return doc.Video().
+			Duration(time.Duration(dur)*time.Second).
+			Resolution(w, h).
+			SupportsStreaming(), nil
+	case MediaTypeRound:
+		dur, w, h, err := probeMP4(elem.File())
+		if err != nil {
+			return nil, errors.Wrap(err, "round video must be a MP4 file with H264 track")
+		}
+		return doc.RoundVideo().
+			Duration(time.Duration(dur)*time.Second).
+			Resolution(w, h), nil
+	case MediaTypeAnimation:
+		doc = doc.Attributes(&tg.DocumentAttributeAnimated{})
+		raw.Attributes = append(raw.Attributes, &tg.DocumentAttributeAnimated{})
+
+		if dur, w, h, err := probeMP4(elem.File()); err == nil {
+			raw.Attributes = append(raw.Attributes, videoAttribute(dur, w, h))
+			if !spoiler {
+				return doc.Video().
+					Duration(time.Duration(dur)*time.Second).
+					Resolution(w, h), nil
+			}
+		}
+		if spoiler {
+			return message.Media(raw, caption), nil
+		}
+		return doc, nil
+	case MediaTypeAudio:
+		return doc.Audio().Title(fsutil.GetNameWithoutExt(name)), nil
+	case MediaTypeVoice:
+		rs, err := rewind(elem.File())
+		if err != nil {
+			return nil, err
+		}
+		dur, waveform, err := mediautil.GetOggOpusInfo(rs)
+		if err != nil {
+			return nil, errors.Wrap(err, "voice must be an Ogg Opus file")
+		}
+		return doc.Voice().DurationSeconds(dur).Waveform(waveform), nil
+	case MediaTypeSticker:
+		// stickers have no caption
+		return message.UploadedDocument(f).MIME(mime).Filename(name).UploadedSticker(), nil
+	default:
+		if forced {
+			// prevent Telegram from converting it to other media
+			return doc.ForceFile(true), nil
+		}
+		return doc, nil
+	}
+}
+
+func videoAttribute(dur, w, h int) *tg.DocumentAttributeVideo {
+	return &tg.DocumentAttributeVideo{
+		Duration:          float64(dur),
+		W:                 w,
+		H:                 h,
+		SupportsStreaming: true,
+	}
+}
+
+// rewind seeks the file to start, which is read by uploader
+func rewind(file File) (io.ReadSeeker, error) {
+	rs, ok := file.(io.ReadSeeker)
+	if !ok {
+		return nil, errors.New("stream can't be probed")
+	}
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "seek file")
+	}
+	return rs, nil
+}
+
+func probeMP4(file File) (int, int, int, error) {
+	rs, err := rewind(file)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return mediautil.GetMP4Info(rs)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
 )
 
 type Progress interface {
@@ -13,6 +14,11 @@ type Progress interface {
 	// TODO: OnLog to log something that is not an error but should be sent to the user
 }
 
+// ProgressSent can be optionally implemented by Progress to get the sent message
+type ProgressSent interface {
+	OnSent(elem Elem, msg *tg.Message)
+}
+
 type ProgressState struct {
 	Uploaded int64
 	Total    int64
@@ -4,20 +4,18 @@ import (
 	"context"
 	"io"
 	"os"
-	"time"
 
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/telegram/message/entity"
 	"github.com/gotd/td/telegram/message/styling"
+	"github.com/gotd/td/telegram/message/unpack"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
 	"github.com/samber/lo"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/iyear/tdl/core/util/fsutil"
-	"github.com/iyear/tdl/core/util/mediautil"
 	"github.com/iyear/tdl/pkg/consts"
 	"github.com/iyear/tdl/pkg/gdrive"
 )
@@ -25,6 +23,17 @@ import (
 // MaxPartSize refer to https://core.telegram.org/api/files#uploading-files
 const MaxPartSize = 512 * 1024
 
+// MaxParts is the maximum number of parts of an uploaded file, and premium users can upload twice as many.
+const MaxParts = 4000
+
+// MaxFileSize returns the maximum size of an uploaded file
+func MaxFileSize(premium bool) int64 {
+	if premium {
+		return 2 * MaxParts * MaxPartSize
+	}
+	return MaxParts * MaxPartSize
+}
+
 type Uploader struct {
 	opts Options
 }
@@ -47,11 +56,14 @@ func (u *Uploader) Upload(ctx context.Context, limit int) error {
 	for u.opts.Iter.Next(wgctx) {
 		elem := u.opts.Iter.Value()
 
-		wg.Go(func() (rerr error) {
+		wg.Go(func() error {
 			u.opts.Progress.OnAdd(elem)
-			defer func() { u.opts.Progress.OnDone(elem, rerr) }()
 
-			if err := u.upload(wgctx, elem); err != nil {
+			// progress should know the real result of each element
+			err := u.upload(wgctx, elem)
+			u.opts.Progress.OnDone(elem, err)
+
+			if err != nil {
 				// canceled by user, so we directly return error to stop all
 				if errors.Is(err, context.Canceled) {
 					return errors.Wrap(err, "upload")
@@ -86,18 +98,14 @@ func (u *Uploader) upload(ctx context.Context, elem Elem) error {
 			process: u.opts.Progress,
 		})
 
-	f, err := up.Upload(ctx, uploader.NewUpload(elem.File().Name(), elem.File(), elem.File().Size()))
+	// record file header while uploading, so that non-seekable streams can be sniffed
+	file := newSniffReader(elem.File())
+	f, err := up.Upload(ctx, uploader.NewUpload(elem.File().Name(), file, elem.File().Size()))
 	if err != nil {
 		return errors.Wrap(err, "upload file")
 	}
 
-	if _, err = elem.File().Seek(0, io.SeekStart); err != nil {
-		return errors.Wrap(err, "seek file")
-	}
-	mime, err := mimetype.DetectReader(elem.File())
-	if err != nil {
-		return errors.Wrap(err, "detect mime")
-	}
+	mime := mimetype.Detect(file.head)
 
 	// here convert underlying entities to formatters for message caption
 	caption := styling.Custom(func(eb *entity.Builder) error {
@@ -110,50 +118,30 @@ func (u *Uploader) upload(ctx context.Context, elem Elem) error {
 		return nil
 	})
 
-	doc := message.UploadedDocument(f, caption).MIME(mime.String()).Filename(elem.File().Name())
-	// upload thumbnail TODO(iyear): maybe still unavailable
-	if thumb, ok := elem.Thumb(); ok {
-		if thumbFile, err := uploader.NewUploader(u.opts.Client).
-			FromReader(ctx, thumb.Name(), thumb); err == nil {
-			doc = doc.Thumb(thumbFile)
-		}
-	}
-
-	var media message.MediaOption = doc
-
-	switch {
-	case mediautil.IsImage(mime.String()) && elem.AsPhoto():
-		// webp should be uploaded as document
-		if mime.String() == "image/webp" {
-			break
-		}
-		// upload as photo
-		media = message.UploadedPhoto(f, caption)
-	case mediautil.IsVideo(mime.String()):
-		// reset reader
-		if _, err = elem.File().Seek(0, io.SeekStart); err != nil {
-			return errors.Wrap(err, "seek file")
-		}
-		if dur, w, h, err := mediautil.GetMP4Info(elem.File()); err == nil {
-			// #132. There may be some errors, but we can still upload the file
-			media = doc.Video().
-				Duration(time.Duration(dur)*time.Second).
-				Resolution(w, h).
-				SupportsStreaming()
-		}
-	case mediautil.IsAudio(mime.String()):
-		media = doc.Audio().Title(fsutil.GetNameWithoutExt(elem.File().Name()))
+	media, err := u.media(ctx, elem, f, mime.String(), caption)
+	if err != nil {
+		return errors.Wrap(err, "build media")
 	}
 
-	_, err = message.NewSender(u.opts.Client).
+	builder := message.NewSender(u.opts.Client).
 		WithUploader(up).
 		To(elem.To()).
-		Reply(elem.Thread()).
-		Media(ctx, media)
+		Reply(elem.Thread())
+	if s, ok := elem.(ElemSchedule); ok && !s.Schedule().IsZero() {
+		builder = builder.Schedule(s.Schedule())
+	}
+
+	updates, err := builder.Media(ctx, media)
 	if err != nil {
 		return errors.Wrap(err, "send message")
 	}
 
+	if p, ok := u.opts.Progress.(ProgressSent); ok {
+		if msg, ok := sentMessage(updates); ok {
+			p.OnSent(elem, msg)
+		}
+	}
+
 	if elem.Gdrive() {
 		if err := u.uploadToGdrive(ctx, elem); err != nil {
 			return errors.Wrap(err, "upload to gdrive")
@@ -175,14 +163,60 @@ func (u *Uploader) uploadToGdrive(ctx context.Context, elem Elem) error {
 		return err
 	}
 
-	if _, err := elem.File().Seek(0, io.SeekStart); err != nil {
+	rs, ok := elem.File().(io.ReadSeeker)
+	if !ok {
+		return errors.New("stream can't be uploaded to gdrive again")
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
 		return errors.Wrap(err, "seek file")
 	}
 
-	_, err = gdrive.UploadFile(ctx, srv, elem.File().Name(), elem.File())
+	_, err = gdrive.UploadFile(ctx, srv, elem.File().Name(), rs)
 	return err
 }
 
+// sentMessage extracts the sent message from updates, including scheduled ones
+func sentMessage(updates tg.UpdatesClass) (*tg.Message, bool) {
+	if msg, err := unpack.Message(updates, nil); err == nil {
+		return msg, true
+	}
+
+	u, ok := updates.(*tg.Updates)
+	if !ok {
+		return nil, false
+	}
+	for _, update := range u.Updates {
+		if s, ok := update.(*tg.UpdateNewScheduledMessage); ok {
+			if msg, ok := s.Message.(*tg.Message); ok {
+				return msg, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// sniffLen is the default read limit of mimetype detection
+const sniffLen = 3072
+
+// sniffReader records the header of the file which is read by uploader
+type sniffReader struct {
+	r    io.Reader
+	head []byte
+}
+
+func newSniffReader(r io.Reader) *sniffReader {
+	return &sniffReader{r: r, head: make([]byte, 0, sniffLen)}
+}
+
+func (s *sniffReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if rest := sniffLen - len(s.head); rest > 0 && n > 0 {
+		s.head = append(s.head, p[:min(n, rest)]...)
+	}
+	return n, err
+}
+
 func (u *Uploader) removeFile(elem Elem) error {
 	filePath := elem.FilePath()
 	if filePath == "" {
@@ -0,0 +1,145 @@
+package mediautil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	oggPageHeaderLen = 27
+	opusHeadLen      = 19 // minimal size of identification header
+	opusSampleRate   = 48000
+
+	// waveform of voice message is 100 samples of 5 bits
+	waveformSamples = 100
+	waveformBits    = 5
+	waveformMax     = 1<<waveformBits - 1
+)
+
+// GetOggOpusInfo returns duration in seconds and waveform of the Ogg Opus stream.
+// Waveform is estimated by sizes of Opus packets, as larger packets generally
+// carry louder audio, which avoids decoding the stream.
+func GetOggOpusInfo(r io.Reader) (int, []byte, error) {
+	var (
+		header  = make([]byte, oggPageHeaderLen)
+		packets []int
+		cur     int    // size of current packet which may span pages
+		head    []byte // identification header, which may span pages
+		granule int64  // granule position of last page
+		preSkip int64
+		index   int // packet index
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, nil, fmt.Errorf("read page header: %w", err)
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return 0, nil, fmt.Errorf("invalid ogg page")
+		}
+
+		if g := int64(binary.LittleEndian.Uint64(header[6:])); g > 0 {
+			granule = g
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return 0, nil, fmt.Errorf("read segment table: %w", err)
+		}
+
+		size := 0
+		for _, s := range segments {
+			size += int(s)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, nil, fmt.Errorf("read page data: %w", err)
+		}
+
+		offset := 0
+		for _, s := range segments {
+			if index == 0 && len(head) < opusHeadLen {
+				seg := data[offset : offset+int(s)]
+				head = append(head, seg[:min(len(seg), opusHeadLen-len(head))]...)
+			}
+
+			cur += int(s)
+			offset += int(s)
+			if s == 255 { // packet continues
+				continue
+			}
+
+			switch index {
+			case 0: // identification header
+				if len(head) < opusHeadLen || !bytes.HasPrefix(head, []byte("OpusHead")) {
+					return 0, nil, fmt.Errorf("not an opus stream")
+				}
+				preSkip = int64(binary.LittleEndian.Uint16(head[10:]))
+			case 1: // comment header
+			default:
+				packets = append(packets, cur)
+			}
+
+			index++
+			cur = 0
+		}
+	}
+
+	if index < 2 {
+		return 0, nil, fmt.Errorf("not an opus stream")
+	}
+
+	return int((granule - preSkip) / opusSampleRate), waveform(packets), nil
+}
+
+// waveform packs samples of packet sizes into 5-bit values
+func waveform(packets []int) []byte {
+	samples := make([]int, waveformSamples)
+	if len(packets) == 0 {
+		return encodeWaveform(samples)
+	}
+
+	peak := 0
+	for i := range samples {
+		start := i * len(packets) / waveformSamples
+		end := (i + 1) * len(packets) / waveformSamples
+		if end <= start {
+			end = start + 1
+		}
+
+		sum := 0
+		for _, p := range packets[start:end] {
+			sum += p
+		}
+		samples[i] = sum / (end - start)
+		if samples[i] > peak {
+			peak = samples[i]
+		}
+	}
+
+	for i := range samples {
+		if peak > 0 {
+			samples[i] = samples[i] * waveformMax / peak
+		}
+	}
+
+	return encodeWaveform(samples)
+}
+
+func encodeWaveform(samples []int) []byte {
+	b := make([]byte, (len(samples)*waveformBits+7)/8)
+	for i, s := range samples {
+		bit := i * waveformBits
+		v := uint16(s&waveformMax) << (bit % 8)
+		b[bit/8] |= byte(v)
+		if bit/8+1 < len(b) {
+			b[bit/8+1] |= byte(v >> 8)
+		}
+	}
+	return b
+}
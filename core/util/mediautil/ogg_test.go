@@ -0,0 +1,187 @@
+package mediautil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// oggPage builds an ogg page with the lacing values and data of segments
+func oggPage(granule int64, lacing []byte, data []byte) []byte {
+	header := make([]byte, oggPageHeaderLen)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint64(header[6:], uint64(granule))
+	header[26] = byte(len(lacing))
+
+	return append(append(header, lacing...), data...)
+}
+
+// lacing returns lacing values of a packet which ends in the same page
+func lacing(size int) []byte {
+	l := bytes.Repeat([]byte{255}, size/255)
+	return append(l, byte(size%255))
+}
+
+func opusHead(preSkip uint16, size int) []byte {
+	head := make([]byte, size)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = 1 // channels
+	binary.LittleEndian.PutUint16(head[10:], preSkip)
+	return head
+}
+
+func TestGetOggOpusInfo(t *testing.T) {
+	tags := []byte("OpusTags")
+	audio := func(granule int64, sizes ...int) []byte {
+		var l, d []byte
+		for _, s := range sizes {
+			l = append(l, lacing(s)...)
+			d = append(d, make([]byte, s)...)
+		}
+		return oggPage(granule, l, d)
+	}
+
+	// identification header of 300 bytes, which spans two pages
+	long := opusHead(312, 300)
+
+	tests := []struct {
+		name     string
+		stream   [][]byte
+		duration int
+		err      bool
+	}{
+		{name: "valid", stream: [][]byte{
+			oggPage(0, lacing(19), opusHead(312, 19)),
+			oggPage(0, lacing(len(tags)), tags),
+			audio(48000*3+312, 100, 200),
+		}, duration: 3},
+		{name: "head spans pages", stream: [][]byte{
+			oggPage(0, []byte{255}, long[:255]),
+			oggPage(0, lacing(45), long[255:]),
+			oggPage(0, lacing(len(tags)), tags),
+			audio(48000*5+312, 100),
+		}, duration: 5},
+		{name: "packet spans pages", stream: [][]byte{
+			oggPage(0, lacing(19), opusHead(0, 19)),
+			oggPage(0, lacing(len(tags)), tags),
+			oggPage(0, []byte{255}, make([]byte, 255)),
+			audio(48000*2, 10),
+		}, duration: 2},
+		{name: "empty", stream: nil, err: true},
+		{name: "invalid capture pattern", stream: [][]byte{
+			[]byte("NotOgg, but long enough for a page header"),
+		}, err: true},
+		{name: "truncated data", stream: [][]byte{
+			oggPage(0, lacing(19), opusHead(0, 19))[:oggPageHeaderLen+5],
+		}, err: true},
+		{name: "not opus", stream: [][]byte{
+			oggPage(0, lacing(19), []byte("OggVorbis header...")),
+			oggPage(0, lacing(len(tags)), tags),
+		}, err: true},
+		{name: "short head", stream: [][]byte{
+			oggPage(0, lacing(8), []byte("OpusHead")),
+			oggPage(0, lacing(len(tags)), tags),
+		}, err: true},
+		{name: "missing comment header", stream: [][]byte{
+			oggPage(0, lacing(19), opusHead(0, 19)),
+		}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, wave, err := GetOggOpusInfo(bytes.NewReader(bytes.Join(tt.stream, nil)))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got duration %d", duration)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if duration != tt.duration {
+				t.Errorf("duration = %d, want %d", duration, tt.duration)
+			}
+			if len(wave) != (waveformSamples*waveformBits+7)/8 {
+				t.Errorf("waveform length = %d", len(wave))
+			}
+		})
+	}
+}
+
+// decodeWaveform unpacks 5-bit samples of the waveform
+func decodeWaveform(b []byte) []int {
+	samples := make([]int, len(b)*8/waveformBits)
+	for i := range samples {
+		bit := i * waveformBits
+		v := uint16(b[bit/8])
+		if bit/8+1 < len(b) {
+			v |= uint16(b[bit/8+1]) << 8
+		}
+		samples[i] = int(v>>(bit%8)) & waveformMax
+	}
+	return samples
+}
+
+func TestWaveform(t *testing.T) {
+	repeat := func(v, n int) []int {
+		r := make([]int, n)
+		for i := range r {
+			r[i] = v
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		packets []int
+		want    []int
+	}{
+		{name: "no packets", packets: nil, want: repeat(0, waveformSamples)},
+		{name: "constant", packets: repeat(10, 3), want: repeat(waveformMax, waveformSamples)},
+		{name: "scaled by peak", packets: append(repeat(40, 50), repeat(80, 50)...),
+			want: append(repeat(15, 50), repeat(waveformMax, 50)...)},
+		{name: "averaged", packets: append(repeat(0, 100), repeat(62, 100)...),
+			want: append(repeat(0, 50), repeat(waveformMax, 50)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed := waveform(tt.packets)
+			if len(packed) != (waveformSamples*waveformBits+7)/8 {
+				t.Fatalf("waveform length = %d", len(packed))
+			}
+
+			got := decodeWaveform(packed)[:waveformSamples]
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("sample %d = %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWaveform(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int
+		want    []byte
+	}{
+		{name: "first sample", samples: []int{31, 0}, want: []byte{0x1f, 0x00}},
+		{name: "sample across bytes", samples: []int{0, 31}, want: []byte{0xe0, 0x03}},
+		{name: "values are masked", samples: []int{0xff}, want: []byte{0x1f}},
+		{name: "eight samples in five bytes", samples: []int{1, 2, 3, 4, 5, 6, 7, 8},
+			want: []byte{0x41, 0x0c, 0x52, 0xcc, 0x41}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeWaveform(tt.samples); !bytes.Equal(got, tt.want) {
+				t.Errorf("encodeWaveform() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -88,6 +88,28 @@ func ParseMessageLink(ctx context.Context, manager *peers.Manager, s string) (pe
 	}
 }
 
+// MessageLink returns the public or private link of the message in channel,
+// and empty string if the peer is not a channel which has no message link.
+func MessageLink(peer peers.Peer, thread, msg int) string {
+	ch, ok := peer.(peers.Channel)
+	if !ok {
+		return ""
+	}
+
+	base := fmt.Sprintf("https://t.me/c/%d", ch.ID())
+	if username, ok := ch.Username(); ok {
+		base = "https://t.me/" + username
+	}
+
+	// https://t.me/c/1492447836/251015/251021
+	if thread != 0 && ch.Raw().Forum {
+		return fmt.Sprintf("%s/%d/%d", base, thread, msg)
+	}
+
+	// https://t.me/c/1697797156/151
+	return fmt.Sprintf("%s/%d", base, msg)
+}
+
 func GetInputPeer(ctx context.Context, manager *peers.Manager, from string) (peers.Peer, error) {
 	id, err := strconv.ParseInt(from, 10, 64)
 	if err != nil {
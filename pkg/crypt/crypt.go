@@ -0,0 +1,277 @@
+// Package crypt implements the chunked AES-256-GCM stream format used by
+// 'tdl upload --encrypt' and 'tdl download --decrypt'.
+//
+// The encrypted stream is a header followed by sealed chunks:
+//
+//	magic(8) | salt(16) | nonce prefix(7) | chunk size(4) | plain size(8) | name length(2) | sealed name
+//	chunk 0 | chunk 1 | ... | chunk N-1 (each chunk is sealed plaintext + 16 bytes tag)
+//
+// Each chunk nonce is nonce prefix | chunk index(4) | last flag(1), so chunks
+// can't be reordered, dropped or truncated without being detected.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/go-faster/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Ext is appended to the name of encrypted files
+const Ext = ".tdlenc"
+
+const (
+	magic      = "TDLENC\x00\x01"
+	saltSize   = 16
+	prefixSize = 7
+	tagSize    = 16
+	chunkSize  = 64 * 1024
+
+	// magic + salt + prefix + chunk size + plain size + name length
+	fixedHeaderSize = len(magic) + saltSize + prefixSize + 4 + 8 + 2
+)
+
+var ErrNotEncrypted = errors.New("not an encrypted stream")
+
+// IsEncrypted reports whether the stream starts with the header magic
+func IsEncrypted(r io.Reader) bool {
+	b := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return false
+	}
+	return string(b) == magic
+}
+
+func newAEAD(secret, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, index uint32, last bool) []byte {
+	n := make([]byte, 0, prefixSize+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, index)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// name is sealed with an index that never collides with chunk indexes
+func nameNonce(prefix []byte) []byte {
+	n := nonce(prefix, ^uint32(0), false)
+	n[len(n)-1] = 2
+	return n
+}
+
+func chunks(size int64) int64 {
+	if size == 0 {
+		return 1 // empty stream still has one empty last chunk
+	}
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// MaxPlainSize returns the maximum plaintext size whose encrypted stream is not larger than size.
+// File names are assumed to be up to 255 bytes, which is the limit of most file systems.
+func MaxPlainSize(size int64) int64 {
+	size -= int64(fixedHeaderSize + 255 + tagSize)
+	if size <= tagSize {
+		return 0
+	}
+
+	full, rem := size/(chunkSize+tagSize), size%(chunkSize+tagSize)
+	return full*chunkSize + max(rem-tagSize, 0)
+}
+
+// Encrypter is a seekable encrypted view of the plaintext source.
+type Encrypter struct {
+	src    io.ReaderAt
+	size   int64 // plaintext size
+	aead   cipher.AEAD
+	prefix []byte
+	header []byte
+
+	off   int64 // offset in the encrypted stream
+	cache struct {
+		index int64
+		data  []byte
+	}
+}
+
+// NewEncrypter encrypts size bytes of src, and name is stored in the sealed header.
+func NewEncrypter(src io.ReaderAt, size int64, name string, secret []byte) (*Encrypter, error) {
+	salt, prefix := make([]byte, saltSize), make([]byte, prefixSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "read salt")
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, errors.Wrap(err, "read nonce prefix")
+	}
+
+	aead, err := newAEAD(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, fixedHeaderSize+len(name)+tagSize)
+	header = append(header, magic...)
+	header = append(header, salt...)
+	header = append(header, prefix...)
+	header = binary.BigEndian.AppendUint32(header, chunkSize)
+	header = binary.BigEndian.AppendUint64(header, uint64(size))
+	header = binary.BigEndian.AppendUint16(header, uint16(len(name)+tagSize))
+	header = aead.Seal(header, nameNonce(prefix), []byte(name), header[:fixedHeaderSize-2])
+
+	e := &Encrypter{
+		src:    src,
+		size:   size,
+		aead:   aead,
+		prefix: prefix,
+		header: header,
+	}
+	e.cache.index = -1
+
+	return e, nil
+}
+
+// Size returns the size of the encrypted stream
+func (e *Encrypter) Size() int64 {
+	return int64(len(e.header)) + chunks(e.size)*tagSize + e.size
+}
+
+// Size returns the size of the encrypted stream of size bytes plaintext with the name
+func Size(size int64, name string) int64 {
+	return int64(fixedHeaderSize+len(name)+tagSize) + chunks(size)*tagSize + size
+}
+
+func (e *Encrypter) Read(p []byte) (int, error) {
+	if e.off >= e.Size() {
+		return 0, io.EOF
+	}
+
+	if e.off < int64(len(e.header)) {
+		n := copy(p, e.header[e.off:])
+		e.off += int64(n)
+		return n, nil
+	}
+
+	pos := e.off - int64(len(e.header))
+	index, inner := pos/(chunkSize+tagSize), pos%(chunkSize+tagSize)
+
+	chunk, err := e.chunk(index)
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, chunk[inner:])
+	e.off += int64(n)
+	return n, nil
+}
+
+func (e *Encrypter) chunk(index int64) ([]byte, error) {
+	if e.cache.index == index {
+		return e.cache.data, nil
+	}
+
+	start := index * chunkSize
+	plain := make([]byte, min(chunkSize, e.size-start))
+	if _, err := e.src.ReadAt(plain, start); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "read source")
+	}
+
+	last := index == chunks(e.size)-1
+	e.cache.index = index
+	e.cache.data = e.aead.Seal(plain[:0], nonce(e.prefix, uint32(index), last), plain, nil)
+
+	return e.cache.data, nil
+}
+
+func (e *Encrypter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += e.off
+	case io.SeekEnd:
+		offset += e.Size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	e.off = offset
+	return offset, nil
+}
+
+// Decrypt reads the encrypted stream from src, writes plaintext to dst
+// and returns the original name stored in the header.
+func Decrypt(dst io.Writer, src io.Reader, secret []byte) (string, error) {
+	header := make([]byte, fixedHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return "", errors.Wrap(err, "read header")
+	}
+	if !bytes.HasPrefix(header, []byte(magic)) {
+		return "", ErrNotEncrypted
+	}
+
+	h := header[len(magic):]
+	salt, h := h[:saltSize], h[saltSize:]
+	prefix, h := h[:prefixSize], h[prefixSize:]
+	size := binary.BigEndian.Uint32(h) // chunk size
+	plainSize := int64(binary.BigEndian.Uint64(h[4:]))
+	nameLen := binary.BigEndian.Uint16(h[12:])
+
+	if size != chunkSize || nameLen < tagSize || plainSize < 0 {
+		return "", errors.New("invalid header")
+	}
+
+	aead, err := newAEAD(secret, salt)
+	if err != nil {
+		return "", err
+	}
+
+	sealedName := make([]byte, nameLen)
+	if _, err = io.ReadFull(src, sealedName); err != nil {
+		return "", errors.Wrap(err, "read name")
+	}
+	name, err := aead.Open(nil, nameNonce(prefix), sealedName, header[:fixedHeaderSize-2])
+	if err != nil {
+		return "", errors.Wrap(err, "wrong key or corrupted header")
+	}
+
+	n := chunks(plainSize)
+	buf := make([]byte, chunkSize+tagSize)
+	for i := int64(0); i < n; i++ {
+		l := min(chunkSize, plainSize-i*chunkSize) + tagSize
+		if _, err = io.ReadFull(src, buf[:l]); err != nil {
+			return "", errors.Wrapf(err, "read chunk %d", i)
+		}
+
+		plain, err := aead.Open(buf[:0], nonce(prefix, uint32(i), i == n-1), buf[:l], nil)
+		if err != nil {
+			return "", errors.Wrapf(err, "corrupted chunk %d", i)
+		}
+
+		if _, err = dst.Write(plain); err != nil {
+			return "", errors.Wrap(err, "write")
+		}
+	}
+
+	return string(name), nil
+}
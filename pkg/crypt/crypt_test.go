@@ -0,0 +1,85 @@
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	secret := []byte("secret")
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize*3 + 7} {
+		plain := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(plain)
+
+		e, err := NewEncrypter(bytes.NewReader(plain), int64(size), "file.bin", secret)
+		require.NoError(t, err)
+
+		enc, err := io.ReadAll(e)
+		require.NoError(t, err)
+		assert.Equal(t, e.Size(), int64(len(enc)))
+		assert.Equal(t, e.Size(), Size(int64(size), "file.bin"))
+		assert.True(t, IsEncrypted(bytes.NewReader(enc)))
+
+		// seek and read again should produce the same stream
+		_, err = e.Seek(int64(len(enc)/2), io.SeekStart)
+		require.NoError(t, err)
+		tail, err := io.ReadAll(e)
+		require.NoError(t, err)
+		assert.Equal(t, enc[len(enc)/2:], tail)
+
+		out := &bytes.Buffer{}
+		name, err := Decrypt(out, bytes.NewReader(enc), secret)
+		require.NoError(t, err)
+		assert.Equal(t, "file.bin", name)
+		assert.True(t, bytes.Equal(plain, out.Bytes()))
+
+		_, err = Decrypt(io.Discard, bytes.NewReader(enc), []byte("wrong"))
+		assert.Error(t, err)
+
+		// tamper the last byte
+		enc[len(enc)-1] ^= 1
+		_, err = Decrypt(io.Discard, bytes.NewReader(enc), secret)
+		assert.Error(t, err)
+	}
+}
+
+func TestDecryptTruncated(t *testing.T) {
+	plain := bytes.Repeat([]byte{1}, chunkSize*2)
+
+	e, err := NewEncrypter(bytes.NewReader(plain), int64(len(plain)), "file.bin", []byte("secret"))
+	require.NoError(t, err)
+	enc, err := io.ReadAll(e)
+	require.NoError(t, err)
+
+	_, err = Decrypt(io.Discard, bytes.NewReader(enc[:len(enc)-chunkSize-tagSize]), []byte("secret"))
+	assert.Error(t, err)
+
+	_, err = Decrypt(io.Discard, bytes.NewReader([]byte("plain text file")), []byte("secret"))
+	assert.Error(t, err)
+	assert.False(t, IsEncrypted(bytes.NewReader([]byte("plain"))))
+}
+
+func TestMaxPlainSize(t *testing.T) {
+	name := string(bytes.Repeat([]byte("n"), 255))
+
+	for _, size := range []int64{0, 300, 1 << 20, 2000 * 1024 * 1024} {
+		plain := MaxPlainSize(size)
+		if plain == 0 {
+			continue
+		}
+
+		e, err := NewEncrypter(bytes.NewReader(nil), plain, name, []byte("secret"))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, e.Size(), size)
+
+		e, err = NewEncrypter(bytes.NewReader(nil), plain+1, name, []byte("secret"))
+		require.NoError(t, err)
+		assert.Greater(t, e.Size(), size)
+	}
+}
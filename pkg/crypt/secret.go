@@ -0,0 +1,33 @@
+package crypt
+
+import (
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/go-faster/errors"
+)
+
+// Secret loads the secret from key file or passphrase, and asks user
+// to input the passphrase if both are empty.
+func Secret(keyFile, passphrase string) ([]byte, error) {
+	if keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read key file")
+		}
+		if len(b) == 0 {
+			return nil, errors.New("empty key file")
+		}
+		return b, nil
+	}
+
+	if passphrase == "" {
+		if err := survey.AskOne(&survey.Password{
+			Message: "Passphrase:",
+		}, &passphrase, survey.WithValidator(survey.Required)); err != nil {
+			return nil, errors.Wrap(err, "ask passphrase")
+		}
+	}
+
+	return []byte(passphrase), nil
+}
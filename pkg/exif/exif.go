@@ -0,0 +1,248 @@
+// Package exif reads a few commonly used EXIF tags from JPEG images.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// EXIF is the subset of tags used by upload expressions
+type EXIF struct {
+	Make      string
+	Model     string
+	DateTaken time.Time // zero if unknown
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+}
+
+var ErrNotFound = errors.New("exif not found")
+
+const (
+	markerSOI  = 0xD8
+	markerAPP1 = 0xE1
+	markerSOS  = 0xDA
+
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+
+	dateLayout = "2006:01:02 15:04:05"
+
+	// exif segment is limited to 64KB by JPEG
+	maxSegment = 64 * 1024
+)
+
+// Read reads EXIF from the JPEG stream. Date is parsed in the local time zone
+// as EXIF has no zone information.
+func Read(r io.Reader) (*EXIF, error) {
+	data, err := findSegment(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(data)
+}
+
+// findSegment returns the TIFF data of the APP1 Exif segment
+func findSegment(r io.Reader) ([]byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, ErrNotFound
+	}
+	if head[0] != 0xFF || head[1] != markerSOI {
+		return nil, ErrNotFound
+	}
+
+	for {
+		marker := make([]byte, 4)
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, ErrNotFound
+		}
+		if marker[0] != 0xFF || marker[1] == markerSOS {
+			return nil, ErrNotFound
+		}
+
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 || size > maxSegment {
+			return nil, errors.New("invalid segment size")
+		}
+
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, errors.Wrap(err, "read segment")
+		}
+
+		if marker[1] == markerAPP1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+type reader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type entry struct {
+	typ    uint16
+	count  uint32
+	offset []byte // value or offset of value
+}
+
+func parse(data []byte) (*EXIF, error) {
+	if len(data) < 8 {
+		return nil, errors.New("invalid tiff header")
+	}
+
+	r := &reader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid byte order")
+	}
+
+	ifd0, err := r.ifd(r.order.Uint32(data[4:]))
+	if err != nil {
+		return nil, errors.Wrap(err, "read ifd0")
+	}
+
+	e := &EXIF{
+		Make:  r.string(ifd0[tagMake]),
+		Model: r.string(ifd0[tagModel]),
+	}
+	date := r.string(ifd0[tagDateTime])
+
+	if sub, ok := ifd0[tagExifIFD]; ok {
+		if ifd, err := r.ifd(r.uint(sub)); err == nil {
+			if d := r.string(ifd[tagDateTimeOriginal]); d != "" {
+				date = d
+			}
+		}
+	}
+	if t, err := time.ParseInLocation(dateLayout, date, time.Local); err == nil {
+		e.DateTaken = t
+	}
+
+	if sub, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := r.ifd(r.uint(sub)); err == nil {
+			lat, latOK := r.degrees(gps[tagGPSLatitude])
+			lng, lngOK := r.degrees(gps[tagGPSLongitude])
+			if latOK && lngOK {
+				if r.string(gps[tagGPSLatitudeRef]) == "S" {
+					lat = -lat
+				}
+				if r.string(gps[tagGPSLongitudeRef]) == "W" {
+					lng = -lng
+				}
+				e.HasGPS, e.Latitude, e.Longitude = true, lat, lng
+			}
+		}
+	}
+
+	return e, nil
+}
+
+func (r *reader) ifd(offset uint32) (map[uint16]entry, error) {
+	if int(offset)+2 > len(r.data) {
+		return nil, errors.New("ifd out of range")
+	}
+
+	n := int(r.order.Uint16(r.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(r.data) {
+		return nil, errors.New("ifd entries out of range")
+	}
+
+	entries := make(map[uint16]entry, n)
+	for i := 0; i < n; i++ {
+		b := r.data[start+i*12 : start+(i+1)*12]
+		entries[r.order.Uint16(b)] = entry{
+			typ:    r.order.Uint16(b[2:]),
+			count:  r.order.Uint32(b[4:]),
+			offset: b[8:12],
+		}
+	}
+
+	return entries, nil
+}
+
+// value returns raw bytes of the entry
+func (r *reader) value(e entry, size int) ([]byte, bool) {
+	n := int(e.count) * size
+	if n <= 4 {
+		return e.offset[:n], true
+	}
+
+	off := int(r.order.Uint32(e.offset))
+	if off < 0 || off+n > len(r.data) {
+		return nil, false
+	}
+	return r.data[off : off+n], true
+}
+
+func (r *reader) string(e entry) string {
+	if e.typ != typeASCII {
+		return ""
+	}
+
+	b, ok := r.value(e, 1)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
+
+func (r *reader) uint(e entry) uint32 {
+	switch e.typ {
+	case typeShort:
+		return uint32(r.order.Uint16(e.offset))
+	case typeLong:
+		return r.order.Uint32(e.offset)
+	default:
+		return 0
+	}
+}
+
+// degrees converts degrees, minutes and seconds rationals to decimal degrees
+func (r *reader) degrees(e entry) (float64, bool) {
+	if e.typ != typeRational || e.count != 3 {
+		return 0, false
+	}
+
+	b, ok := r.value(e, 8)
+	if !ok {
+		return 0, false
+	}
+
+	var v [3]float64
+	for i := range v {
+		num, den := r.order.Uint32(b[i*8:]), r.order.Uint32(b[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		v[i] = float64(num) / float64(den)
+	}
+
+	return v[0] + v[1]/60 + v[2]/3600, true
+}
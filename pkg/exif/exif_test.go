@@ -0,0 +1,113 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func ascii(tag uint16, s string) testEntry {
+	return testEntry{tag: tag, typ: typeASCII, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func long(tag uint16, v uint32) testEntry {
+	return testEntry{tag: tag, typ: typeLong, count: 1, data: binary.BigEndian.AppendUint32(nil, v)}
+}
+
+func rationals(tag uint16, v ...uint32) testEntry {
+	b := make([]byte, 0, len(v)*4)
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint32(b, x)
+	}
+	return testEntry{tag: tag, typ: typeRational, count: uint32(len(v) / 2), data: b}
+}
+
+// appendIFD appends a big-endian IFD with its data area and returns the offset of it
+func appendIFD(buf *bytes.Buffer, entries ...testEntry) uint32 {
+	offset := uint32(buf.Len())
+	dataOff := offset + 2 + uint32(len(entries))*12 + 4
+
+	data := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(entries)))
+	for _, e := range entries {
+		_ = binary.Write(buf, binary.BigEndian, e.tag)
+		_ = binary.Write(buf, binary.BigEndian, e.typ)
+		_ = binary.Write(buf, binary.BigEndian, e.count)
+		if len(e.data) <= 4 {
+			buf.Write(append(e.data, make([]byte, 4-len(e.data))...))
+			continue
+		}
+		_ = binary.Write(buf, binary.BigEndian, dataOff+uint32(data.Len()))
+		data.Write(e.data)
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint32(0)) // next ifd
+	buf.Write(data.Bytes())
+
+	return offset
+}
+
+func testJPEG(t *testing.T) []byte {
+	tiff := &bytes.Buffer{}
+	tiff.Write([]byte{'M', 'M', 0, 42, 0, 0, 0, 0}) // ifd0 offset is filled later
+
+	exifIFD := appendIFD(tiff, ascii(tagDateTimeOriginal, "2023:05:06 07:08:09"))
+	gpsIFD := appendIFD(tiff,
+		ascii(tagGPSLatitudeRef, "N"),
+		rationals(tagGPSLatitude, 31, 1, 30, 1, 0, 1),
+		ascii(tagGPSLongitudeRef, "W"),
+		rationals(tagGPSLongitude, 121, 1, 15, 1, 36, 1),
+	)
+	ifd0 := appendIFD(tiff,
+		ascii(tagMake, "Canon"),
+		ascii(tagModel, "R5"),
+		ascii(tagDateTime, "2024:01:01 00:00:00"),
+		long(tagExifIFD, exifIFD),
+		long(tagGPSIFD, gpsIFD),
+	)
+
+	b := tiff.Bytes()
+	binary.BigEndian.PutUint32(b[4:], ifd0)
+
+	segment := append([]byte("Exif\x00\x00"), b...)
+	require.Less(t, len(segment), maxSegment)
+
+	jpeg := &bytes.Buffer{}
+	jpeg.Write([]byte{0xFF, markerSOI})
+	jpeg.Write([]byte{0xFF, 0xE0, 0, 4, 0, 0}) // APP0 before APP1
+	jpeg.Write([]byte{0xFF, markerAPP1})
+	_ = binary.Write(jpeg, binary.BigEndian, uint16(len(segment)+2))
+	jpeg.Write(segment)
+	jpeg.Write([]byte{0xFF, markerSOS, 0, 2})
+
+	return jpeg.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	e, err := Read(bytes.NewReader(testJPEG(t)))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Canon", e.Make)
+	assert.Equal(t, "R5", e.Model)
+	assert.Equal(t, time.Date(2023, 5, 6, 7, 8, 9, 0, time.Local), e.DateTaken)
+	assert.True(t, e.HasGPS)
+	assert.InDelta(t, 31.5, e.Latitude, 1e-9)
+	assert.InDelta(t, -121.26, e.Longitude, 1e-9)
+}
+
+func TestReadNotFound(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("not a jpeg")))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = Read(bytes.NewReader([]byte{0xFF, markerSOI, 0xFF, markerSOS, 0, 2}))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -1,6 +1,8 @@
 package key
 
 import (
+	"strconv"
+
 	"github.com/iyear/tdl/core/storage/keygen"
 )
 
@@ -11,3 +13,28 @@ func App() string {
 func Resume(fingerprint string) string {
 	return keygen.New("resume", fingerprint)
 }
+
+// Uploaded records the SHA-256 of the file which has been uploaded to the peer
+func Uploaded(peer int64, hash string) string {
+	return keygen.New("uploaded", strconv.FormatInt(peer, 10), hash)
+}
+
+// Sync records the state of a directory synced to the peer
+func Sync(fingerprint string) string {
+	return keygen.New("sync", fingerprint)
+}
+
+// Mirror records destination copies of the forwarded source message
+func Mirror(peer int64, msg int) string {
+	return keygen.New("mirror", strconv.FormatInt(peer, 10), strconv.Itoa(msg))
+}
+
+// Export records the newest message scanned by incremental export of the chat
+func Export(peer int64, thread int) string {
+	return keygen.New("export", strconv.FormatInt(peer, 10), strconv.Itoa(thread))
+}
+
+// Parts records downloaded parts of the split file
+func Parts(id string) string {
+	return keygen.New("parts", id)
+}
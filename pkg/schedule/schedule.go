@@ -0,0 +1,118 @@
+// Package schedule parses the schedule spec of 'tdl upload --schedule'.
+//
+// The spec is either an absolute time, e.g. "2024-01-02 09:00",
+// or a spacing like "every 30m from 09:00", which schedules
+// the first message at start time and each next one an interval later.
+package schedule
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// layouts are accepted formats of time, parsed in local time zone if no zone is specified
+var layouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// clock layouts are relative to the day of now
+var clockLayouts = []string{
+	"15:04:05",
+	"15:04",
+}
+
+var (
+	// every matches the prefix of spacing specs
+	every = regexp.MustCompile(`^(?i:every)\s`)
+	// fromSep separates the interval and start time, case-insensitive like the prefix
+	fromSep = regexp.MustCompile(`\s(?i:from)\s`)
+)
+
+// shape matches the beginning of spacing specs, dates and clock times
+var shape = regexp.MustCompile(`^(?i:every\s)|^\d{4}-\d{1,2}-\d{1,2}|^\d{1,2}:\d{2}`)
+
+// Like reports whether s has the shape of a spec, so that the error of Parse
+// should be reported instead of trying other ways, e.g. expressions.
+func Like(s string) bool {
+	return shape.MatchString(strings.TrimSpace(s))
+}
+
+// Spacing schedules the i-th message at Start + i*Every
+type Spacing struct {
+	Start time.Time
+	Every time.Duration // zero means all messages are scheduled at Start
+}
+
+// At returns the schedule time of the i-th message
+func (s *Spacing) At(i int) time.Time {
+	return s.Start.Add(time.Duration(i) * s.Every)
+}
+
+// Parse parses an absolute time or a spacing spec. The start time of
+// spacing without 'from' is one interval later than now.
+func Parse(s string, now time.Time) (*Spacing, error) {
+	s = strings.TrimSpace(s)
+
+	prefix := every.FindString(s)
+	if prefix == "" {
+		t, err := ParseTime(s, now)
+		if err != nil {
+			return nil, err
+		}
+		return &Spacing{Start: t}, nil
+	}
+
+	parts := fromSep.Split(strings.TrimSpace(s[len(prefix):]), 2)
+
+	interval, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse interval")
+	}
+	if interval <= 0 {
+		return nil, errors.Errorf("interval must be positive: %s", interval)
+	}
+
+	start := now.Add(interval)
+	if len(parts) == 2 {
+		if start, err = ParseTime(parts[1], now); err != nil {
+			return nil, errors.Wrap(err, "parse start time")
+		}
+	}
+
+	return &Spacing{Start: start, Every: interval}, nil
+}
+
+// ParseTime parses the time in accepted layouts. Clock time like "09:00"
+// means the next occurrence of it after now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	for _, layout := range clockLayouts {
+		c, err := time.ParseInLocation(layout, s, now.Location())
+		if err != nil {
+			continue
+		}
+
+		t := time.Date(now.Year(), now.Month(), now.Day(),
+			c.Hour(), c.Minute(), c.Second(), 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, errors.Errorf("invalid time: %q", s)
+}
@@ -0,0 +1,86 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2024-01-03 09:00", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)},
+		{"2024-01-03 09:00:30", time.Date(2024, 1, 3, 9, 0, 30, 0, time.UTC)},
+		{"2024-01-03T09:00:00+08:00", time.Date(2024, 1, 3, 1, 0, 0, 0, time.UTC)},
+		{"11:30", time.Date(2024, 1, 2, 11, 30, 0, 0, time.UTC)},
+		{"09:00", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)},
+		{"10:00", time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTime(tt.input, now)
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+		})
+	}
+
+	_, err := ParseTime("tomorrow", now)
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	s, err := Parse("2024-01-03 09:00", now)
+	require.NoError(t, err)
+	assert.Equal(t, s.At(0), s.At(5))
+
+	s, err = Parse("every 30m from 09:00", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC), s.At(0))
+	assert.Equal(t, time.Date(2024, 1, 3, 10, 30, 0, 0, time.UTC), s.At(3))
+
+	s, err = Parse("EVERY 1h  From\t11:00", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC), s.At(0))
+	assert.Equal(t, time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC), s.At(1))
+
+	s, err = Parse("Every 1h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), s.At(0))
+	assert.Equal(t, now.Add(3*time.Hour), s.At(2))
+
+	for _, input := range []string{"every", "every -1h", "every 1h from noon", "FileName"} {
+		_, err = Parse(input, now)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestLike(t *testing.T) {
+	tests := []struct {
+		input string
+		like  bool
+	}{
+		{"2024-01-02 09:00", true},
+		{"2024-13-45 09:00", true},
+		{"25:00", true},
+		{" every 30x from 09:00", true},
+		{"Every 1h", true},
+		{"1700000000", false},
+		{`FileSize > 1024 ? "09:00" : ""`, false},
+		{"everyone", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.like, Like(tt.input))
+		})
+	}
+}
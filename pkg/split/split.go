@@ -0,0 +1,198 @@
+package split
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// Tag marks the manifest line in the caption of each uploaded part.
+const Tag = "#tdlsplit"
+
+// Manifest describes one part of a file that was split before uploading.
+type Manifest struct {
+	Name   string `json:"name,omitempty"`   // original file name, empty if redacted
+	Size   int64  `json:"size"`             // original file size
+	SHA256 string `json:"sha256,omitempty"` // hex digest of the original file, empty if redacted
+	Key    string `json:"key,omitempty"`    // opaque id of the original file, set if redacted
+	Part   int    `json:"part"`             // 1-based part index
+	Total  int    `json:"total"`            // total number of parts
+	Offset int64  `json:"offset"`           // offset of this part in the original file
+	Length int64  `json:"length"`           // length of this part
+}
+
+// ID identifies all parts that belong to the same original file.
+func (m *Manifest) ID() string {
+	if m.Key != "" {
+		return m.Key
+	}
+	return m.SHA256 + ":" + m.Name
+}
+
+// PartName returns the file name of the part, e.g. disk.img.part001.
+// It should be called on the manifest which is not redacted.
+func (m *Manifest) PartName() string {
+	return m.Name + m.partSuffix()
+}
+
+func (m *Manifest) partSuffix() string {
+	return fmt.Sprintf(".part%03d", m.Part)
+}
+
+// Redact returns a copy of the manifest without name and hash of the original file,
+// which are kept in the encrypted part instead. Parts of the same file have the same
+// key, which is derived from the secret, so it can't be linked to the original file.
+func (m *Manifest) Redact(secret []byte) *Manifest {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(m.ID()))
+
+	r := *m
+	r.Name, r.SHA256 = "", ""
+	r.Key = hex.EncodeToString(h.Sum(nil))[:32]
+	return &r
+}
+
+// OriginalName returns the name of the original file. If the manifest is redacted,
+// it's derived from the name of the decrypted part, e.g. disk.img.part001 -> disk.img
+func (m *Manifest) OriginalName(part string) string {
+	if m.Name != "" {
+		return m.Name
+	}
+	if name := strings.TrimSuffix(part, m.partSuffix()); name != part && name != "" {
+		return name
+	}
+	return m.Key
+}
+
+// String encodes the manifest as a single caption line.
+func (m *Manifest) String() string {
+	b, _ := json.Marshal(m)
+	return Tag + " " + string(b)
+}
+
+// Parse finds and decodes the manifest line in message text.
+func Parse(text string) (*Manifest, bool) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, Tag+" ") {
+			continue
+		}
+
+		m := &Manifest{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, Tag+" ")), m); err != nil {
+			return nil, false
+		}
+		if m.Part < 1 || m.Part > m.Total || (m.Name == "" && m.Key == "") {
+			return nil, false
+		}
+
+		return m, true
+	}
+
+	return nil, false
+}
+
+// Plan computes the hash of the file and returns the manifest of each part.
+// It returns nil if the file is not larger than size.
+func Plan(path string, size int64) ([]*Manifest, error) {
+	if size <= 0 {
+		return nil, errors.New("split size must be positive")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	defer func() { _ = f.Close() }()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat file")
+	}
+	if stat.Size() <= size {
+		return nil, nil
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, bufio.NewReader(f)); err != nil {
+		return nil, errors.Wrap(err, "hash file")
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	total := int((stat.Size() + size - 1) / size)
+	parts := make([]*Manifest, 0, total)
+	for i := 0; i < total; i++ {
+		offset := int64(i) * size
+		parts = append(parts, &Manifest{
+			Name:   stat.Name(),
+			Size:   stat.Size(),
+			SHA256: sum,
+			Part:   i + 1,
+			Total:  total,
+			Offset: offset,
+			Length: min(size, stat.Size()-offset),
+		})
+	}
+
+	return parts, nil
+}
+
+// Join concatenates parts (ordered by part index) into dst and verifies the hash.
+// dst must not exist, and it's removed if verification fails.
+func Join(dst string, m *Manifest, parts []string) (rerr error) {
+	if len(parts) != m.Total {
+		return errors.Errorf("expect %d parts, got %d", m.Total, len(parts))
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "create file")
+	}
+	defer func() {
+		if err := out.Close(); err != nil && rerr == nil {
+			rerr = errors.Wrap(err, "close file")
+		}
+		if rerr != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	h := sha256.New()
+	w := io.MultiWriter(out, h)
+	size := int64(0)
+	for _, p := range parts {
+		n, err := copyFile(w, p)
+		if err != nil {
+			return errors.Wrapf(err, "copy part %s", p)
+		}
+		size += n
+	}
+
+	if size != m.Size {
+		return errors.Errorf("size mismatch: expect %d, got %d", m.Size, size)
+	}
+	// redacted parts are verified by decryption instead
+	if sum := hex.EncodeToString(h.Sum(nil)); m.SHA256 != "" && sum != m.SHA256 {
+		return errors.Errorf("sha256 mismatch: expect %s, got %s", m.SHA256, sum)
+	}
+
+	return nil
+}
+
+func copyFile(w io.Writer, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return io.Copy(w, f)
+}
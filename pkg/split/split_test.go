@@ -0,0 +1,105 @@
+package split
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	m := &Manifest{Name: "disk.img", Size: 10, SHA256: "abc", Part: 2, Total: 3, Offset: 4, Length: 4}
+
+	got, ok := Parse("<code>disk.img</code>\n" + m.String())
+	require.True(t, ok)
+	assert.Equal(t, m, got)
+	assert.Equal(t, "disk.img.part002", got.PartName())
+
+	_, ok = Parse("no manifest here")
+	assert.False(t, ok)
+
+	_, ok = Parse(Tag + " {invalid")
+	assert.False(t, ok)
+
+	_, ok = Parse(Tag + ` {"name":"a","part":4,"total":3}`)
+	assert.False(t, ok)
+}
+
+func TestPlanJoin(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	src := filepath.Join(dir, "disk.img")
+	require.NoError(t, os.WriteFile(src, data, 0o644))
+
+	parts, err := Plan(src, 1000)
+	require.NoError(t, err)
+	assert.Nil(t, parts)
+
+	parts, err = Plan(src, 30)
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+	assert.Equal(t, int64(10), parts[3].Length)
+
+	f, err := os.Open(src)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	paths := make([]string, 0, len(parts))
+	for _, p := range parts {
+		b, err := io.ReadAll(io.NewSectionReader(f, p.Offset, p.Length))
+		require.NoError(t, err)
+
+		path := filepath.Join(dir, p.PartName())
+		require.NoError(t, os.WriteFile(path, b, 0o644))
+		paths = append(paths, path)
+	}
+
+	dst := filepath.Join(dir, "joined.img")
+	require.NoError(t, Join(dst, parts[0], paths))
+
+	joined, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, data, joined)
+
+	// existing file is never overwritten
+	require.NoError(t, os.WriteFile(dst, []byte("user file"), 0o644))
+	assert.ErrorIs(t, Join(dst, parts[0], paths), os.ErrExist)
+	existing, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "user file", string(existing))
+
+	// corrupted part
+	dst = filepath.Join(dir, "corrupted.img")
+	require.NoError(t, os.WriteFile(paths[1], []byte("xxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"), 0o644))
+	assert.Error(t, Join(dst, parts[0], paths))
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRedact(t *testing.T) {
+	m := &Manifest{Name: "disk.img", Size: 10, SHA256: "abc", Part: 2, Total: 3, Offset: 4, Length: 4}
+	other := &Manifest{Name: "disk.img", Size: 10, SHA256: "abc", Part: 3, Total: 3, Offset: 8, Length: 2}
+
+	r := m.Redact([]byte("secret"))
+	assert.Empty(t, r.Name)
+	assert.Empty(t, r.SHA256)
+	assert.NotContains(t, r.String(), "disk.img")
+	assert.NotContains(t, r.String(), "abc")
+	assert.Equal(t, "disk.img", m.Name, "original manifest should not be changed")
+
+	// parts of the same file have the same id
+	assert.Equal(t, r.ID(), other.Redact([]byte("secret")).ID())
+	assert.NotEqual(t, r.ID(), m.Redact([]byte("other")).ID())
+
+	got, ok := Parse(r.String())
+	require.True(t, ok)
+	assert.Equal(t, r, got)
+
+	assert.Equal(t, "disk.img", got.OriginalName("disk.img.part002"))
+	assert.Equal(t, r.Key, got.OriginalName("random.bin"))
+	assert.Equal(t, "disk.img", m.OriginalName("random.bin"))
+}
@@ -89,6 +89,12 @@ func (f *FieldsGetter) walk(v reflect.Type, field *Field, fields *[]*Field) {
 				continue
 			}
 
+			// fields of embedded struct are promoted, e.g. Env.FileName is FileName
+			if fd.Anonymous {
+				f.walk(fd.Type, &Field{Path: field.Path}, fields)
+				continue
+			}
+
 			f.walk(fd.Type, &Field{
 				Path:    append(field.Path, fd.Name),
 				Comment: fd.Tag.Get(f.opts.tagName),
@@ -45,3 +45,23 @@ F4.F7.F12[].F13: int # f13 comment
 `
 	assert.Equal(t, expected, fg.Sprint(fields, false))
 }
+
+func TestFieldsGetterEmbedded(t *testing.T) {
+	type Base struct {
+		F1 string `comment:"f1 comment"`
+	}
+	type T struct {
+		Base
+		F2 int `comment:"f2 comment"`
+	}
+
+	fg := NewFieldsGetter(nil)
+
+	fields, err := fg.Walk(T{})
+	require.NoError(t, err)
+
+	expected := `F1: string # f1 comment
+F2: int # f2 comment
+`
+	assert.Equal(t, expected, fg.Sprint(fields, false))
+}
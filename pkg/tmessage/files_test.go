@@ -0,0 +1,44 @@
+package tmessage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectArchive(t *testing.T) {
+	// archive export of a group with service, text, photo, file and poll messages
+	archive := filepath.Join("testdata", "archive.json")
+
+	manager := peers.Options{}.Build(tg.NewClient(nil))
+	chat := manager.Channel(&tg.Channel{ID: 100, AccessHash: 1})
+
+	tests := []struct {
+		name      string
+		onlyMedia bool
+		want      []int
+	}{
+		{name: "all messages", onlyMedia: false, want: []int{5, 4, 3, 2}}, // service messages are skipped
+		{name: "only media", onlyMedia: true, want: []int{4, 3}},          // photos and files
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(archive)
+			require.NoError(t, err)
+			defer func() { _ = f.Close() }()
+
+			d, err := collect(context.Background(), f, chat, tt.onlyMedia)
+			require.NoError(t, err)
+
+			assert.Equal(t, chat.InputPeer(), d.Peer)
+			assert.Equal(t, tt.want, d.Messages)
+		})
+	}
+}
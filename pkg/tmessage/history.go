@@ -0,0 +1,55 @@
+package tmessage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/util/tutil"
+)
+
+// History returns the iterator of chat history from newest to oldest, or replies of the thread
+// if thread is not zero. Replies of broadcast channels are in the discussion group, so the chat
+// where messages are is also returned, which is the discussion group or peer itself.
+func History(ctx context.Context, client *tg.Client, manager *peers.Manager, peer peers.Peer, thread int) (*messages.Iterator, peers.Peer, error) {
+	if thread == 0 {
+		q := query.NewQuery(client).Messages().GetHistory(peer.InputPeer())
+		return messages.NewIterator(q, 100), peer, nil
+	}
+
+	// topic messages, reply messages
+	q := query.NewQuery(client).Messages().GetReplies(peer.InputPeer()).MsgID(thread)
+	iter := messages.NewIterator(q, 100)
+
+	p, ok := peer.(peers.Channel)
+	if !ok || !p.IsBroadcast() {
+		return iter, peer, nil
+	}
+
+	chat, err := linkedChat(ctx, manager, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return iter, chat, nil
+}
+
+// linkedChat returns the discussion group of the broadcast channel
+func linkedChat(ctx context.Context, manager *peers.Manager, p peers.Channel) (peers.Peer, error) {
+	bc, _ := p.ToBroadcast()
+	raw, err := bc.FullRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broadcast full raw: %w", err)
+	}
+
+	id, ok := raw.GetLinkedChatID()
+	if !ok {
+		return nil, fmt.Errorf("no linked group")
+	}
+
+	return tutil.GetInputPeer(ctx, manager, strconv.FormatInt(id, 10))
+}
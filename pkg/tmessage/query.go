@@ -0,0 +1,182 @@
+package tmessage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/dcpool"
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/texpr"
+)
+
+// QueryPrefix is the prefix of live query source, e.g. chat:@name?since=2024-01-01&filter=...
+const QueryPrefix = "chat:"
+
+// Query describes messages which are read from chat history directly
+type Query struct {
+	Chat   string
+	Thread int       // topic id in forum, message id in group
+	Since  time.Time // zero means no lower bound
+	Until  time.Time // zero means no upper bound
+	Limit  int       // zero means no limit
+	Filter string    // expression on message, empty means all
+}
+
+// ParseQuery parses query source. Filter must be the last parameter, because
+// expressions may contain '&', and the rest of source is taken as it.
+func ParseQuery(s string) (*Query, error) {
+	if !strings.HasPrefix(s, QueryPrefix) {
+		return nil, fmt.Errorf("query must start with %q", QueryPrefix)
+	}
+	s = strings.TrimPrefix(s, QueryPrefix)
+
+	chat, params, _ := strings.Cut(s, "?")
+	q := &Query{Chat: chat}
+
+	for params != "" {
+		var param string
+		param, params, _ = strings.Cut(params, "&")
+
+		key, value, _ := strings.Cut(param, "=")
+		var err error
+		switch key {
+		case "filter":
+			// filter takes the rest of source
+			if params != "" {
+				value += "&" + params
+			}
+			q.Filter, params = value, ""
+		case "since":
+			q.Since, err = parseTime(value)
+		case "until":
+			q.Until, err = parseTime(value)
+		case "thread":
+			q.Thread, err = strconv.Atoi(value)
+		case "limit":
+			q.Limit, err = strconv.Atoi(value)
+		default:
+			return nil, fmt.Errorf("unknown query parameter %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid query parameter %q: %w", key, err)
+		}
+	}
+
+	return q, nil
+}
+
+// parseTime parses date, RFC3339 time or unix timestamp
+func parseTime(s string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// FromQuery pages chat history of each query. Messages are returned from oldest to newest.
+func FromQuery(ctx context.Context, pool dcpool.Pool, kvd storage.Storage, queries []string) ParseSource {
+	return func() ([]*Dialog, error) {
+		dialogs := make([]*Dialog, 0, len(queries))
+
+		for _, s := range queries {
+			q, err := ParseQuery(s)
+			if err != nil {
+				return nil, err
+			}
+
+			d, err := collectQuery(ctx, pool.Default(ctx), kvd, q)
+			if err != nil {
+				return nil, err
+			}
+
+			logctx.From(ctx).Debug("Parse query",
+				zap.String("query", s),
+				zap.Int("num", len(d.Messages)))
+			dialogs = append(dialogs, d)
+		}
+
+		return dialogs, nil
+	}
+}
+
+func collectQuery(ctx context.Context, client *tg.Client, kvd storage.Storage, q *Query) (*Dialog, error) {
+	filter := "true"
+	if q.Filter != "" {
+		filter = q.Filter
+	}
+	program, err := expr.Compile(filter, expr.Env(texpr.EnvMessage{}), expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile filter: %w", err)
+	}
+
+	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(client)
+
+	var peer peers.Peer
+	if q.Chat == "" { // defaults to me(saved messages)
+		peer, err = manager.Self(ctx)
+	} else {
+		peer, err = tutil.GetInputPeer(ctx, manager, q.Chat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer: %w", err)
+	}
+
+	iter, peer, err := History(ctx, client, manager, peer, q.Thread)
+	if err != nil {
+		return nil, err
+	}
+	if !q.Until.IsZero() {
+		iter = iter.OffsetDate(int(q.Until.Unix()) + 1)
+	}
+
+	ids := make([]int, 0)
+	for iter.Next(ctx) {
+		if q.Limit > 0 && len(ids) >= q.Limit {
+			break
+		}
+
+		msg := iter.Value()
+		if !q.Since.IsZero() && msg.Msg.GetDate() < int(q.Since.Unix()) {
+			break
+		}
+
+		m, ok := msg.Msg.(*tg.Message)
+		if !ok {
+			continue
+		}
+
+		b, err := texpr.Run(program, texpr.ConvertEnvMessage(m))
+		if err != nil {
+			return nil, fmt.Errorf("failed to run filter: %w", err)
+		}
+		if !b.(bool) { // filtered
+			continue
+		}
+
+		ids = append(ids, m.ID)
+	}
+	if err = iter.Err(); err != nil {
+		return nil, err
+	}
+
+	// history is from newest to oldest
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+
+	return &Dialog{Peer: peer.InputPeer(), Messages: ids}, nil
+}
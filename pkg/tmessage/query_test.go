@@ -0,0 +1,40 @@
+package tmessage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(`chat:@name?since=2024-01-01&until=1704153600&thread=3&limit=10&filter=Views > 5 && Media.Name endsWith ".mp4"`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "@name", q.Chat)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), q.Since)
+	assert.Equal(t, int64(1704153600), q.Until.Unix())
+	assert.Equal(t, 3, q.Thread)
+	assert.Equal(t, 10, q.Limit)
+	assert.Equal(t, `Views > 5 && Media.Name endsWith ".mp4"`, q.Filter)
+
+	q, err = ParseQuery("chat:123456")
+	require.NoError(t, err)
+	assert.Equal(t, &Query{Chat: "123456"}, q)
+
+	q, err = ParseQuery("chat:?until=2024-01-02T15:04:05Z")
+	require.NoError(t, err)
+	assert.Equal(t, "", q.Chat)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), q.Until.UTC())
+
+	for _, s := range []string{
+		"@name",
+		"chat:@name?since=yesterday",
+		"chat:@name?thread=a",
+		"chat:@name?unknown=1",
+	} {
+		_, err = ParseQuery(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,36 @@
+package tmessage
+
+import (
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+// FileTemplate is the data of file name template, which is used by download
+// and export to link downloaded media files.
+type FileTemplate struct {
+	DialogID    int64
+	MessageID   int
+	MessageDate int64
+	FileName    string
+	FileCaption string
+	FileSize    string
+	// DownloadDate is the download time. Chat export can't know when the file was
+	// downloaded, so it is the export time there.
+	DownloadDate int64
+}
+
+// NewFileTemplate returns template data of the file in message
+func NewFileTemplate(dialog int64, m *tg.Message, name string, size int64, date time.Time) *FileTemplate {
+	return &FileTemplate{
+		DialogID:     dialog,
+		MessageID:    m.ID,
+		MessageDate:  int64(m.Date),
+		FileName:     name,
+		FileCaption:  m.Message,
+		FileSize:     utils.Byte.FormatBinaryBytes(size),
+		DownloadDate: date.Unix(),
+	}
+}
@@ -0,0 +1,72 @@
+// Package watermark overlays an image on photos.
+package watermark
+
+import (
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	// register decoders of watermark images
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/go-faster/errors"
+)
+
+// maxRatio is the max width of watermark relative to the photo
+const maxRatio = 4
+
+// Apply draws the mark on the bottom-right corner of the photo. The mark is scaled
+// down if it's wider than a quarter of the photo.
+func Apply(photo, mark image.Image) image.Image {
+	b := photo.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), photo, b.Min, draw.Src)
+
+	if maxW := b.Dx() / maxRatio; mark.Bounds().Dx() > maxW && maxW > 0 {
+		mark = scale(mark, maxW, mark.Bounds().Dy()*maxW/mark.Bounds().Dx())
+	}
+
+	margin := b.Dx() / 50
+	mb := mark.Bounds()
+	at := image.Pt(out.Bounds().Dx()-mb.Dx()-margin, out.Bounds().Dy()-mb.Dy()-margin)
+	draw.Draw(out, mb.Sub(mb.Min).Add(at), mark, mb.Min, draw.Over)
+
+	return out
+}
+
+// Encode reads the photo, applies the mark and writes it as JPEG
+func Encode(w io.Writer, photo io.Reader, mark image.Image) error {
+	img, _, err := image.Decode(photo)
+	if err != nil {
+		return errors.Wrap(err, "decode photo")
+	}
+
+	return jpeg.Encode(w, Apply(img, mark), &jpeg.Options{Quality: 90})
+}
+
+// Load decodes the watermark image, which can be PNG, JPEG or GIF
+func Load(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode watermark")
+	}
+	return img, nil
+}
+
+// scale resizes the image with nearest-neighbor sampling
+func scale(src image.Image, w, h int) image.Image {
+	if h < 1 {
+		h = 1
+	}
+
+	sb := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, src.At(sb.Min.X+x*sb.Dx()/w, sb.Min.Y+y*sb.Dy()/h))
+		}
+	}
+	return dst
+}
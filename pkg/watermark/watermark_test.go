@@ -0,0 +1,67 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fill(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestApply(t *testing.T) {
+	white, red := color.RGBA{R: 255, G: 255, B: 255, A: 255}, color.RGBA{R: 255, A: 255}
+
+	out := Apply(fill(200, 100, white), fill(10, 10, red))
+	assert.Equal(t, image.Rect(0, 0, 200, 100), out.Bounds())
+
+	// margin is 4px, so mark is in [186,196)x[86,96)
+	assert.Equal(t, red, out.At(190, 90))
+	assert.Equal(t, white, out.At(197, 97))
+	assert.Equal(t, white, out.At(10, 10))
+}
+
+func TestApplyScale(t *testing.T) {
+	white, red := color.RGBA{R: 255, G: 255, B: 255, A: 255}, color.RGBA{R: 255, A: 255}
+
+	// mark is scaled to 50x25
+	out := Apply(fill(200, 100, white), fill(400, 200, red))
+	assert.Equal(t, red, out.At(150, 75))
+	assert.Equal(t, white, out.At(140, 75))
+	assert.Equal(t, white, out.At(150, 70))
+}
+
+func TestEncode(t *testing.T) {
+	photo := &bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(photo, fill(100, 100, color.White), nil))
+
+	markBuf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(markBuf, fill(10, 10, color.Black)))
+	mark, err := Load(markBuf)
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, Encode(out, photo, mark))
+
+	img, format, err := image.Decode(out)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, 100, 100), img.Bounds())
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	assert.Error(t, Encode(&bytes.Buffer{}, bytes.NewReader([]byte("not image")), fill(1, 1, color.Black)))
+}